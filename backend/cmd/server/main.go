@@ -11,6 +11,7 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/ui-agentbedrock/backend/internal/config"
 	"github.com/ui-agentbedrock/backend/internal/handlers"
+	"github.com/ui-agentbedrock/backend/internal/models"
 	"github.com/ui-agentbedrock/backend/internal/repository"
 	"github.com/ui-agentbedrock/backend/internal/services"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -47,6 +48,10 @@ func main() {
 	// Initialize repositories
 	sessionRepo := repository.NewSessionRepository(db)
 	documentRepo := repository.NewDocumentRepository(db)
+	jobRepo := repository.NewJobRepository(db)
+	agentRepo := repository.NewAgentRepository(db)
+	traceArchiveRepo := repository.NewTraceArchiveRepository(db)
+	sessionLeaseRepo := repository.NewSessionLeaseRepository(db)
 
 	// Initialize services
 	sessionService := services.NewSessionService(sessionRepo)
@@ -55,17 +60,188 @@ func main() {
 		log.Fatalf("Failed to initialize agent service: %v", err)
 	}
 	summarizeService := services.NewSummarizeService(agentService.GetAWSConfig())
-	extractService := services.NewExtractionService()
+
+	// Offline modes: scripted or replayed agent and a fake summarizer, no AWS calls
+	switch cfg.AgentRuntime {
+	case "fake":
+		agentService = agentService.WithRuntime(services.NewFakeRuntime(nil, 150*time.Millisecond))
+		summarizeService = services.NewSummarizeServiceWithModel(services.NewFakeModel())
+		log.Println("Using fake agent runtime (AGENT_RUNTIME=fake)")
+	case "replay":
+		recording, err := services.LoadRecordingFile(cfg.ReplayRecording)
+		if err != nil {
+			log.Fatalf("Failed to load replay recording: %v", err)
+		}
+		// Return-control rounds get the recorded results, no handlers or confirmations
+		agentService = agentService.WithReplay(services.NewReplayRuntime(recording, true))
+		summarizeService = services.NewSummarizeServiceWithModel(services.NewFakeModel())
+		log.Printf("Replaying recording %s for every invocation (AGENT_RUNTIME=replay)", cfg.ReplayRecording)
+	}
+
+	// Record raw agent event streams (optional)
+	var recordingStore services.RecordingStore
+	switch cfg.RecordAgentStreams {
+	case "file":
+		recordingStore, err = services.NewFileRecordingStore(cfg.RecordingsDir)
+		if err != nil {
+			log.Fatalf("Failed to initialize recording store: %v", err)
+		}
+	case "mongo":
+		recordingStore = services.NewMongoRecordingStore(repository.NewRecordingRepository(db))
+	}
+	if recordingStore != nil {
+		agentService = agentService.WithRuntime(services.NewRecordingRuntime(agentService.Runtime(), recordingStore))
+		log.Printf("Recording agent event streams to %s", cfg.RecordAgentStreams)
+	}
+
+	// Go handlers for action groups that return control to the backend
+	actions := services.NewActionRegistry()
+	services.RegisterBuiltinActions(actions)
+	agentService = agentService.WithActions(actions)
+
+	// Actions that require user confirmation wait here for the decision
+	confirmations := services.NewConfirmationRegistry(10 * time.Minute)
+	agentService = agentService.WithConfirmations(confirmations)
+
+	// Price token usage with the default table plus MODEL_PRICES overrides
+	prices := services.NewPriceTable()
+	if cfg.ModelPrices != "" {
+		if err := prices.LoadJSON(cfg.ModelPrices); err != nil {
+			log.Fatalf("Failed to load MODEL_PRICES: %v", err)
+		}
+	}
+	agentService = agentService.WithPrices(prices)
+	summarizeService = summarizeService.WithPrices(prices)
+
+	// Usage reports read one record per agent reply or summarization
+	if err := sessionRepo.EnsureUsageIndexes(ctx); err != nil {
+		log.Printf("Warning: Failed to prepare usage records: %v", err)
+	}
+
+	// Archive the untruncated raw trace of every invocation (TRACE_ARCHIVE_DAYS=0 disables it)
+	var traceArchive *services.TraceArchiveService
+	if cfg.TraceArchiveDays > 0 {
+		if err := traceArchiveRepo.EnsureIndexes(ctx); err != nil {
+			log.Printf("Warning: Failed to create trace archive indexes: %v", err)
+		}
+		traceArchive = services.NewTraceArchiveService(traceArchiveRepo,
+			time.Duration(cfg.TraceArchiveDays)*24*time.Hour, int64(cfg.TraceArchiveMaxMB)<<20)
+		traceArchive.Start(context.Background())
+		agentService = agentService.WithTraceArchive(traceArchive)
+		log.Printf("Archiving raw traces for %d days", cfg.TraceArchiveDays)
+	}
+
+	// Retry transient Bedrock errors, and fail fast while Bedrock keeps failing
+	retry := services.DefaultRetryPolicy
+	retry.MaxRetries = cfg.BedrockMaxRetries
+	agentService = agentService.WithRetry(retry)
+	if cfg.BreakerThreshold > 0 {
+		agentService = agentService.WithCircuitBreaker(services.NewCircuitBreaker(cfg.BreakerThreshold,
+			time.Duration(cfg.BreakerCooldown)*time.Second))
+	}
+
+	// Agent registry: AGENT_ID/AGENT_ALIAS as "default", then AGENTS, then the agents collection
+	agents := services.NewAgentRegistry(agentService)
+	if err := agents.Register(models.AgentDefinition{
+		Key:          "default",
+		AgentID:      cfg.AgentID,
+		AgentAliasID: cfg.AgentAliasID,
+		Name:         cfg.AgentName,
+	}); err != nil {
+		log.Fatalf("Failed to register default agent: %v", err)
+	}
+	if cfg.Agents != "" {
+		if err := agents.RegisterJSON(cfg.Agents); err != nil {
+			log.Fatalf("Failed to load AGENTS: %v", err)
+		}
+	}
+	if err := agents.LoadFromRepository(ctx, agentRepo); err != nil {
+		log.Printf("Warning: Failed to load agents from MongoDB: %v", err)
+	}
+	if cfg.Workflows != "" {
+		if err := agents.SetWorkflowsJSON(cfg.Workflows); err != nil {
+			log.Fatalf("Failed to load WORKFLOWS: %v", err)
+		}
+	} else {
+		// Keep the pipeline that used to be built in; WORKFLOWS={} turns it off
+		seeded, err := agents.SeedWorkflow("default", services.LegacyWorkflow())
+		if err != nil {
+			log.Fatalf("Failed to set the default workflow: %v", err)
+		}
+		if seeded {
+			log.Println("WORKFLOWS not set, the default agent uses the DataReader → Analyzer → Auditor → Reporter workflow")
+		}
+	}
+	log.Printf("Agent registry loaded with %d agents (default: %s)", len(agents.List()), agents.DefaultKey())
+
+	extractService := services.NewExtractionService().WithDocxOptions(services.DocxOptions{
+		Footnotes: cfg.DocxFootnotes,
+		Comments:  cfg.DocxComments,
+	}).WithSpreadsheetOptions(services.SpreadsheetOptions{
+		MaxRows:    cfg.SpreadsheetRows,
+		MaxColumns: cfg.SpreadsheetColumns,
+		Sample:     cfg.SpreadsheetSample,
+	}).WithStructuredLimit(cfg.StructuredMaxChars)
+
+	// Upload formats: the built-in extractors, then EXTERNAL_EXTRACTORS, then size limits and storage
+	extractors := services.NewExtractorRegistry(extractService)
+	if cfg.ExternalExtractors != "" {
+		if err := extractors.RegisterCommandsJSON(cfg.ExternalExtractors); err != nil {
+			log.Fatalf("Failed to load EXTERNAL_EXTRACTORS: %v", err)
+		}
+	}
+	if cfg.UploadMaxSizes != "" {
+		if err := extractors.SetMaxSizesJSON(cfg.UploadMaxSizes); err != nil {
+			log.Fatalf("Failed to load UPLOAD_MAX_SIZES_MB: %v", err)
+		}
+	}
+	if cfg.LambdaFunctionName != "" {
+		// Excel workbooks go to S3, where the agent reads them through the Lambda
+		for _, fileType := range []string{"xlsx", "xls"} {
+			if err := extractors.SetStorage(fileType, models.StorageS3); err != nil {
+				log.Fatalf("Failed to route %s uploads to S3: %v", fileType, err)
+			}
+		}
+	}
+	log.Printf("Extractor registry loaded with %d formats", len(extractors.Formats()))
+
+	// One agent invocation per session at a time, across all backend instances
+	if err := sessionLeaseRepo.EnsureIndexes(ctx); err != nil {
+		log.Printf("Warning: Failed to create session lease indexes: %v", err)
+	}
+	sessionLocks := services.NewSessionLockService(sessionLeaseRepo,
+		time.Duration(cfg.SessionLeaseTTL)*time.Second, time.Duration(cfg.SessionQueueWait)*time.Second)
+
+	// Background workers for detached chat jobs
+	invocations := services.NewInvocationRegistry()
+	jobService := services.NewJobService(jobRepo, agents, sessionService, invocations, sessionLocks, cfg.ChatJobWorkers)
+	jobService.Start(context.Background())
 
 	// Initialize handlers
-	sessionHandler := handlers.NewSessionHandler(sessionService)
-	chatHandler := handlers.NewChatHandler(agentService, sessionService, summarizeService, documentRepo)
-	uploadHandler := handlers.NewUploadHandler(documentRepo, extractService)
+	sessionHandler := handlers.NewSessionHandler(sessionService, agents, sessionLocks)
+	chatHandler := handlers.NewChatHandler(agents, sessionService, summarizeService, documentRepo, invocations, services.NewStreamHub(5*time.Minute), jobService, confirmations, sessionLocks)
+	uploadHandler := handlers.NewUploadHandler(documentRepo, extractors)
+	agentHandler := handlers.NewAgentHandler(agents)
+	usageHandler := handlers.NewUsageHandler(services.NewUsageService(sessionRepo))
+
+	var traceHandler *handlers.TraceHandler
+	if traceArchive != nil {
+		traceHandler = handlers.NewTraceHandler(traceArchive)
+	}
+
+	var recordingHandler *handlers.RecordingHandler
+	if recordingStore != nil {
+		// Replays must not run actions, retry recorded errors, trip the breaker or archive traces
+		replayService := services.NewAgentServiceWithRuntime(nil, agentService.GetAWSConfig(), cfg.AgentID, cfg.AgentAliasID, cfg.AgentName).
+			WithPrices(prices).
+			WithRetry(services.RetryPolicy{})
+		recordingHandler = handlers.NewRecordingHandler(recordingStore, replayService)
+	}
 
 	// Initialize Excel handler (optional - only if Lambda is configured)
 	var excelHandler *handlers.ExcelHandler
 	if cfg.LambdaFunctionName != "" {
-		excelHandler = handlers.NewExcelHandler(agentService.GetAWSConfig(), cfg.LambdaFunctionName, documentRepo)
+		excelHandler = handlers.NewExcelHandler(agentService.GetAWSConfig(), cfg.LambdaFunctionName, documentRepo, extractors)
 		log.Printf("Excel upload enabled via Lambda: %s", cfg.LambdaFunctionName)
 	} else {
 		log.Println("Excel upload disabled (LAMBDA_FUNCTION_NAME not set)")
@@ -79,7 +255,7 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     origins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Last-Event-ID"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -98,19 +274,52 @@ func main() {
 		api.POST("/sessions", sessionHandler.CreateSession)
 		api.GET("/sessions/:id", sessionHandler.GetSession)
 		api.PUT("/sessions/:id", sessionHandler.UpdateSession)
+		api.PUT("/sessions/:id/attributes", sessionHandler.UpdateAttributes)
 		api.DELETE("/sessions/:id", sessionHandler.DeleteSession)
 		api.DELETE("/sessions/:id/messages", sessionHandler.ClearMessages)
 		api.GET("/sessions/:id/stats", sessionHandler.GetMessageStats)
+		api.GET("/sessions/:id/usage", usageHandler.GetSessionUsage)
+		api.POST("/sessions/:id/messages/:messageId/regenerate", chatHandler.RegenerateMessage)
+		api.POST("/sessions/:id/messages/:messageId/edit", chatHandler.EditMessage)
+		api.GET("/sessions/:id/branches", sessionHandler.GetBranches)
+		api.PUT("/sessions/:id/branches/:branchId", sessionHandler.SwitchBranch)
+
+		// Message routes
+		api.GET("/messages/:id/trace", sessionHandler.GetMessageTrace)
+
+		// Raw trace archive routes (only if archiving is enabled)
+		if traceHandler != nil {
+			api.GET("/traces/:traceId/raw", traceHandler.DownloadRawTrace)
+		}
+
+		// Agent routes
+		api.GET("/agents", agentHandler.GetAgents)
+
+		// Usage routes
+		api.GET("/usage", usageHandler.GetUsageReport)
 
 		// Chat routes
 		api.POST("/chat/stream", chatHandler.StreamChat)
+		api.POST("/chat/:sessionId/cancel", chatHandler.CancelChat)
+		api.GET("/chat/:sessionId/stream", chatHandler.ResumeStream)
+		api.POST("/chat/jobs", chatHandler.CreateJob)
+		api.GET("/chat/jobs/:id", chatHandler.GetJob)
+		api.POST("/chat/:sessionId/confirmations/:id", chatHandler.ResolveConfirmation)
 
 		// Document upload routes
 		api.POST("/upload", uploadHandler.UploadFile)
+		api.GET("/upload/formats", uploadHandler.GetFormats)
 		api.GET("/files/:id", uploadHandler.DownloadFile)
 		api.DELETE("/files/:id", uploadHandler.DeleteFile)
 		api.GET("/sessions/:id/documents", uploadHandler.GetSessionDocuments)
 
+		// Agent stream recording routes (only if recording is enabled)
+		if recordingHandler != nil {
+			api.GET("/recordings", recordingHandler.GetRecordings)
+			api.GET("/recordings/:id", recordingHandler.GetRecording)
+			api.POST("/recordings/:id/replay", recordingHandler.ReplayRecording)
+		}
+
 		// Excel upload routes (presigned S3 upload)
 		if excelHandler != nil {
 			api.POST("/excel/presign", excelHandler.GetPresignedURL)
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 )
 
 type Config struct {
@@ -11,9 +12,32 @@ type Config struct {
 	AgentID            string
 	AgentAliasID       string
 	AgentName          string // Display name for the main agent
+	Agents             string // Optional JSON list of additional agents for the agent registry
+	Workflows          string // Optional JSON object of agent key -> workflow definition
 	AWSRegion          string
 	AllowedOrigins     string
 	LambdaFunctionName string // MCP Gateway Lambda for Excel presigned URLs
+	AgentRuntime       string // "bedrock" (default), "fake" for offline development, or "replay"
+	RecordAgentStreams string // "" (off), "file" or "mongo" - record raw agent event streams
+	RecordingsDir      string // Directory for file recordings
+	ReplayRecording    string // Recording file played back when AgentRuntime is "replay"
+	ChatJobWorkers     int    // Number of background workers for detached chat jobs
+	ModelPrices        string // Optional JSON of model -> {"input", "output"} USD per million tokens
+	TraceArchiveDays   int    // Days raw traces are kept in the trace archive, 0 disables archiving
+	TraceArchiveMaxMB  int    // Size limit of the trace archive, the oldest traces are deleted first (0 = no limit)
+	BedrockMaxRetries  int    // Retries of throttled or failed Bedrock invocations before giving up
+	BreakerThreshold   int    // Consecutive Bedrock failures that open the circuit breaker, 0 disables it
+	BreakerCooldown    int    // Seconds the circuit breaker fails invocations fast before trying again
+	SessionLeaseTTL    int    // Seconds a session lease outlives a crashed holder
+	SessionQueueWait   int    // Seconds a queued chat request waits for the session's running invocation
+	DocxFootnotes      bool   // Include footnotes and endnotes in the text extracted from DOCX files
+	DocxComments       bool   // Include reviewer comments in the text extracted from DOCX files
+	SpreadsheetRows    int    // Data rows per sheet in the text extracted from XLSX/CSV/TSV files
+	SpreadsheetColumns int    // Columns per sheet in the text extracted from XLSX/CSV/TSV files
+	SpreadsheetSample  bool   // Sample rows from the whole sheet instead of keeping the first ones
+	StructuredMaxChars int    // Characters kept of pretty-printed JSON/YAML/XML and source files
+	ExternalExtractors string // Optional JSON array of extractors that run a command
+	UploadMaxSizes     string // Optional JSON object of file type -> upload size limit in MB
 }
 
 func Load() *Config {
@@ -24,9 +48,32 @@ func Load() *Config {
 		AgentID:            getEnv("AGENT_ID", ""),
 		AgentAliasID:       getEnv("AGENT_ALIAS", ""),
 		AgentName:          getEnv("AGENT_NAME", "Main Agent"),
+		Agents:             getEnv("AGENTS", ""),
+		Workflows:          getEnv("WORKFLOWS", ""),
 		AWSRegion:          getEnv("AWS_REGION", "us-east-1"),
 		AllowedOrigins:     getEnv("ALLOWED_ORIGINS", "http://localhost:3000"),
 		LambdaFunctionName: getEnv("LAMBDA_FUNCTION_NAME", ""), // Optional: for Excel file uploads
+		AgentRuntime:       getEnv("AGENT_RUNTIME", "bedrock"),
+		RecordAgentStreams: getEnv("RECORD_AGENT_STREAMS", ""),
+		RecordingsDir:      getEnv("RECORDINGS_DIR", "recordings"),
+		ReplayRecording:    getEnv("REPLAY_RECORDING", ""),
+		ChatJobWorkers:     getEnvInt("CHAT_JOB_WORKERS", 4),
+		ModelPrices:        getEnv("MODEL_PRICES", ""),
+		TraceArchiveDays:   getEnvInt("TRACE_ARCHIVE_DAYS", 14),
+		TraceArchiveMaxMB:  getEnvInt("TRACE_ARCHIVE_MAX_MB", 1024),
+		BedrockMaxRetries:  getEnvInt("BEDROCK_MAX_RETRIES", 3),
+		BreakerThreshold:   getEnvInt("CIRCUIT_BREAKER_THRESHOLD", 5),
+		BreakerCooldown:    getEnvInt("CIRCUIT_BREAKER_COOLDOWN_SECONDS", 30),
+		SessionLeaseTTL:    getEnvInt("SESSION_LEASE_TTL_SECONDS", 60),
+		SessionQueueWait:   getEnvInt("SESSION_QUEUE_WAIT_SECONDS", 300),
+		DocxFootnotes:      getEnvBool("DOCX_INCLUDE_FOOTNOTES", true),
+		DocxComments:       getEnvBool("DOCX_INCLUDE_COMMENTS", false),
+		SpreadsheetRows:    getEnvInt("SPREADSHEET_MAX_ROWS", 200),
+		SpreadsheetColumns: getEnvInt("SPREADSHEET_MAX_COLUMNS", 30),
+		SpreadsheetSample:  getEnvBool("SPREADSHEET_SAMPLE_ROWS", false),
+		StructuredMaxChars: getEnvInt("STRUCTURED_MAX_CHARS", 100000),
+		ExternalExtractors: getEnv("EXTERNAL_EXTRACTORS", ""),
+		UploadMaxSizes:     getEnv("UPLOAD_MAX_SIZES_MB", ""),
 	}
 }
 
@@ -36,3 +83,21 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ui-agentbedrock/backend/internal/services"
+)
+
+type AgentHandler struct {
+	agents *services.AgentRegistry
+}
+
+func NewAgentHandler(agents *services.AgentRegistry) *AgentHandler {
+	return &AgentHandler{agents: agents}
+}
+
+// GetAgents lists the agents a session can be created with
+func (h *AgentHandler) GetAgents(c *gin.Context) {
+	c.JSON(http.StatusOK, h.agents.List())
+}
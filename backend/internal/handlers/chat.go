@@ -1,7 +1,8 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -26,18 +27,28 @@ const (
 )
 
 type ChatHandler struct {
-	agentService     *services.AgentService
+	agents           *services.AgentRegistry
 	sessionService   *services.SessionService
 	summarizeService *services.SummarizeService
 	documentRepo     *repository.DocumentRepository
+	invocations      *services.InvocationRegistry
+	streams          *services.StreamHub
+	jobService       *services.JobService
+	confirmations    *services.ConfirmationRegistry
+	locks            *services.SessionLockService
 }
 
-func NewChatHandler(agentService *services.AgentService, sessionService *services.SessionService, summarizeService *services.SummarizeService, documentRepo *repository.DocumentRepository) *ChatHandler {
+func NewChatHandler(agents *services.AgentRegistry, sessionService *services.SessionService, summarizeService *services.SummarizeService, documentRepo *repository.DocumentRepository, invocations *services.InvocationRegistry, streams *services.StreamHub, jobService *services.JobService, confirmations *services.ConfirmationRegistry, locks *services.SessionLockService) *ChatHandler {
 	return &ChatHandler{
-		agentService:     agentService,
+		agents:           agents,
 		sessionService:   sessionService,
 		summarizeService: summarizeService,
 		documentRepo:     documentRepo,
+		invocations:      invocations,
+		streams:          streams,
+		jobService:       jobService,
+		confirmations:    confirmations,
+		locks:            locks,
 	}
 }
 
@@ -48,12 +59,125 @@ func (h *ChatHandler) StreamChat(c *gin.Context) {
 		return
 	}
 
-	ctx := c.Request.Context()
+	// Held until the invocation ends, also across summarization
+	lock, ok := h.lockSession(c, req.SessionID)
+	if !ok {
+		return
+	}
+
+	chat, err := h.prepareChat(c.Request.Context(), req)
+	if err != nil {
+		lock.Release()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save message"})
+		return
+	}
+
+	flusher, ok := startSSE(c)
+	if !ok {
+		lock.Release()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming not supported"})
+		return
+	}
+
+	// Buffer every event so a dropped connection can resume via ResumeStream
+	stream := h.streams.Open(req.SessionID)
+
+	// Notify client if summarization happened
+	if chat.summarized {
+		stream.Publish(models.SSEEvent{
+			Event: "summarized",
+			Data: map[string]interface{}{
+				"message":        "Conversation history was automatically summarized to reduce context length",
+				"newSessionId":   chat.agentSessionID,
+				"sessionRotated": true,
+			},
+		})
+	}
+
+	// Register the invocation so it can be stopped via the cancel endpoint.
+	// The run is detached from the request so a disconnect doesn't abort it.
+	invokeCtx, invocation := h.invocations.Start(context.Background(), req.SessionID)
+	go h.runInvocation(invokeCtx, invocation, stream, chatRun{
+		sessionID:      req.SessionID,
+		branchID:       chat.branchID,
+		lock:           lock,
+		agent:          h.agents.Get(chat.agentKey),
+		attributes:     chat.attributes,
+		agentSessionID: chat.agentSessionID,
+		message:        chat.messageToSend,
+	})
+
+	h.followStream(c, flusher, stream, 0)
+}
+
+// CreateJob starts a detached agent run for long workflows; poll GetJob for progress
+func (h *ChatHandler) CreateJob(c *gin.Context) {
+	var req models.ChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
+	// The job itself waits for the lease when a worker picks it up
+	lock, ok := h.lockSession(c, req.SessionID)
+	if !ok {
+		return
+	}
+	defer lock.Release()
+
+	chat, err := h.prepareChat(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save message"})
+		return
+	}
+
+	job, err := h.jobService.Enqueue(c.Request.Context(), req.SessionID, chat.branchID, chat.agentKey, chat.agentSessionID, chat.messageToSend, chat.attributes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create job"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.CreateJobResponse{
+		JobID:  job.ID.Hex(),
+		Status: job.Status,
+	})
+}
+
+// GetJob returns the status, steps and partial output of a job
+func (h *ChatHandler) GetJob(c *gin.Context) {
+	job, err := h.jobService.GetJob(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// preparedChat is a saved user message ready to be sent to the agent
+type preparedChat struct {
+	branchID       string                 // Branch active when the request started, the reply goes there too
+	agentKey       string                 // Registry key of the session's agent
+	attributes     models.AgentAttributes // Session attributes merged with the request's
+	agentSessionID string
+	messageToSend  string
+	summarized     bool
+}
+
+// prepareChat auto-summarizes long conversations, saves the user message and
+// builds the agent input with document and summary context
+func (h *ChatHandler) prepareChat(ctx context.Context, req models.ChatRequest) (*preparedChat, error) {
 	// Get existing messages to check token count
-	_, messages, err := h.sessionService.GetSession(ctx, req.SessionID)
+	agentKey := ""
+	branchID := ""
+	attributes := req.AgentAttributes
+	session, messages, err := h.sessionService.GetSession(ctx, req.SessionID)
 	if err != nil {
 		log.Printf("Warning: Could not get session messages: %v", err)
+	} else {
+		agentKey = session.AgentKey
+		branchID = session.ActiveBranchID
+		attributes = session.AgentAttributes.Merge(req.AgentAttributes)
 	}
 
 	// Get the AgentBedrock session ID (separate from MongoDB session ID)
@@ -78,21 +202,27 @@ func (h *ChatHandler) StreamChat(c *gin.Context) {
 		if err != nil {
 			log.Printf("Warning: Failed to summarize: %v", err)
 		} else {
-			// Save summary and clear old messages in MongoDB
-			_, err = h.sessionService.SummarizeAndClearOld(ctx, req.SessionID, summary, int64(KeepRecentMessages))
-			if err != nil {
-				log.Printf("Warning: Failed to save summary: %v", err)
-			} else {
-				// CRITICAL: Rotate AgentBedrock session to reset its internal history
-				newAgentSessionID, err := h.sessionService.RotateAgentSession(ctx, req.SessionID, summary)
+			h.saveSummaryUsage(ctx, req.SessionID, summary)
+
+			// Save summary, clear old messages and rotate the AgentBedrock session
+			newAgentSessionID, err := h.sessionService.SummarizeAndRotate(ctx, req.SessionID, branchID, agentSessionID, summary.Text, int64(KeepRecentMessages))
+			switch {
+			case errors.Is(err, repository.ErrSessionRotated):
+				// Another request summarized first, continue on its agent session
+				log.Printf("Warning: Conversation was already summarized, using the current agent session")
+				if current, currentSummary, err := h.sessionService.GetAgentSessionID(ctx, req.SessionID); err == nil {
+					agentSessionID, summaryContext = current, currentSummary
+				}
+			case newAgentSessionID == "":
+				log.Printf("Warning: Failed to rotate agent session: %v", err)
+			default:
 				if err != nil {
-					log.Printf("Warning: Failed to rotate agent session: %v", err)
-				} else {
-					agentSessionID = newAgentSessionID
-					summaryContext = summary
-					summarized = true
-					log.Printf("Conversation summarized and agent session rotated: %s", agentSessionID)
+					log.Printf("Warning: Failed to replace old messages with the summary: %v", err)
 				}
+				agentSessionID = newAgentSessionID
+				summaryContext = summary.Text
+				summarized = true
+				log.Printf("Conversation summarized and agent session rotated: %s", agentSessionID)
 			}
 		}
 	}
@@ -107,18 +237,29 @@ func (h *ChatHandler) StreamChat(c *gin.Context) {
 	}
 
 	// Save user message with document IDs
-	_, err = h.sessionService.SaveMessageWithDocuments(ctx, req.SessionID, "user", req.Message, docObjectIDs, nil)
+	_, err = h.sessionService.SaveMessageWithDocuments(ctx, req.SessionID, branchID, "user", req.Message, docObjectIDs, nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save message"})
-		return
+		return nil, err
 	}
 
+	return &preparedChat{
+		branchID:       branchID,
+		agentKey:       agentKey,
+		attributes:     attributes,
+		agentSessionID: agentSessionID,
+		messageToSend:  h.buildAgentInput(ctx, req.SessionID, req.Message, req.DocumentIDs, summaryContext),
+		summarized:     summarized,
+	}, nil
+}
+
+// buildAgentInput prepends document, Excel and summary context to the user message
+func (h *ChatHandler) buildAgentInput(ctx context.Context, sessionID, message string, documentIDs []string, summaryContext string) string {
 	// Get document content if document IDs are provided
 	documentContext := ""
 	excelContext := ""
-	if len(req.DocumentIDs) > 0 {
-		docIDs := make([]primitive.ObjectID, 0, len(req.DocumentIDs))
-		for _, docIDStr := range req.DocumentIDs {
+	if len(documentIDs) > 0 {
+		docIDs := make([]primitive.ObjectID, 0, len(documentIDs))
+		for _, docIDStr := range documentIDs {
 			docID, err := primitive.ObjectIDFromHex(docIDStr)
 			if err != nil {
 				log.Printf("Warning: Invalid document ID: %s", docIDStr)
@@ -156,7 +297,7 @@ func (h *ChatHandler) StreamChat(c *gin.Context) {
 	}
 
 	// Prepare the message to send to AgentBedrock
-	messageToSend := req.Message
+	messageToSend := message
 
 	// Add Excel file context (agent will read from S3)
 	if excelContext != "" {
@@ -171,68 +312,77 @@ func (h *ChatHandler) StreamChat(c *gin.Context) {
 		// Prepend summary context for the new AgentBedrock session
 		// Keep sending summary context until we have enough new messages to replace it
 		// Only clear summary context when we have accumulated enough new conversation (e.g., 10+ messages)
-		messageCount, _ := h.sessionService.GetMessageCount(ctx, req.SessionID)
-		messageToSend = fmt.Sprintf("[Previous Conversation Context]\n%s\n\n[Current Message]\n%s", summaryContext, req.Message)
+		messageCount, _ := h.sessionService.GetMessageCount(ctx, sessionID)
+		messageToSend = fmt.Sprintf("[Previous Conversation Context]\n%s\n\n[Current Message]\n%s", summaryContext, message)
 
 		// Only clear summary context after accumulating enough new messages (10+ messages after summarization)
 		// This ensures AI maintains context from the summary
 		if messageCount >= 10 {
-			h.sessionService.ClearSummaryContext(ctx, req.SessionID)
+			h.sessionService.ClearSummaryContext(ctx, sessionID)
 			log.Printf("Cleared summary context after accumulating %d messages", messageCount)
 		} else {
 			log.Printf("Applied summary context to agent session (message count: %d)", messageCount)
 		}
 	}
 
-	// Set SSE headers
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("Transfer-Encoding", "chunked")
-	c.Header("X-Accel-Buffering", "no")
+	return messageToSend
+}
 
-	// Create a channel for client disconnect detection
-	clientGone := c.Request.Context().Done()
-	flusher, ok := c.Writer.(http.Flusher)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming not supported"})
-		return
-	}
+// chatRun is one agent invocation started from a chat request
+type chatRun struct {
+	sessionID      string
+	branchID       string                 // Branch the reply is saved in
+	agent          *services.AgentService // Agent the session is routed to
+	attributes     models.AgentAttributes
+	agentSessionID string
+	message        string                // Full agent input
+	regenerateID   string                // Assistant message that gets a new version instead of a new message
+	lock           *services.SessionLock // Session lease, released when the invocation ends
+}
 
-	// Stream callback
-	callback := func(event models.SSEEvent) error {
-		select {
-		case <-clientGone:
-			return fmt.Errorf("client disconnected")
-		default:
-			data, _ := json.Marshal(event.Data)
-			_, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Event, string(data))
-			if err != nil {
-				return err
-			}
-			flusher.Flush()
-			return nil
-		}
-	}
+// runInvocation invokes the agent, saves the assistant message and publishes
+// every event to stream
+func (h *ChatHandler) runInvocation(ctx context.Context, invocation *services.Invocation, stream *services.EventStream, run chatRun) {
+	defer run.lock.Release()
+	defer h.streams.Finish(run.sessionID, stream)
+	defer h.invocations.Finish(run.sessionID, invocation)
 
-	// Notify client if summarization happened
-	if summarized {
-		summarizeData, _ := json.Marshal(map[string]interface{}{
-			"message":        "Conversation history was automatically summarized to reduce context length",
-			"newSessionId":   agentSessionID,
-			"sessionRotated": true,
-		})
-		fmt.Fprintf(c.Writer, "event: summarized\ndata: %s\n\n", string(summarizeData))
-		flusher.Flush()
+	citations := &services.CitationCollector{}
+	callback := func(event models.SSEEvent) error {
+		citations.Observe(event)
+		stream.Publish(event)
+		return nil
 	}
 
 	// Invoke agent with streaming - use AgentBedrock session ID, not MongoDB ID
-	trace, content, err := h.agentService.InvokeAgentStream(c.Request.Context(), agentSessionID, messageToSend, callback)
+	trace, content, err := run.agent.InvokeAgentStreamWithAttributes(ctx, run.agentSessionID, run.message, run.attributes, callback)
+
+	// The invocation context is done at this point, save with a fresh one
+	saveCtx := context.Background()
+
+	// Stopped by the user - persist the partial answer as cancelled
+	if invocation.Cancelled() {
+		messageID := ""
+		assistantMessage, saveErr := h.saveAssistantMessage(saveCtx, run, content, trace, citations.Citations(), "cancelled")
+		if saveErr != nil {
+			log.Printf("Warning: Failed to save cancelled message: %v", saveErr)
+		} else if assistantMessage != nil {
+			messageID = assistantMessage.ID.Hex()
+		}
+
+		stream.Publish(models.SSEEvent{Event: "cancelled", Data: models.CancelledEvent{MessageID: messageID, Cancelled: true}})
+		stream.Publish(models.SSEEvent{Event: "done", Data: models.DoneEvent{MessageID: messageID}})
+		return
+	}
 
-	// Save assistant message
+	// Save assistant message, marked interrupted if the stream broke off after part of it
 	var assistantMessage *models.Message
 	if content != "" {
-		assistantMessage, _ = h.sessionService.SaveMessage(c.Request.Context(), req.SessionID, "assistant", content, trace)
+		status := ""
+		if err != nil {
+			status = "interrupted"
+		}
+		assistantMessage, _ = h.saveAssistantMessage(saveCtx, run, content, trace, citations.Citations(), status)
 	}
 
 	// Send done event
@@ -241,12 +391,316 @@ func (h *ChatHandler) StreamChat(c *gin.Context) {
 		messageID = assistantMessage.ID.Hex()
 	}
 
-	doneData, _ := json.Marshal(models.DoneEvent{MessageID: messageID})
-	fmt.Fprintf(c.Writer, "event: done\ndata: %s\n\n", string(doneData))
-	flusher.Flush()
+	stream.Publish(models.SSEEvent{Event: "done", Data: models.DoneEvent{MessageID: messageID}})
 
 	if err != nil && err != io.EOF {
 		// Error already sent via callback
+		log.Printf("Agent invocation failed for session %s: %v", run.sessionID, err)
+	}
+}
+
+// saveAssistantMessage stores the agent's answer as a new message, or as a new
+// version of the regenerated message
+func (h *ChatHandler) saveAssistantMessage(ctx context.Context, run chatRun, content string, trace *models.Trace, citations []models.Citation, status string) (*models.Message, error) {
+	var message *models.Message
+	var err error
+	switch {
+	case run.regenerateID != "":
+		// Keep the previous answer if the new run produced nothing
+		if content == "" {
+			return nil, nil
+		}
+		message, err = h.sessionService.AddMessageVersion(ctx, run.regenerateID, content, trace, status)
+	case status != "":
+		message, err = h.sessionService.SaveMessageWithStatus(ctx, run.sessionID, run.branchID, "assistant", content, trace, status)
+	default:
+		message, err = h.sessionService.SaveMessage(ctx, run.sessionID, run.branchID, "assistant", content, trace)
+	}
+	if err != nil || len(citations) == 0 {
+		return message, err
+	}
+
+	if err := h.sessionService.UpdateMessageCitations(ctx, message.ID.Hex(), citations); err != nil {
+		log.Printf("Warning: Failed to save citations: %v", err)
+	} else {
+		message.Citations = citations
+	}
+	return message, nil
+}
+
+// RegenerateMessage re-invokes the agent with the user message that produced an
+// assistant reply. The previous reply is kept in the message's alternates. The
+// turn runs in a new AgentBedrock session seeded with a summary of the messages
+// before it, so the agent doesn't remember the reply it replaces.
+func (h *ChatHandler) RegenerateMessage(c *gin.Context) {
+	sessionID := c.Param("id")
+	messageID := c.Param("messageId")
+	ctx := c.Request.Context()
+
+	lock, ok := h.lockSession(c, sessionID)
+	if !ok {
 		return
 	}
+
+	assistantMessage, userMessage, prior, err := h.sessionService.GetRegenerateSource(ctx, sessionID, messageID)
+	if err != nil {
+		lock.Release()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currentAgentSessionID, _, err := h.sessionService.GetAgentSessionID(ctx, sessionID)
+	if err != nil {
+		log.Printf("Warning: Could not get agent session ID: %v", err)
+		currentAgentSessionID = sessionID // Fallback to MongoDB ID
+	}
+
+	summaryContext := h.summarizePrior(ctx, sessionID, prior)
+	agentSessionID, err := h.sessionService.ForkAgentSession(ctx, sessionID, currentAgentSessionID, summaryContext)
+	if err != nil {
+		lock.Release()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start a new agent session"})
+		return
+	}
+
+	agentKey, attributes, err := h.sessionService.GetAgentSettings(ctx, sessionID)
+	if err != nil {
+		log.Printf("Warning: Could not get session agent: %v", err)
+	}
+
+	documentIDs := make([]string, 0, len(userMessage.Documents))
+	for _, docID := range userMessage.Documents {
+		documentIDs = append(documentIDs, docID.Hex())
+	}
+
+	flusher, ok := startSSE(c)
+	if !ok {
+		lock.Release()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming not supported"})
+		return
+	}
+
+	stream := h.streams.Open(sessionID)
+	invokeCtx, invocation := h.invocations.Start(context.Background(), sessionID)
+	go h.runInvocation(invokeCtx, invocation, stream, chatRun{
+		sessionID:      sessionID,
+		branchID:       assistantMessage.BranchID,
+		lock:           lock,
+		agent:          h.agents.Get(agentKey),
+		attributes:     attributes,
+		agentSessionID: agentSessionID,
+		message:        h.buildAgentInput(ctx, sessionID, userMessage.Content, documentIDs, summaryContext),
+		regenerateID:   assistantMessage.ID.Hex(),
+	})
+
+	h.followStream(c, flusher, stream, 0)
+}
+
+// EditMessage replaces an earlier user message in a new conversation branch and
+// re-invokes the agent. The original thread stays available as the parent branch.
+func (h *ChatHandler) EditMessage(c *gin.Context) {
+	sessionID := c.Param("id")
+	messageID := c.Param("messageId")
+	ctx := c.Request.Context()
+
+	var req models.EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lock, ok := h.lockSession(c, sessionID)
+	if !ok {
+		return
+	}
+
+	session, edited, prior, err := h.sessionService.GetEditSource(ctx, sessionID, messageID)
+	if err != nil {
+		lock.Release()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Seed the branch's new AgentBedrock session with the conversation so far
+	summary := h.summarizePrior(ctx, sessionID, prior)
+
+	branch, err := h.sessionService.CreateBranch(ctx, session, edited, prior, summary)
+	if err != nil {
+		lock.Release()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create branch"})
+		return
+	}
+
+	documentIDs := req.DocumentIDs
+	if documentIDs == nil {
+		documentIDs = make([]string, 0, len(edited.Documents))
+		for _, docID := range edited.Documents {
+			documentIDs = append(documentIDs, docID.Hex())
+		}
+	}
+
+	chat, err := h.prepareChat(ctx, models.ChatRequest{
+		SessionID:   sessionID,
+		Message:     req.Message,
+		DocumentIDs: documentIDs,
+	})
+	if err != nil {
+		lock.Release()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save message"})
+		return
+	}
+
+	flusher, ok := startSSE(c)
+	if !ok {
+		lock.Release()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming not supported"})
+		return
+	}
+
+	stream := h.streams.Open(sessionID)
+	stream.Publish(models.SSEEvent{Event: "branch_created", Data: branch})
+
+	invokeCtx, invocation := h.invocations.Start(context.Background(), sessionID)
+	go h.runInvocation(invokeCtx, invocation, stream, chatRun{
+		sessionID:      sessionID,
+		branchID:       chat.branchID,
+		lock:           lock,
+		agent:          h.agents.Get(chat.agentKey),
+		attributes:     chat.attributes,
+		agentSessionID: chat.agentSessionID,
+		message:        chat.messageToSend,
+	})
+
+	h.followStream(c, flusher, stream, 0)
+}
+
+// lockSession takes the session's lease for an agent invocation. Another running
+// invocation makes it answer 409, unless the request opts into waiting with ?queue=true.
+// It writes the error response and returns false if the lease wasn't taken.
+func (h *ChatHandler) lockSession(c *gin.Context, sessionID string) (*services.SessionLock, bool) {
+	var lock *services.SessionLock
+	var err error
+	if c.Query("queue") == "true" {
+		lock, err = h.locks.Wait(c.Request.Context(), sessionID)
+	} else {
+		lock, err = h.locks.Acquire(c.Request.Context(), sessionID)
+	}
+
+	switch {
+	case err == nil:
+		return lock, true
+	case errors.Is(err, services.ErrSessionBusy):
+		c.JSON(http.StatusConflict, gin.H{"error": "An agent invocation is already running for this session"})
+	case errors.Is(err, primitive.ErrInvalidHex):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+	case c.Request.Context().Err() != nil:
+		// The client left while queued
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock session"})
+	}
+	return nil, false
+}
+
+// followStream writes the events after seq to the client until the stream
+// completes or the client disconnects
+func (h *ChatHandler) followStream(c *gin.Context, flusher http.Flusher, stream *services.EventStream, seq int64) {
+	clientGone := c.Request.Context().Done()
+
+	for {
+		events, closed, changed := stream.Since(seq)
+		for _, event := range events {
+			if err := writeSSEWithID(c, flusher, event.ID, event.Event, event.Data); err != nil {
+				return
+			}
+			seq = event.Seq
+		}
+
+		if closed {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-clientGone:
+			return
+		}
+	}
+}
+
+// ResumeStream reconnects to the session's running (or just finished) stream.
+// Events after the Last-Event-ID header (or lastEventId query) are replayed,
+// then live events follow.
+func (h *ChatHandler) ResumeStream(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	stream, ok := h.streams.Get(sessionID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No stream for this session"})
+		return
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+
+	flusher, ok := startSSE(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming not supported"})
+		return
+	}
+
+	h.followStream(c, flusher, stream, stream.SeqFromEventID(lastEventID))
+}
+
+// CancelChat stops the running agent invocation of a session
+func (h *ChatHandler) CancelChat(c *gin.Context) {
+	sessionID := c.Param("sessionId")
+
+	if !h.invocations.Cancel(sessionID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No running invocation for this session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ResolveConfirmation approves or denies an agent action waiting for the user.
+// The running invocation sends the decision back to the agent.
+func (h *ChatHandler) ResolveConfirmation(c *gin.Context) {
+	var req models.ConfirmationDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.confirmations.Resolve(c.Param("sessionId"), c.Param("id"), *req.Approved) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending confirmation with this ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// summarizePrior summarizes the messages a new AgentBedrock session starts from.
+// Without messages, or if summarizing fails, the session starts without context.
+func (h *ChatHandler) summarizePrior(ctx context.Context, sessionID string, prior []models.Message) string {
+	if len(prior) == 0 {
+		return ""
+	}
+
+	summary, err := h.summarizeService.SummarizeConversation(ctx, prior)
+	if err != nil {
+		log.Printf("Warning: Failed to summarize messages for a new agent session: %v", err)
+		return ""
+	}
+	h.saveSummaryUsage(ctx, sessionID, summary)
+	return summary.Text
+}
+
+// saveSummaryUsage counts the tokens of a summarization in the session's usage
+func (h *ChatHandler) saveSummaryUsage(ctx context.Context, sessionID string, summary *services.Summary) {
+	if err := h.sessionService.SaveSummaryUsage(ctx, sessionID, summary.Model, summary.Usage); err != nil {
+		log.Printf("Warning: Failed to save summarization usage: %v", err)
+	}
 }
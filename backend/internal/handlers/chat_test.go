@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/gin-gonic/gin"
+	"github.com/ui-agentbedrock/backend/internal/models"
+	"github.com/ui-agentbedrock/backend/internal/repository"
+	"github.com/ui-agentbedrock/backend/internal/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testDatabase returns a fresh database on the MongoDB at MONGODB_TEST_URI,
+// dropped after the test. Without it the test is skipped.
+func testDatabase(t *testing.T) *mongo.Database {
+	t.Helper()
+
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	db := client.Database("chat_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	return db
+}
+
+// newTestChatHandler wires a ChatHandler to the fake agent runtime and the fake
+// summarizer. Every agent invocation input is sent to inputs.
+func newTestChatHandler(t *testing.T, db *mongo.Database, inputs chan<- *bedrockagentruntime.InvokeAgentInput, reply string) (*ChatHandler, *services.SessionService) {
+	t.Helper()
+
+	script := func(input *bedrockagentruntime.InvokeAgentInput) []types.ResponseStream {
+		inputs <- input
+		return []types.ResponseStream{services.FakeChunk(reply)}
+	}
+	agent := services.NewAgentServiceWithRuntime(services.NewFakeRuntime(script, 0), aws.Config{}, "AGENT", "ALIAS", "")
+
+	sessionService := services.NewSessionService(repository.NewSessionRepository(db))
+	handler := NewChatHandler(
+		services.NewAgentRegistry(agent),
+		sessionService,
+		services.NewSummarizeServiceWithModel(services.NewFakeModel()),
+		repository.NewDocumentRepository(db),
+		services.NewInvocationRegistry(),
+		services.NewStreamHub(time.Minute),
+		nil,
+		services.NewConfirmationRegistry(time.Minute),
+		services.NewSessionLockService(repository.NewSessionLeaseRepository(db), time.Minute, 0),
+	)
+	return handler, sessionService
+}
+
+// streamChat posts a message to StreamChat and returns the SSE response
+func streamChat(t *testing.T, handler *ChatHandler, sessionID, message string) string {
+	t.Helper()
+
+	router := gin.New()
+	router.POST("/api/chat/stream", handler.StreamChat)
+
+	body := `{"sessionId":"` + sessionID + `","message":"` + message + `"}`
+	request := httptest.NewRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("StreamChat status = %d: %s", recorder.Code, recorder.Body.String())
+	}
+	return recorder.Body.String()
+}
+
+func TestStreamChat(t *testing.T) {
+	db := testDatabase(t)
+	inputs := make(chan *bedrockagentruntime.InvokeAgentInput, 1)
+	handler, sessionService := newTestChatHandler(t, db, inputs, "Hello from the agent")
+	ctx := context.Background()
+
+	session, err := sessionService.CreateSession(ctx, "Test", "", models.AgentAttributes{})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	sessionID := session.ID.Hex()
+	agentSessionID, _, _ := sessionService.GetAgentSessionID(ctx, sessionID)
+
+	events := streamChat(t, handler, sessionID, "Hi")
+
+	input := <-inputs
+	if aws.ToString(input.InputText) != "Hi" {
+		t.Errorf("agent input = %q, want the user message", aws.ToString(input.InputText))
+	}
+	if aws.ToString(input.SessionId) != agentSessionID {
+		t.Errorf("agent session = %q, want %q", aws.ToString(input.SessionId), agentSessionID)
+	}
+	for _, event := range []string{"event: content", "event: done"} {
+		if !strings.Contains(events, event) {
+			t.Errorf("no %q in the stream:\n%s", event, events)
+		}
+	}
+	if strings.Contains(events, "event: summarized") {
+		t.Error("a short conversation was summarized")
+	}
+
+	_, messages, err := sessionService.GetSession(ctx, sessionID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("%d messages saved, want the user message and the reply", len(messages))
+	}
+	if messages[0].Role != "user" || messages[0].Content != "Hi" {
+		t.Errorf("first message = %s %q, want the user message", messages[0].Role, messages[0].Content)
+	}
+	if messages[1].Role != "assistant" || messages[1].Content != "Hello from the agent" {
+		t.Errorf("second message = %s %q, want the agent reply", messages[1].Role, messages[1].Content)
+	}
+}
+
+func TestStreamChatSummarizesLongConversation(t *testing.T) {
+	db := testDatabase(t)
+	inputs := make(chan *bedrockagentruntime.InvokeAgentInput, 1)
+	handler, sessionService := newTestChatHandler(t, db, inputs, "Still with you")
+	ctx := context.Background()
+
+	session, err := sessionService.CreateSession(ctx, "Test", "", models.AgentAttributes{})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	sessionID := session.ID.Hex()
+	agentSessionID, _, _ := sessionService.GetAgentSessionID(ctx, sessionID)
+
+	// Well over MaxTokenEstimate, with more than KeepRecentMessages messages
+	long := strings.Repeat("x", MaxTokenEstimate)
+	for i := 0; i < KeepRecentMessages+2; i++ {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		if _, err := sessionService.SaveMessage(ctx, sessionID, "", role, long, nil); err != nil {
+			t.Fatalf("SaveMessage: %v", err)
+		}
+	}
+
+	events := streamChat(t, handler, sessionID, "Next")
+
+	if !strings.Contains(events, "event: summarized") {
+		t.Errorf("no summarized event in the stream:\n%.500s", events)
+	}
+
+	input := <-inputs
+	rotated := aws.ToString(input.SessionId)
+	if rotated == agentSessionID {
+		t.Errorf("agent session %q was not rotated", rotated)
+	}
+	text := aws.ToString(input.InputText)
+	if !strings.Contains(text, "[Previous Conversation Context]") || !strings.Contains(text, "Simulated summary") {
+		t.Errorf("agent input = %.200q, want the summary context", text)
+	}
+
+	current, _, err := sessionService.GetAgentSessionID(ctx, sessionID)
+	if err != nil || current != rotated {
+		t.Errorf("session's agent session = %q (%v), want %q", current, err, rotated)
+	}
+
+	_, messages, err := sessionService.GetSession(ctx, sessionID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	// The recent messages, the summary, the new message and the reply
+	if len(messages) != KeepRecentMessages+3 {
+		t.Errorf("%d visible messages, want %d", len(messages), KeepRecentMessages+3)
+	}
+	summaries := 0
+	for _, message := range messages {
+		if message.Role == "system" && strings.HasPrefix(message.Content, "[Conversation Summary]") {
+			summaries++
+		}
+	}
+	if summaries != 1 {
+		t.Errorf("%d summary messages, want 1", summaries)
+	}
+}
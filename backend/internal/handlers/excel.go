@@ -6,13 +6,13 @@ import (
 	"fmt"
 	"net/http"
 	"path/filepath"
-	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"github.com/gin-gonic/gin"
 	"github.com/ui-agentbedrock/backend/internal/models"
 	"github.com/ui-agentbedrock/backend/internal/repository"
+	"github.com/ui-agentbedrock/backend/internal/services"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -20,13 +20,15 @@ type ExcelHandler struct {
 	lambdaClient   *lambda.Client
 	lambdaFunction string
 	documentRepo   *repository.DocumentRepository
+	extractors     *services.ExtractorRegistry
 }
 
-func NewExcelHandler(cfg aws.Config, lambdaFunction string, documentRepo *repository.DocumentRepository) *ExcelHandler {
+func NewExcelHandler(cfg aws.Config, lambdaFunction string, documentRepo *repository.DocumentRepository, extractors *services.ExtractorRegistry) *ExcelHandler {
 	return &ExcelHandler{
 		lambdaClient:   lambda.NewFromConfig(cfg),
 		lambdaFunction: lambdaFunction,
 		documentRepo:   documentRepo,
+		extractors:     extractors,
 	}
 }
 
@@ -34,6 +36,7 @@ func NewExcelHandler(cfg aws.Config, lambdaFunction string, documentRepo *reposi
 type PresignedURLRequest struct {
 	SessionID string `json:"sessionId" binding:"required"`
 	Filename  string `json:"filename" binding:"required"`
+	FileSize  int64  `json:"fileSize"` // Optional, checked against the format's size limit
 }
 
 // PresignedURLResponse is the response with the presigned URL for S3 upload
@@ -97,20 +100,21 @@ func (h *ExcelHandler) GetPresignedURL(c *gin.Context) {
 		return
 	}
 
-	// Validate file extension
-	ext := strings.ToLower(filepath.Ext(req.Filename))
-	if ext != ".xlsx" && ext != ".xls" {
+	// Validate the format is routed to S3
+	format, ok := h.extractors.ForFilename(req.Filename)
+	if !ok || format.Storage != models.StorageS3 {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "only Excel files (.xlsx, .xls) can use presigned upload",
+			"error": fmt.Sprintf("%s files can't use presigned upload", filepath.Ext(req.Filename)),
 		})
 		return
 	}
-
-	// Determine content type
-	contentType := "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
-	if ext == ".xls" {
-		contentType = "application/vnd.ms-excel"
+	if req.FileSize > format.MaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("%s files are limited to %d bytes", format.Label, format.MaxSize),
+		})
+		return
 	}
+	contentType := h.extractors.ContentType(format.FileType)
 
 	// Call Lambda to generate presigned URL
 	lambdaPayload := LambdaRequest{
@@ -160,9 +164,9 @@ func (h *ExcelHandler) GetPresignedURL(c *gin.Context) {
 	doc := &models.Document{
 		SessionID:   sessionID,
 		Filename:    req.Filename,
-		FileType:    strings.TrimPrefix(ext, "."),
+		FileType:    format.FileType,
 		S3Key:       lambdaData.Data.FileKey,
-		StorageType: "s3",
+		StorageType: models.StorageS3,
 	}
 
 	if err := h.documentRepo.CreateDocument(c.Request.Context(), doc); err != nil {
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ui-agentbedrock/backend/internal/models"
+	"github.com/ui-agentbedrock/backend/internal/services"
+)
+
+type RecordingHandler struct {
+	store        services.RecordingStore
+	agentService *services.AgentService // Replay service, without retries, breaker, trace archive or action handlers
+}
+
+func NewRecordingHandler(store services.RecordingStore, agentService *services.AgentService) *RecordingHandler {
+	return &RecordingHandler{
+		store:        store,
+		agentService: agentService,
+	}
+}
+
+// GetRecordings lists recent recordings (without events)
+func (h *RecordingHandler) GetRecordings(c *gin.Context) {
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	recordings, err := h.store.ListRecordings(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, recordings)
+}
+
+// GetRecording returns a recording with its raw events
+func (h *RecordingHandler) GetRecording(c *gin.Context) {
+	recording, err := h.store.GetRecording(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "recording not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, recording)
+}
+
+// ReplayRecording streams a recording through the agent parser as SSE,
+// producing the same events the original invocation sent to the client.
+// Return-control follow-ups of the invocation are replayed after it.
+func (h *RecordingHandler) ReplayRecording(c *gin.Context) {
+	recording, err := h.store.GetRecording(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "recording not found"})
+		return
+	}
+
+	recordings := []*models.AgentRecording{recording}
+	if recording.TraceID != "" {
+		traced, err := h.store.ListTraceRecordings(c.Request.Context(), recording.TraceID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for i := range traced {
+			if traced[i].CreatedAt.After(recording.CreatedAt) {
+				recordings = append(recordings, &traced[i])
+			}
+		}
+	}
+
+	flusher, ok := startSSE(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming not supported"})
+		return
+	}
+
+	clientGone := c.Request.Context().Done()
+	callback := func(event models.SSEEvent) error {
+		select {
+		case <-clientGone:
+			return fmt.Errorf("client disconnected")
+		default:
+			return writeSSE(c, flusher, event.Event, event.Data)
+		}
+	}
+
+	realtime := c.Query("realtime") == "true"
+	replay := h.agentService.WithReplay(services.NewReplaySequenceRuntime(recordings, realtime))
+	replay.InvokeAgentStream(c.Request.Context(), recording.AgentSessionID, recording.InputText, callback)
+
+	writeSSE(c, flusher, "done", models.DoneEvent{})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -10,10 +11,16 @@ import (
 
 type SessionHandler struct {
 	sessionService *services.SessionService
+	agents         *services.AgentRegistry
+	locks          *services.SessionLockService
 }
 
-func NewSessionHandler(sessionService *services.SessionService) *SessionHandler {
-	return &SessionHandler{sessionService: sessionService}
+func NewSessionHandler(sessionService *services.SessionService, agents *services.AgentRegistry, locks *services.SessionLockService) *SessionHandler {
+	return &SessionHandler{
+		sessionService: sessionService,
+		agents:         agents,
+		locks:          locks,
+	}
 }
 
 func (h *SessionHandler) GetSessions(c *gin.Context) {
@@ -32,7 +39,15 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 		req.Title = "New Chat"
 	}
 
-	session, err := h.sessionService.CreateSession(c.Request.Context(), req.Title)
+	// Pin the session to its agent so a later default change doesn't move it
+	if req.AgentKey == "" {
+		req.AgentKey = h.agents.DefaultKey()
+	} else if !h.agents.Has(req.AgentKey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown agent"})
+		return
+	}
+
+	session, err := h.sessionService.CreateSession(c.Request.Context(), req.Title, req.AgentKey, req.AgentAttributes)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -73,6 +88,24 @@ func (h *SessionHandler) UpdateSession(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
+// UpdateAttributes replaces the session's persistent agent attributes
+func (h *SessionHandler) UpdateAttributes(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.UpdateAttributesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.sessionService.UpdateAttributes(c.Request.Context(), id, req.AgentAttributes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
 func (h *SessionHandler) DeleteSession(c *gin.Context) {
 	id := c.Param("id")
 
@@ -108,3 +141,65 @@ func (h *SessionHandler) GetMessageStats(c *gin.Context) {
 		"message_count": count,
 	})
 }
+
+// GetMessageTrace returns a message's trace with its steps nested by collaborator call
+func (h *SessionHandler) GetMessageTrace(c *gin.Context) {
+	id := c.Param("id")
+
+	message, err := h.sessionService.GetMessage(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if message.Trace == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message has no trace"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageTrace{
+		MessageID: message.ID.Hex(),
+		Trace:     message.Trace,
+		Tree:      message.Trace.StepTree(),
+	})
+}
+
+// GetBranches lists the conversation branches of a session
+func (h *SessionHandler) GetBranches(c *gin.Context) {
+	id := c.Param("id")
+
+	activeBranchID, branches, err := h.sessionService.GetBranches(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"activeBranchId": activeBranchID,
+		"branches":       branches,
+	})
+}
+
+// SwitchBranch makes another branch the active one. It takes the session's lease,
+// so it answers 409 while an agent invocation is running.
+func (h *SessionHandler) SwitchBranch(c *gin.Context) {
+	id := c.Param("id")
+	branchID := c.Param("branchId")
+
+	lock, err := h.locks.Acquire(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, services.ErrSessionBusy):
+		c.JSON(http.StatusConflict, gin.H{"error": "An agent invocation is running for this session"})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer lock.Release()
+
+	if err := h.sessionService.SwitchBranch(c.Request.Context(), id, branchID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "activeBranchId": branchID})
+}
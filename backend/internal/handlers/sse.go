@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startSSE sets the Server-Sent Events headers and returns the response flusher
+func startSSE(c *gin.Context) (http.Flusher, bool) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Transfer-Encoding", "chunked")
+	c.Header("X-Accel-Buffering", "no")
+
+	flusher, ok := c.Writer.(http.Flusher)
+	return flusher, ok
+}
+
+// writeSSE writes a single SSE event and flushes it to the client
+func writeSSE(c *gin.Context, flusher http.Flusher, event string, data interface{}) error {
+	payload, _ := json.Marshal(data)
+	if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, string(payload)); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
+
+// writeSSEWithID writes an SSE event with an id so clients can resume with Last-Event-ID
+func writeSSEWithID(c *gin.Context, flusher http.Flusher, id, event string, data interface{}) error {
+	payload, _ := json.Marshal(data)
+	if _, err := fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", id, event, string(payload)); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ui-agentbedrock/backend/internal/services"
+)
+
+type TraceHandler struct {
+	archive *services.TraceArchiveService
+}
+
+func NewTraceHandler(archive *services.TraceArchiveService) *TraceHandler {
+	return &TraceHandler{archive: archive}
+}
+
+// DownloadRawTrace serves the untruncated raw trace JSON of an invocation
+func (h *TraceHandler) DownloadRawTrace(c *gin.Context) {
+	traceID := c.Param("traceId")
+
+	archive, reader, err := h.archive.Open(c.Request.Context(), traceID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Raw trace not found"})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, archive.Size, "application/json", reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%s.json", archive.TraceID),
+	})
+}
@@ -1,11 +1,11 @@
 package handlers
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
 	"path/filepath"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ui-agentbedrock/backend/internal/models"
@@ -14,40 +14,26 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-const (
-	MaxFileSize      = 10 * 1024 * 1024 // 10MB per file
-	MaxTotalFileSize = 50 * 1024 * 1024 // 50MB total per message
-)
-
-var allowedMimeTypes = map[string]string{
-	"application/pdf": "pdf",
-	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": "docx",
-	"application/msword": "doc",
-	"text/plain":         "txt",
-	"text/markdown":      "md",
-	// Excel formats - handled differently (presigned S3 upload)
-	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": "xlsx",
-	"application/vnd.ms-excel": "xls",
-}
-
-// ExcelMimeTypes for files that should be uploaded to S3 instead of GridFS
-var ExcelMimeTypes = map[string]bool{
-	"xlsx": true,
-	"xls":  true,
-}
+// MaxTotalFileSize limits the documents attached to one message
+const MaxTotalFileSize = 50 * 1024 * 1024 // 50MB total per message
 
 type UploadHandler struct {
-	documentRepo   *repository.DocumentRepository
-	extractService *services.ExtractionService
+	documentRepo *repository.DocumentRepository
+	extractors   *services.ExtractorRegistry
 }
 
-func NewUploadHandler(documentRepo *repository.DocumentRepository, extractService *services.ExtractionService) *UploadHandler {
+func NewUploadHandler(documentRepo *repository.DocumentRepository, extractors *services.ExtractorRegistry) *UploadHandler {
 	return &UploadHandler{
-		documentRepo:   documentRepo,
-		extractService: extractService,
+		documentRepo: documentRepo,
+		extractors:   extractors,
 	}
 }
 
+// GetFormats lists the formats that can be uploaded, with their size limit and storage
+func (h *UploadHandler) GetFormats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.extractors.Formats())
+}
+
 // UploadFile handles file upload
 func (h *UploadHandler) UploadFile(c *gin.Context) {
 	// Get session ID from form
@@ -70,10 +56,10 @@ func (h *UploadHandler) UploadFile(c *gin.Context) {
 		return
 	}
 
-	// Validate file size
-	if file.Size > MaxFileSize {
+	// Validate file size against the largest limit before reading it
+	if file.Size > h.extractors.MaxSize() {
 		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
-			"error": fmt.Sprintf("file size exceeds maximum allowed size of %d bytes", MaxFileSize),
+			"error": fmt.Sprintf("file size exceeds maximum allowed size of %d bytes", h.extractors.MaxSize()),
 		})
 		return
 	}
@@ -88,39 +74,32 @@ func (h *UploadHandler) UploadFile(c *gin.Context) {
 
 	// Read file content for validation
 	fileContent := make([]byte, file.Size)
-	if _, err := src.Read(fileContent); err != nil {
+	if _, err := io.ReadFull(src, fileContent); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read file"})
 		return
 	}
 
-	// Detect MIME type
-	mimeType := http.DetectContentType(fileContent)
-	fileType, ok := allowedMimeTypes[mimeType]
+	// Detect file format
+	format, ok := h.extractors.Detect(file.Filename, file.Header.Get("Content-Type"), fileContent)
 	if !ok {
-		// Try to get from extension as fallback
-		ext := strings.ToLower(filepath.Ext(file.Filename))
-		switch ext {
-		case ".pdf":
-			fileType = "pdf"
-		case ".docx":
-			fileType = "docx"
-		case ".doc":
-			fileType = "doc"
-		case ".txt":
-			fileType = "txt"
-		case ".md":
-			fileType = "md"
-		case ".xlsx":
-			fileType = "xlsx"
-		case ".xls":
-			fileType = "xls"
-		default:
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": fmt.Sprintf("unsupported file type: %s. Allowed types: PDF, DOCX, DOC, TXT, MD, XLSX, XLS", mimeType),
-			})
-			return
-		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("unsupported file type: %s. See /api/upload/formats for the allowed types", filepath.Ext(file.Filename)),
+		})
+		return
 	}
+	if file.Size > format.MaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("%s files are limited to %d bytes", format.Label, format.MaxSize),
+		})
+		return
+	}
+	if format.Storage == models.StorageS3 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("%s files are uploaded to S3, use /api/excel/presign", format.Label),
+		})
+		return
+	}
+	fileType := format.FileType
 
 	// Create document model
 	doc := &models.Document{
@@ -131,41 +110,46 @@ func (h *UploadHandler) UploadFile(c *gin.Context) {
 	}
 
 	// Save document to GridFS
-	fileReader := strings.NewReader(string(fileContent))
+	fileReader := bytes.NewReader(fileContent)
 	if err := h.documentRepo.SaveDocument(c.Request.Context(), doc, fileReader); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save document"})
 		return
 	}
 
 	// Extract text content
-	content, extractErr := h.extractService.ExtractText(c.Request.Context(), fileType, fileContent)
+	extraction, extractErr := h.extractors.Extract(c.Request.Context(), fileType, fileContent)
 	if extractErr != nil {
-		// Log error but don't fail upload
+		// Log error but don't fail upload; the reason is stored and returned so the user knows
 		fmt.Printf("Warning: Failed to extract text from document %s: %v\n", doc.ID.Hex(), extractErr)
 		// For TXT/MD files, extraction should always work, so this is unexpected
 		if fileType == "txt" || fileType == "md" {
 			fmt.Printf("Error: Text extraction failed for text file, this should not happen\n")
 		}
+		doc.ExtractionError = extractErr.Error()
 	} else {
-		// Update document with extracted content
-		doc.Content = content
-		if err := h.documentRepo.UpdateDocumentContent(c.Request.Context(), doc.ID, content); err != nil {
-			fmt.Printf("Warning: Failed to update document content: %v\n", err)
-		}
+		doc.Content = extraction.Content
+		doc.Pages = extraction.Pages
+	}
+
+	// Update document with extracted content
+	if err := h.documentRepo.UpdateDocumentContent(c.Request.Context(), doc.ID, doc.Content, doc.Pages, doc.ExtractionError); err != nil {
+		fmt.Printf("Warning: Failed to update document content: %v\n", err)
 	}
 
 	// Prepare response
-	preview := content
+	preview := doc.Content
 	if len(preview) > 500 {
 		preview = preview[:500] + "..."
 	}
 
 	response := models.UploadResponse{
-		DocumentID: doc.ID.Hex(),
-		Filename:   doc.Filename,
-		FileType:   doc.FileType,
-		FileSize:   doc.FileSize,
-		Content:    preview,
+		DocumentID:      doc.ID.Hex(),
+		Filename:        doc.Filename,
+		FileType:        doc.FileType,
+		FileSize:        doc.FileSize,
+		Content:         preview,
+		Pages:           doc.Pages,
+		ExtractionError: doc.ExtractionError,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -196,7 +180,7 @@ func (h *UploadHandler) DownloadFile(c *gin.Context) {
 	defer fileStream.Close()
 
 	// Set headers
-	mimeType := getMimeType(doc.FileType)
+	mimeType := h.extractors.ContentType(doc.FileType)
 	c.Header("Content-Type", mimeType)
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", doc.Filename))
 	c.Header("Content-Length", fmt.Sprintf("%d", doc.FileSize))
@@ -242,30 +226,3 @@ func (h *UploadHandler) GetSessionDocuments(c *gin.Context) {
 
 	c.JSON(http.StatusOK, documents)
 }
-
-// Helper function to get MIME type from file type
-func getMimeType(fileType string) string {
-	switch fileType {
-	case "pdf":
-		return "application/pdf"
-	case "docx":
-		return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
-	case "doc":
-		return "application/msword"
-	case "txt":
-		return "text/plain"
-	case "md":
-		return "text/markdown"
-	case "xlsx":
-		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
-	case "xls":
-		return "application/vnd.ms-excel"
-	default:
-		return "application/octet-stream"
-	}
-}
-
-// IsExcelFile checks if the file type is an Excel file
-func IsExcelFile(fileType string) bool {
-	return ExcelMimeTypes[fileType]
-}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ui-agentbedrock/backend/internal/services"
+)
+
+type UsageHandler struct {
+	usageService *services.UsageService
+}
+
+func NewUsageHandler(usageService *services.UsageService) *UsageHandler {
+	return &UsageHandler{usageService: usageService}
+}
+
+// GetSessionUsage returns the token usage and cost of a session
+func (h *UsageHandler) GetSessionUsage(c *gin.Context) {
+	report, err := h.usageService.GetSessionUsage(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetUsageReport returns usage across all sessions.
+// Optional ?from= and ?to= take RFC 3339 timestamps or YYYY-MM-DD dates.
+func (h *UsageHandler) GetUsageReport(c *gin.Context) {
+	from, err := parseTimeQuery(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from: " + err.Error()})
+		return
+	}
+	to, err := parseTimeQuery(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to: " + err.Error()})
+		return
+	}
+
+	report, err := h.usageService.GetUsageReport(c.Request.Context(), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// parseTimeQuery parses an optional RFC 3339 timestamp or YYYY-MM-DD date
+func parseTimeQuery(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		parsed, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &parsed, nil
+}
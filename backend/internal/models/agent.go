@@ -0,0 +1,18 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AgentDefinition is a Bedrock agent that sessions can be routed to
+type AgentDefinition struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Key          string             `bson:"key" json:"key"` // Stable identifier stored on sessions (e.g. "auditing")
+	AgentID      string             `bson:"agent_id" json:"agentId"`
+	AgentAliasID string             `bson:"agent_alias_id" json:"agentAliasId"`
+	Name         string             `bson:"name" json:"name"` // Display name, also used for the main agent's steps
+	Description  string             `bson:"description,omitempty" json:"description,omitempty"`
+	Default      bool               `bson:"default,omitempty" json:"default"` // Used for sessions without an agent
+
+	Workflow *WorkflowDefinition `bson:"workflow,omitempty" json:"workflow,omitempty"` // Collaborator pipeline of multi-agent teams
+}
@@ -0,0 +1,16 @@
+package models
+
+// Citation links part of an answer to the knowledge base source it came from
+type Citation struct {
+	SourceURI       string   `bson:"source_uri" json:"sourceUri"`
+	Snippet         string   `bson:"snippet,omitempty" json:"snippet,omitempty"` // Retrieved passage
+	KnowledgeBaseID string   `bson:"knowledge_base_id,omitempty" json:"knowledgeBaseId,omitempty"`
+	Score           *float64 `bson:"score,omitempty" json:"score,omitempty"` // Relevance score, when the knowledge base reports one
+	Span            *Span    `bson:"span,omitempty" json:"span,omitempty"`   // Cited part of the answer; nil for references retrieved but not cited
+}
+
+// Span is a character range [Start, End) of the final answer
+type Span struct {
+	Start int `bson:"start" json:"start"`
+	End   int `bson:"end" json:"end"`
+}
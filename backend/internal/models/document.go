@@ -8,18 +8,20 @@ import (
 
 // Document represents an uploaded document file
 type Document struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	SessionID   primitive.ObjectID `bson:"session_id" json:"sessionId"`
-	MessageID   primitive.ObjectID `bson:"message_id,omitempty" json:"messageId,omitempty"`
-	Filename    string             `bson:"filename" json:"filename"`
-	FileType    string             `bson:"file_type" json:"fileType"`                  // "pdf", "docx", "txt", "md", "xlsx", "xls"
-	FileSize    int64              `bson:"file_size" json:"fileSize"`                  // bytes
-	Content     string             `bson:"content,omitempty" json:"content,omitempty"` // Extracted text (not for Excel)
-	GridFSID    primitive.ObjectID `bson:"gridfs_id,omitempty" json:"gridfsId,omitempty"`
-	S3Key       string             `bson:"s3_key,omitempty" json:"s3Key,omitempty"`             // S3 object key for Excel files
-	StorageType string             `bson:"storage_type,omitempty" json:"storageType,omitempty"` // "gridfs" or "s3"
-	Confirmed   bool               `bson:"confirmed" json:"confirmed"`                          // True after S3 upload confirmed
-	CreatedAt   time.Time          `bson:"created_at" json:"createdAt"`
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SessionID       primitive.ObjectID `bson:"session_id" json:"sessionId"`
+	MessageID       primitive.ObjectID `bson:"message_id,omitempty" json:"messageId,omitempty"`
+	Filename        string             `bson:"filename" json:"filename"`
+	FileType        string             `bson:"file_type" json:"fileType"`                                   // FileFormat.FileType, e.g. "pdf", "docx", "xlsx"
+	FileSize        int64              `bson:"file_size" json:"fileSize"`                                   // bytes
+	Content         string             `bson:"content,omitempty" json:"content,omitempty"`                  // Extracted text (not for Excel)
+	Pages           []PageStats        `bson:"pages,omitempty" json:"pages,omitempty"`                      // Characters extracted per page (PDF)
+	ExtractionError string             `bson:"extraction_error,omitempty" json:"extractionError,omitempty"` // Why no text could be extracted
+	GridFSID        primitive.ObjectID `bson:"gridfs_id,omitempty" json:"gridfsId,omitempty"`
+	S3Key           string             `bson:"s3_key,omitempty" json:"s3Key,omitempty"`             // S3 object key for Excel files
+	StorageType     string             `bson:"storage_type,omitempty" json:"storageType,omitempty"` // StorageGridFS or StorageS3
+	Confirmed       bool               `bson:"confirmed" json:"confirmed"`                          // True after S3 upload confirmed
+	CreatedAt       time.Time          `bson:"created_at" json:"createdAt"`
 }
 
 // UploadResponse represents the response after successful file upload
@@ -30,4 +32,31 @@ type UploadResponse struct {
 	FileSize   int64  `json:"fileSize"`
 	Content    string `json:"content,omitempty"` // Extracted text preview (first 500 chars)
 	S3Key      string `json:"s3Key,omitempty"`   // S3 key for Excel files
+
+	Pages           []PageStats `json:"pages,omitempty"`           // Characters extracted per page (PDF)
+	ExtractionError string      `json:"extractionError,omitempty"` // Set if the upload worked but no text could be extracted
+}
+
+// PageStats is the amount of text extracted from one page of a document.
+// A page without characters usually is a scanned image.
+type PageStats struct {
+	Page  int `bson:"page" json:"page"` // 1-based page number
+	Chars int `bson:"chars" json:"chars"`
+}
+
+// Where uploaded files are stored
+const (
+	StorageGridFS = "gridfs" // Uploaded to the backend and extracted there
+	StorageS3     = "s3"     // Uploaded to S3 with a presigned URL, the agent reads it from there
+)
+
+// FileFormat is a document format that can be uploaded, as registered with its extractor
+type FileFormat struct {
+	FileType   string   `json:"fileType"`   // Stored as Document.FileType
+	Label      string   `json:"label"`      // Display name, e.g. "PDF"
+	Extensions []string `json:"extensions"` // Lower case with the dot, e.g. ".pdf"
+	MimeTypes  []string `json:"mimeTypes"`  // The first one is the content type of downloads
+	Magic      string   `json:"-"`          // Leading bytes identifying the format whatever the filename
+	MaxSize    int64    `json:"maxSize"`    // Bytes
+	Storage    string   `json:"storage"`    // StorageGridFS or StorageS3
 }
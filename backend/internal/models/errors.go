@@ -0,0 +1,26 @@
+package models
+
+// ErrorClass classifies agent invocation failures. It is the Class of
+// ErrorEvent and ErrorInfo, so clients can react per class.
+type ErrorClass string
+
+const (
+	ErrorClassThrottling         ErrorClass = "Throttling"         // Rate limited, retried with backoff
+	ErrorClassQuotaExceeded      ErrorClass = "QuotaExceeded"      // Service quota reached
+	ErrorClassAccessDenied       ErrorClass = "AccessDenied"       // Missing IAM permissions
+	ErrorClassValidation         ErrorClass = "Validation"         // Invalid request, e.g. input too long
+	ErrorClassNotFound           ErrorClass = "NotFound"           // Unknown agent, alias or session
+	ErrorClassConflict           ErrorClass = "Conflict"           // Session already in use
+	ErrorClassDependencyFailed   ErrorClass = "DependencyFailed"   // Action group Lambda or model failed
+	ErrorClassServiceError       ErrorClass = "ServiceError"       // Bedrock internal or gateway error, retried
+	ErrorClassStreamInterrupted  ErrorClass = "StreamInterrupted"  // The response stream broke off
+	ErrorClassServiceUnavailable ErrorClass = "ServiceUnavailable" // Circuit breaker open, Bedrock is degraded
+	ErrorClassUnknown            ErrorClass = "Unknown"
+)
+
+// ServiceUnavailableEvent tells the client the agent service is failing fast
+// while Bedrock is degraded
+type ServiceUnavailableEvent struct {
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retryAfter"` // Seconds until invocations are tried again
+}
@@ -0,0 +1,39 @@
+package models
+
+// GuardrailAssessment is the result of a Bedrock guardrail check on a turn
+type GuardrailAssessment struct {
+	Action        string               `bson:"action" json:"action"` // "INTERVENED" | "NONE"
+	InputBlocked  bool                 `bson:"input_blocked,omitempty" json:"inputBlocked,omitempty"`
+	OutputBlocked bool                 `bson:"output_blocked,omitempty" json:"outputBlocked,omitempty"`
+	Policies      []GuardrailPolicyHit `bson:"policies,omitempty" json:"policies,omitempty"` // Policies that matched
+}
+
+// Intervened reports whether the guardrail acted on the turn
+func (a *GuardrailAssessment) Intervened() bool {
+	return a != nil && a.Action == "INTERVENED"
+}
+
+// Blocked reports whether the guardrail blocked the input or the output
+func (a *GuardrailAssessment) Blocked() bool {
+	return a != nil && (a.InputBlocked || a.OutputBlocked)
+}
+
+// GuardrailPolicyHit is one guardrail policy that matched. PII and regex
+// matches are not kept, only which entity type or pattern matched.
+type GuardrailPolicyHit struct {
+	Source     string `bson:"source" json:"source"`                             // "input" | "output"
+	Policy     string `bson:"policy" json:"policy"`                             // "content_filter" | "denied_topic" | "pii_entity" | "regex" | "custom_word" | "managed_word"
+	Type       string `bson:"type,omitempty" json:"type,omitempty"`             // Filter, PII entity or word list type, e.g. "HATE", "EMAIL"
+	Name       string `bson:"name,omitempty" json:"name,omitempty"`             // Denied topic or regex name
+	Match      string `bson:"match,omitempty" json:"match,omitempty"`           // Matched word, for word policies only
+	Confidence string `bson:"confidence,omitempty" json:"confidence,omitempty"` // Content filters only
+	Action     string `bson:"action" json:"action"`                             // e.g. "BLOCKED", "ANONYMIZED"
+}
+
+// GuardrailBlockedEvent tells the client a guardrail blocked the turn
+type GuardrailBlockedEvent struct {
+	StepIndex     int                  `json:"stepIndex"`
+	InputBlocked  bool                 `json:"inputBlocked"`
+	OutputBlocked bool                 `json:"outputBlocked"`
+	Policies      []GuardrailPolicyHit `json:"policies"`
+}
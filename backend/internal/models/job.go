@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ChatJob is a detached agent run that clients poll instead of holding an SSE connection
+type ChatJob struct {
+	ID             primitive.ObjectID         `bson:"_id,omitempty" json:"id"`
+	SessionID      primitive.ObjectID         `bson:"session_id" json:"sessionId"`
+	BranchID       string                     `bson:"branch_id,omitempty" json:"-"` // Branch the reply is saved in, "" for the main branch
+	AgentSessionID string                     `bson:"agent_session_id" json:"-"`
+	AgentKey       string                     `bson:"agent_key,omitempty" json:"agentKey,omitempty"`
+	Attributes     AgentAttributes            `bson:"attributes,omitempty" json:"-"`
+	Prompt         string                     `bson:"prompt" json:"-"`      // Full text sent to the agent (with document/summary context)
+	Status         string                     `bson:"status" json:"status"` // "queued" | "running" | "completed" | "failed" | "cancelled"
+	AgentSteps     []AgentStep                `bson:"agent_steps" json:"agentSteps"`
+	Content        string                     `bson:"content" json:"content"`                               // Partial output while running
+	Confirmation   *ConfirmationRequiredEvent `bson:"confirmation,omitempty" json:"confirmation,omitempty"` // Action waiting for the user's decision
+	TraceID        string                     `bson:"trace_id,omitempty" json:"traceId,omitempty"`
+	MessageID      primitive.ObjectID         `bson:"message_id,omitempty" json:"messageId,omitempty"` // Saved assistant message
+	Error          *ErrorInfo                 `bson:"error,omitempty" json:"error,omitempty"`
+	Attempts       int                        `bson:"attempts" json:"attempts"`
+	Owner          string                     `bson:"owner,omitempty" json:"-"`        // Backend instance running the job
+	HeartbeatAt    *time.Time                 `bson:"heartbeat_at,omitempty" json:"-"` // Renewed by the owner while the job runs
+	CreatedAt      time.Time                  `bson:"created_at" json:"createdAt"`
+	StartedAt      *time.Time                 `bson:"started_at,omitempty" json:"startedAt,omitempty"`
+	CompletedAt    *time.Time                 `bson:"completed_at,omitempty" json:"completedAt,omitempty"`
+	UpdatedAt      time.Time                  `bson:"updated_at" json:"updatedAt"`
+}
+
+type CreateJobResponse struct {
+	JobID  string `json:"jobId"`
+	Status string `json:"status"`
+}
@@ -7,17 +7,35 @@ import (
 )
 
 type Message struct {
-	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-	SessionID primitive.ObjectID   `bson:"session_id" json:"sessionId"`
-	Role      string               `bson:"role" json:"role"` // "user" | "assistant"
-	Content   string               `bson:"content" json:"content"`
-	Documents []primitive.ObjectID `bson:"documents,omitempty" json:"documents,omitempty"` // Document IDs
-	Trace     *Trace               `bson:"trace,omitempty" json:"trace,omitempty"`
-	CreatedAt time.Time            `bson:"created_at" json:"createdAt"`
+	ID         primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	SessionID  primitive.ObjectID   `bson:"session_id" json:"sessionId"`
+	Role       string               `bson:"role" json:"role"` // "user" | "assistant"
+	Content    string               `bson:"content" json:"content"`
+	Documents  []primitive.ObjectID `bson:"documents,omitempty" json:"documents,omitempty"` // Document IDs
+	Trace      *Trace               `bson:"trace,omitempty" json:"trace,omitempty"`
+	Citations  []Citation           `bson:"citations,omitempty" json:"citations,omitempty"`   // Knowledge base sources of the answer
+	Usage      *TokenUsage          `bson:"usage,omitempty" json:"usage,omitempty"`           // Model tokens and cost of the answer
+	Status     string               `bson:"status,omitempty" json:"status,omitempty"`         // "" (complete) | "cancelled" | "interrupted"
+	Alternates []MessageVersion     `bson:"alternates,omitempty" json:"alternates,omitempty"` // Previous versions of a regenerated reply, oldest first
+	BranchID   string               `bson:"branch_id,omitempty" json:"branchId,omitempty"`    // "" for the main branch
+	CreatedAt  time.Time            `bson:"created_at" json:"createdAt"`
+}
+
+// MessageVersion is a replaced version of an assistant reply
+type MessageVersion struct {
+	Content    string      `bson:"content" json:"content"`
+	Trace      *Trace      `bson:"trace,omitempty" json:"trace,omitempty"`
+	Citations  []Citation  `bson:"citations,omitempty" json:"citations,omitempty"`
+	Usage      *TokenUsage `bson:"usage,omitempty" json:"usage,omitempty"`
+	Status     string      `bson:"status,omitempty" json:"status,omitempty"`
+	ReplacedAt time.Time   `bson:"replaced_at" json:"replacedAt"`
 }
 
 type ChatRequest struct {
 	SessionID   string   `json:"sessionId" binding:"required"`
 	Message     string   `json:"message" binding:"required"`
 	DocumentIDs []string `json:"documentIds,omitempty"` // Document IDs to include in context
+
+	// Sent with this message only, merged over the session's attributes
+	AgentAttributes
 }
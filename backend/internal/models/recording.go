@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AgentRecording is the raw Bedrock event stream of a single agent invocation,
+// kept so the invocation can be replayed locally
+type AgentRecording struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TraceID        string             `bson:"trace_id" json:"traceId"` // Links to Trace.TraceID of the saved message
+	AgentID        string             `bson:"agent_id" json:"agentId"`
+	AgentAliasID   string             `bson:"agent_alias_id" json:"agentAliasId"`
+	AgentSessionID string             `bson:"agent_session_id" json:"agentSessionId"`
+	InputText      string             `bson:"input_text" json:"inputText"`
+	InvocationID   string             `bson:"invocation_id,omitempty" json:"invocationId,omitempty"`           // Return-control round this invocation answers
+	Results        string             `bson:"invocation_results,omitempty" json:"invocationResults,omitempty"` // JSON-encoded action results handed back to the agent
+	Events         []RecordedEvent    `bson:"events" json:"events"`
+	Error          string             `bson:"error,omitempty" json:"error,omitempty"` // Invoke or stream error
+	CreatedAt      time.Time          `bson:"created_at" json:"createdAt"`
+}
+
+type RecordedEvent struct {
+	Type     string `bson:"type" json:"type"`          // "chunk" | "trace" | "return_control" | "files"
+	OffsetMs int64  `bson:"offset_ms" json:"offsetMs"` // Time since the invocation started
+	Data     string `bson:"data" json:"data"`          // JSON-encoded event payload
+}
@@ -7,18 +7,128 @@ import (
 )
 
 type Session struct {
-	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Title          string             `bson:"title" json:"title"`
-	AgentSessionID string             `bson:"agent_session_id" json:"agentSessionId"`                    // Separate ID for AgentBedrock API
-	SummaryContext string             `bson:"summary_context,omitempty" json:"summaryContext,omitempty"` // Context to pass on session rotation
-	CreatedAt      time.Time          `bson:"created_at" json:"createdAt"`
-	UpdatedAt      time.Time          `bson:"updated_at" json:"updatedAt"`
+	ID             primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Title          string               `bson:"title" json:"title"`
+	AgentSessionID string               `bson:"agent_session_id" json:"agentSessionId"`                     // Separate ID for AgentBedrock API
+	AgentKey       string               `bson:"agent_key,omitempty" json:"agentKey,omitempty"`              // Registry key of the agent this session talks to
+	SummaryContext string               `bson:"summary_context,omitempty" json:"summaryContext,omitempty"`  // Context to pass on session rotation
+	ActiveBranchID string               `bson:"active_branch_id,omitempty" json:"activeBranchId,omitempty"` // "" means the main branch
+	Branches       []Branch             `bson:"branches,omitempty" json:"branches,omitempty"`
+	SummaryCutoffs map[string]time.Time `bson:"summary_cutoffs,omitempty" json:"-"`            // Branch ID -> messages before this time were summarized away
+	Usage          *TokenUsage          `bson:"usage,omitempty" json:"usage,omitempty"`        // Total model usage of every message, including replaced ones
+	GuardrailHits  int                  `bson:"guardrail_hits,omitempty" json:"guardrailHits"` // Turns where a guardrail intervened, including replaced ones
+	CreatedAt      time.Time            `bson:"created_at" json:"createdAt"`
+	UpdatedAt      time.Time            `bson:"updated_at" json:"updatedAt"`
+
+	// Persistent attributes sent on every invocation
+	AgentAttributes `bson:",inline"`
+}
+
+// MainBranchID identifies the original conversation thread of a session
+const MainBranchID = "main"
+
+// IsMainBranch reports whether a branch ID refers to the main branch
+func IsMainBranch(branchID string) bool {
+	return branchID == "" || branchID == MainBranchID
+}
+
+// Branch is a conversation thread created by editing an earlier user message.
+// It shares the parent branch's messages created before ForkedAt.
+type Branch struct {
+	ID              string             `bson:"id" json:"id"`
+	ParentBranchID  string             `bson:"parent_branch_id,omitempty" json:"parentBranchId,omitempty"`
+	ParentMessageID primitive.ObjectID `bson:"parent_message_id,omitempty" json:"parentMessageId,omitempty"` // Last message shared with the parent branch
+	EditedMessageID primitive.ObjectID `bson:"edited_message_id,omitempty" json:"editedMessageId,omitempty"` // User message replaced in this branch
+	ForkedAt        time.Time          `bson:"forked_at" json:"forkedAt"`
+	AgentSessionID  string             `bson:"agent_session_id" json:"-"` // Bedrock session of the branch while inactive
+	SummaryContext  string             `bson:"summary_context,omitempty" json:"-"`
+	CreatedAt       time.Time          `bson:"created_at" json:"createdAt"`
+}
+
+// SummaryCutoff returns the time before which a branch's messages, including
+// inherited ones, were replaced by a summary (zero if never summarized)
+func (s *Session) SummaryCutoff(branchID string) time.Time {
+	if IsMainBranch(branchID) {
+		branchID = MainBranchID
+	}
+	return s.SummaryCutoffs[branchID]
+}
+
+// LatestChildFork returns the latest fork point of the branches forked from
+// branchID: the branch's messages before it are inherited by a child branch
+func (s *Session) LatestChildFork(branchID string) time.Time {
+	var latest time.Time
+	for _, branch := range s.Branches {
+		isChild := branch.ParentBranchID == branchID || (IsMainBranch(branch.ParentBranchID) && IsMainBranch(branchID))
+		if isChild && branch.ForkedAt.After(latest) {
+			latest = branch.ForkedAt
+		}
+	}
+	return latest
+}
+
+// FindBranch returns the branch with the given ID, or nil
+func (s *Session) FindBranch(branchID string) *Branch {
+	for i := range s.Branches {
+		if s.Branches[i].ID == branchID {
+			return &s.Branches[i]
+		}
+	}
+	return nil
+}
+
+// AgentAttributes are passed to the agent through SessionState.
+// Session attributes persist across the Bedrock session; prompt session
+// attributes only apply to the current turn.
+type AgentAttributes struct {
+	SessionAttributes       map[string]string `bson:"session_attributes,omitempty" json:"sessionAttributes,omitempty"`
+	PromptSessionAttributes map[string]string `bson:"prompt_session_attributes,omitempty" json:"promptSessionAttributes,omitempty"`
+}
+
+// Merge returns the attributes with override's values taking precedence
+func (a AgentAttributes) Merge(override AgentAttributes) AgentAttributes {
+	return AgentAttributes{
+		SessionAttributes:       mergeAttributes(a.SessionAttributes, override.SessionAttributes),
+		PromptSessionAttributes: mergeAttributes(a.PromptSessionAttributes, override.PromptSessionAttributes),
+	}
+}
+
+// IsEmpty reports whether there are no attributes to send
+func (a AgentAttributes) IsEmpty() bool {
+	return len(a.SessionAttributes) == 0 && len(a.PromptSessionAttributes) == 0
+}
+
+func mergeAttributes(base, override map[string]string) map[string]string {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]string, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
 }
 
 type CreateSessionRequest struct {
-	Title string `json:"title"`
+	Title    string `json:"title"`
+	AgentKey string `json:"agentKey"` // Defaults to the registry's default agent
+	AgentAttributes
 }
 
 type UpdateSessionRequest struct {
 	Title string `json:"title"`
 }
+
+// UpdateAttributesRequest replaces a session's persistent agent attributes
+type UpdateAttributesRequest struct {
+	AgentAttributes
+}
+
+type EditMessageRequest struct {
+	Message     string   `json:"message" binding:"required"`
+	DocumentIDs []string `json:"documentIds,omitempty"` // Defaults to the documents of the edited message
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SessionLease grants one request at a time the right to invoke the agent on a
+// session. Holders renew it while they run; a TTL index removes leases whose
+// holder died without releasing them.
+type SessionLease struct {
+	SessionID  primitive.ObjectID `bson:"_id" json:"sessionId"`
+	Holder     string             `bson:"holder" json:"holder"` // Random token of the request holding the lease
+	AcquiredAt time.Time          `bson:"acquired_at" json:"acquiredAt"`
+	ExpiresAt  time.Time          `bson:"expires_at" json:"expiresAt"`
+}
@@ -5,9 +5,24 @@ import (
 )
 
 type Trace struct {
-	TraceID    string      `bson:"trace_id" json:"traceId"`
-	AgentSteps []AgentStep `bson:"agent_steps" json:"agentSteps"`
-	Error      *ErrorInfo  `bson:"error,omitempty" json:"error,omitempty"`
+	TraceID       string         `bson:"trace_id" json:"traceId"`
+	AgentSteps    []AgentStep    `bson:"agent_steps" json:"agentSteps"`
+	Confirmations []Confirmation `bson:"confirmations,omitempty" json:"confirmations,omitempty"` // User decisions on actions that required confirmation
+	Usage         *TokenUsage    `bson:"usage,omitempty" json:"usage,omitempty"`                 // Tokens of every model invocation, including ones without a step
+	Archived      bool           `bson:"archived,omitempty" json:"archived,omitempty"`           // The untruncated raw trace is in the trace archive
+	Error         *ErrorInfo     `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// Confirmation records the user's decision on an agent action
+type Confirmation struct {
+	ID          string            `bson:"id" json:"id"`
+	StepIndex   int               `bson:"step_index" json:"stepIndex"`
+	ActionGroup string            `bson:"action_group" json:"actionGroup"`
+	Function    string            `bson:"function" json:"function"`
+	Parameters  map[string]string `bson:"parameters,omitempty" json:"parameters,omitempty"`
+	Decision    string            `bson:"decision" json:"decision"` // "approved" | "denied" | "expired"
+	RequestedAt time.Time         `bson:"requested_at" json:"requestedAt"`
+	DecidedAt   time.Time         `bson:"decided_at" json:"decidedAt"`
 }
 
 type AgentStep struct {
@@ -16,7 +31,7 @@ type AgentStep struct {
 	AgentID     string    `bson:"agent_id,omitempty" json:"agentId,omitempty"`
 	Type        string    `bson:"type" json:"type"` // "orchestration" | "pre_processing" | "post_processing" | "action" | "knowledge_base" | "collaborator"
 	Action      string    `bson:"action" json:"action"`
-	Status      string    `bson:"status" json:"status"` // "running" | "success" | "error"
+	Status      string    `bson:"status" json:"status"` // "running" | "success" | "error" | "cancelled"
 	Rationale   string    `bson:"rationale,omitempty" json:"rationale,omitempty"`
 	Observation string    `bson:"observation,omitempty" json:"observation,omitempty"`
 	Input       string    `bson:"input,omitempty" json:"input,omitempty"`
@@ -24,13 +39,74 @@ type AgentStep struct {
 	StartTime   time.Time `bson:"start_time" json:"startTime"`
 	EndTime     time.Time `bson:"end_time,omitempty" json:"endTime,omitempty"`
 	Duration    int64     `bson:"duration,omitempty" json:"duration,omitempty"` // in milliseconds
+
+	// Step index of the collaborator call this step ran under, 0 for the supervisor's own steps
+	ParentStepIndex int `bson:"parent_step_index,omitempty" json:"parentStepIndex,omitempty"`
+
+	// Model invocation steps only
+	Model string      `bson:"model,omitempty" json:"model,omitempty"`
+	Usage *TokenUsage `bson:"usage,omitempty" json:"usage,omitempty"`
+
+	// Guardrail steps only
+	Guardrail *GuardrailAssessment `bson:"guardrail,omitempty" json:"guardrail,omitempty"`
+}
+
+// GuardrailHits counts the steps where a guardrail intervened
+func (t *Trace) GuardrailHits() int {
+	if t == nil {
+		return 0
+	}
+
+	hits := 0
+	for _, step := range t.AgentSteps {
+		if step.Guardrail.Intervened() {
+			hits++
+		}
+	}
+	return hits
+}
+
+// StepNode is an agent step with the steps that ran under it.
+// A collaborator call's children are the collaborator's own steps.
+type StepNode struct {
+	AgentStep `bson:",inline"`
+
+	Children []StepNode `bson:"children,omitempty" json:"children,omitempty"`
+}
+
+// StepTree nests the flat step list by ParentStepIndex. A parent always comes
+// before its children, steps with a missing or later parent stay at the top level.
+func (t *Trace) StepTree() []StepNode {
+	known := make(map[int]bool, len(t.AgentSteps))
+	children := make(map[int][]AgentStep)
+	for _, step := range t.AgentSteps {
+		known[step.StepIndex] = true
+	}
+	for _, step := range t.AgentSteps {
+		parent := step.ParentStepIndex
+		if !known[parent] || parent >= step.StepIndex {
+			parent = 0
+		}
+		children[parent] = append(children[parent], step)
+	}
+
+	var build func(parent int) []StepNode
+	build = func(parent int) []StepNode {
+		nodes := make([]StepNode, 0, len(children[parent]))
+		for _, step := range children[parent] {
+			nodes = append(nodes, StepNode{AgentStep: step, Children: build(step.StepIndex)})
+		}
+		return nodes
+	}
+	return build(0)
 }
 
 type ErrorInfo struct {
-	Type       string `bson:"type" json:"type"`
-	Message    string `bson:"message" json:"message"`
-	Source     string `bson:"source" json:"source"` // Lambda function name
-	StackTrace string `bson:"stack_trace,omitempty" json:"stackTrace,omitempty"`
+	Type       string     `bson:"type" json:"type"`
+	Class      ErrorClass `bson:"class,omitempty" json:"class,omitempty"`
+	Message    string     `bson:"message" json:"message"`
+	Source     string     `bson:"source" json:"source"` // Lambda function name
+	StackTrace string     `bson:"stack_trace,omitempty" json:"stackTrace,omitempty"`
 }
 
 // SSE Event types
@@ -55,6 +131,13 @@ type AgentStepEvent struct {
 	Input       string `json:"input,omitempty"`
 	Output      string `json:"output,omitempty"`
 	Duration    int64  `json:"duration,omitempty"`
+
+	ParentStepIndex int `json:"parentStepIndex,omitempty"`
+
+	Model string      `json:"model,omitempty"`
+	Usage *TokenUsage `json:"usage,omitempty"`
+
+	Guardrail *GuardrailAssessment `json:"guardrail,omitempty"`
 }
 
 type ContentEvent struct {
@@ -64,15 +147,48 @@ type ContentEvent struct {
 type TraceEvent struct {
 	TraceID    string      `json:"traceId"`
 	AgentSteps []AgentStep `json:"agentSteps"`
+	Tree       []StepNode  `json:"tree"` // AgentSteps nested under the collaborator calls they ran in
+}
+
+// MessageTrace is the trace of an assistant message as returned by the trace endpoint
+type MessageTrace struct {
+	MessageID string     `json:"messageId"`
+	Trace     *Trace     `json:"trace"`
+	Tree      []StepNode `json:"tree"`
 }
 
 type ErrorEvent struct {
-	Type       string `json:"type"`
-	Message    string `json:"message"`
-	Source     string `json:"source,omitempty"`
-	StackTrace string `json:"stackTrace,omitempty"`
+	Type       string     `json:"type"`
+	Class      ErrorClass `json:"class,omitempty"`
+	Message    string     `json:"message"`
+	Source     string     `json:"source,omitempty"`
+	StackTrace string     `json:"stackTrace,omitempty"`
 }
 
 type DoneEvent struct {
 	MessageID string `json:"messageId"`
 }
+
+type CancelledEvent struct {
+	MessageID string `json:"messageId"`
+	Cancelled bool   `json:"cancelled"`
+}
+
+// ConfirmationRequiredEvent asks the user to approve or deny an agent action
+type ConfirmationRequiredEvent struct {
+	ConfirmationID string            `bson:"confirmation_id" json:"confirmationId"`
+	StepIndex      int               `bson:"step_index" json:"stepIndex"`
+	ActionGroup    string            `bson:"action_group" json:"actionGroup"`
+	Function       string            `bson:"function" json:"function"`
+	HTTPMethod     string            `bson:"http_method,omitempty" json:"httpMethod,omitempty"`
+	Parameters     map[string]string `bson:"parameters,omitempty" json:"parameters,omitempty"`
+}
+
+type ConfirmationResolvedEvent struct {
+	ConfirmationID string `json:"confirmationId"`
+	Decision       string `json:"decision"`
+}
+
+type ConfirmationDecisionRequest struct {
+	Approved *bool `json:"approved" binding:"required"`
+}
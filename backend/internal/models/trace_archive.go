@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TraceArchive is the complete, untruncated raw trace of one agent invocation.
+// Small archives keep their JSON inline, large ones live in the trace_archives GridFS bucket.
+type TraceArchive struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	TraceID        string              `bson:"trace_id" json:"traceId"` // Links to Trace.TraceID of the saved message
+	AgentID        string              `bson:"agent_id" json:"agentId"`
+	AgentAliasID   string              `bson:"agent_alias_id" json:"agentAliasId"`
+	AgentSessionID string              `bson:"agent_session_id" json:"agentSessionId"`
+	Events         int                 `bson:"events" json:"events"` // Number of raw trace and return-control events
+	Size           int64               `bson:"size" json:"size"`     // Size of the JSON in bytes
+	Data           []byte              `bson:"data,omitempty" json:"-"`
+	GridFSID       *primitive.ObjectID `bson:"gridfs_id,omitempty" json:"-"` // Set instead of Data for large archives
+	CreatedAt      time.Time           `bson:"created_at" json:"createdAt"`
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TokenUsage is the model token usage reported by Bedrock and its cost in USD
+type TokenUsage struct {
+	InputTokens  int64   `bson:"input_tokens" json:"inputTokens"`
+	OutputTokens int64   `bson:"output_tokens" json:"outputTokens"`
+	Cost         float64 `bson:"cost" json:"cost"`
+}
+
+// Add accumulates other into u
+func (u *TokenUsage) Add(other TokenUsage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.Cost += other.Cost
+}
+
+// IsZero reports whether no tokens were used
+func (u TokenUsage) IsZero() bool {
+	return u.InputTokens == 0 && u.OutputTokens == 0
+}
+
+// UsageRecord is the token usage of one invocation: an agent reply (each version
+// of a message) or a summarization. Usage reports are computed from these
+// records, so replaced and summarized-away messages keep counting.
+type UsageRecord struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	SessionID  primitive.ObjectID `bson:"session_id"`
+	MessageID  primitive.ObjectID `bson:"message_id,omitempty"` // Agent reply, none for summarizations
+	Kind       string             `bson:"kind"`                 // "agent" | "summary"
+	Models     []ModelUsage       `bson:"models,omitempty"`     // Usage per foundation model
+	TokenUsage `bson:",inline"`
+	CreatedAt  time.Time `bson:"created_at"`
+}
+
+// ModelUsage is the usage of one foundation model within an invocation
+type ModelUsage struct {
+	Model      string `bson:"model"`
+	TokenUsage `bson:",inline"`
+}
+
+// UsageBreakdown is the usage of one model, agent or session
+type UsageBreakdown struct {
+	Key        string `bson:"_id" json:"key"`
+	Label      string `bson:"label,omitempty" json:"label,omitempty"` // e.g. session title
+	AgentKey   string `bson:"agent_key,omitempty" json:"agentKey,omitempty"`
+	Messages   int64  `bson:"messages" json:"messages"` // Invocations: agent replies and summarizations
+	TokenUsage `bson:",inline"`
+}
+
+// MessageUsage is the usage of one assistant message
+type MessageUsage struct {
+	MessageID primitive.ObjectID `json:"messageId"`
+	CreatedAt time.Time          `json:"createdAt"`
+	Usage     TokenUsage         `json:"usage"`
+}
+
+// SessionUsageReport is returned by GET /api/sessions/:id/usage
+type SessionUsageReport struct {
+	SessionID string           `json:"sessionId"`
+	Total     TokenUsage       `json:"total"` // Includes replaced and summarized messages and summarizations
+	ByModel   []UsageBreakdown `json:"byModel"`
+	Messages  []MessageUsage   `json:"messages"`
+}
+
+// UsageReport is returned by GET /api/usage
+type UsageReport struct {
+	From     *time.Time       `json:"from,omitempty"`
+	To       *time.Time       `json:"to,omitempty"`
+	Total    TokenUsage       `json:"total"`
+	ByAgent  []UsageBreakdown `json:"byAgent"`
+	ByModel  []UsageBreakdown `json:"byModel"`
+	Sessions []UsageBreakdown `json:"sessions"` // Most expensive sessions first
+}
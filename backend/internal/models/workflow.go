@@ -0,0 +1,38 @@
+package models
+
+// WorkflowDefinition describes the collaborator pipeline of a multi-agent team.
+// It drives workflow_progress events and the answer built when the supervisor
+// finishes without responding.
+type WorkflowDefinition struct {
+	Name        string            `bson:"name,omitempty" json:"name,omitempty"`
+	Stages      []WorkflowStage   `bson:"stages" json:"stages"`                                // In the order they run
+	CompletedBy string            `bson:"completed_by,omitempty" json:"completedBy,omitempty"` // Collaborator whose response completes the workflow, defaults to the last stage
+	Templates   WorkflowTemplates `bson:"templates,omitempty" json:"templates,omitempty"`
+}
+
+// WorkflowStage is one collaborator of the pipeline
+type WorkflowStage struct {
+	Collaborator string `bson:"collaborator" json:"collaborator"`     // CollaboratorName in the trace
+	Name         string `bson:"name,omitempty" json:"name,omitempty"` // Display name, defaults to the collaborator
+}
+
+// WorkflowTemplates are the fallback answer texts. Placeholders: {workflow},
+// {stage} (last stage reached), {next} (stage it waits for), {agent} and {output}
+// (last collaborator response) and {status} (the status line).
+type WorkflowTemplates struct {
+	Complete     string `bson:"complete,omitempty" json:"complete,omitempty"`
+	Stopped      string `bson:"stopped,omitempty" json:"stopped,omitempty"`
+	NotStarted   string `bson:"not_started,omitempty" json:"notStarted,omitempty"`
+	LastResponse string `bson:"last_response,omitempty" json:"lastResponse,omitempty"`
+}
+
+// WorkflowProgressEvent reports the stage a workflow is in
+type WorkflowProgressEvent struct {
+	Workflow   string `json:"workflow,omitempty"`
+	Stage      string `json:"stage"`
+	StageIndex int    `json:"stageIndex"` // 0-based
+	Stages     int    `json:"stages"`
+	Status     string `json:"status"`  // "running" | "success" of the current stage
+	Percent    int    `json:"percent"` // Share of stages completed
+	Completed  bool   `json:"completed"`
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/ui-agentbedrock/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AgentRepository struct {
+	agents *mongo.Collection
+}
+
+func NewAgentRepository(db *mongo.Database) *AgentRepository {
+	return &AgentRepository{
+		agents: db.Collection("agents"),
+	}
+}
+
+// GetAgents returns every agent definition, sorted by key
+func (r *AgentRepository) GetAgents(ctx context.Context) ([]models.AgentDefinition, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "key", Value: 1}})
+	cursor, err := r.agents.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var agents []models.AgentDefinition
+	if err := cursor.All(ctx, &agents); err != nil {
+		return nil, err
+	}
+
+	if agents == nil {
+		agents = []models.AgentDefinition{}
+	}
+	return agents, nil
+}
@@ -147,12 +147,17 @@ func (r *DocumentRepository) DeleteDocumentsBySession(ctx context.Context, sessi
 	return nil
 }
 
-// UpdateDocumentContent updates the extracted text content of a document
-func (r *DocumentRepository) UpdateDocumentContent(ctx context.Context, id primitive.ObjectID, content string) error {
+// UpdateDocumentContent updates the extracted text content of a document, its
+// per-page statistics and the extraction error (if no text could be extracted)
+func (r *DocumentRepository) UpdateDocumentContent(ctx context.Context, id primitive.ObjectID, content string, pages []models.PageStats, extractionError string) error {
 	_, err := r.documents.UpdateOne(
 		ctx,
 		bson.M{"_id": id},
-		bson.M{"$set": bson.M{"content": content}},
+		bson.M{"$set": bson.M{
+			"content":          content,
+			"pages":            pages,
+			"extraction_error": extractionError,
+		}},
 	)
 	return err
 }
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ui-agentbedrock/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type JobRepository struct {
+	jobs *mongo.Collection
+}
+
+func NewJobRepository(db *mongo.Database) *JobRepository {
+	return &JobRepository{
+		jobs: db.Collection("chat_jobs"),
+	}
+}
+
+func (r *JobRepository) CreateJob(ctx context.Context, job *models.ChatJob) error {
+	job.ID = primitive.NewObjectID()
+	job.Status = "queued"
+	job.AgentSteps = []models.AgentStep{}
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = time.Now()
+
+	_, err := r.jobs.InsertOne(ctx, job)
+	return err
+}
+
+func (r *JobRepository) GetJob(ctx context.Context, id primitive.ObjectID) (*models.ChatJob, error) {
+	var job models.ChatJob
+	err := r.jobs.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ClaimNextJob atomically moves the oldest queued job to running, owned by owner.
+// Returns nil if there is nothing to do.
+func (r *JobRepository) ClaimNextJob(ctx context.Context, owner string) (*models.ChatJob, error) {
+	now := time.Now()
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var job models.ChatJob
+	err := r.jobs.FindOneAndUpdate(
+		ctx,
+		bson.M{"status": "queued"},
+		bson.M{
+			"$set": bson.M{
+				"status":       "running",
+				"owner":        owner,
+				"heartbeat_at": now,
+				"started_at":   now,
+				"updated_at":   now,
+			},
+			"$inc": bson.M{"attempts": 1},
+		},
+		opts,
+	).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Heartbeat renews the heartbeat of a running job. It returns false if the job
+// is no longer running for owner, e.g. because it was requeued as stale.
+func (r *JobRepository) Heartbeat(ctx context.Context, id primitive.ObjectID, owner string) (bool, error) {
+	result, err := r.jobs.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "owner": owner, "status": "running"},
+		bson.M{"$set": bson.M{"heartbeat_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// RequeueStaleJobs puts running jobs whose owner stopped sending heartbeats
+// before staleBefore back in the queue. Jobs that already ran maxAttempts
+// times are failed instead.
+func (r *JobRepository) RequeueStaleJobs(ctx context.Context, staleBefore time.Time, maxAttempts int) (requeued, failed int64, err error) {
+	stale := bson.M{
+		"status": "running",
+		"$or": []bson.M{
+			{"heartbeat_at": bson.M{"$lt": staleBefore}},
+			// Jobs started before heartbeats existed
+			{"heartbeat_at": bson.M{"$exists": false}, "updated_at": bson.M{"$lt": staleBefore}},
+		},
+	}
+	now := time.Now()
+
+	exhausted := bson.M{"attempts": bson.M{"$gte": maxAttempts}}
+	for k, v := range stale {
+		exhausted[k] = v
+	}
+	result, err := r.jobs.UpdateMany(
+		ctx,
+		exhausted,
+		bson.M{
+			"$set": bson.M{
+				"status": "failed",
+				"error": models.ErrorInfo{
+					Type:    "ChatJobError",
+					Class:   models.ErrorClassServiceError,
+					Message: fmt.Sprintf("The job was interrupted %d times", maxAttempts),
+					Source:  "ChatJob",
+				},
+				"completed_at": now,
+				"updated_at":   now,
+			},
+			"$unset": bson.M{"owner": "", "heartbeat_at": ""},
+		},
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	failed = result.ModifiedCount
+
+	result, err = r.jobs.UpdateMany(
+		ctx,
+		stale,
+		bson.M{
+			"$set": bson.M{
+				"status":      "queued",
+				"agent_steps": []models.AgentStep{},
+				"content":     "",
+				"updated_at":  now,
+			},
+			"$unset": bson.M{"owner": "", "heartbeat_at": "", "confirmation": ""},
+		},
+	)
+	if err != nil {
+		return 0, failed, err
+	}
+	return result.ModifiedCount, failed, nil
+}
+
+// UpdateJobProgress stores the steps and partial output received so far, unless
+// the job was requeued and belongs to another owner now
+func (r *JobRepository) UpdateJobProgress(ctx context.Context, id primitive.ObjectID, owner string, steps []models.AgentStep, content string) error {
+	_, err := r.jobs.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "owner": owner},
+		bson.M{
+			"$set": bson.M{
+				"agent_steps": steps,
+				"content":     content,
+				"updated_at":  time.Now(),
+			},
+		},
+	)
+	return err
+}
+
+// UpdateJobConfirmation sets the action waiting for confirmation, or clears it
+// when nil, unless the job belongs to another owner now
+func (r *JobRepository) UpdateJobConfirmation(ctx context.Context, id primitive.ObjectID, owner string, confirmation *models.ConfirmationRequiredEvent) error {
+	update := bson.M{"$set": bson.M{"confirmation": confirmation, "updated_at": time.Now()}}
+	if confirmation == nil {
+		update = bson.M{"$unset": bson.M{"confirmation": ""}, "$set": bson.M{"updated_at": time.Now()}}
+	}
+
+	_, err := r.jobs.UpdateOne(ctx, bson.M{"_id": id, "owner": owner}, update)
+	return err
+}
+
+// FinishJob stores the final state of a job
+func (r *JobRepository) FinishJob(ctx context.Context, job *models.ChatJob) error {
+	now := time.Now()
+	job.CompletedAt = &now
+	job.UpdatedAt = now
+
+	set := bson.M{
+		"status":       job.Status,
+		"agent_steps":  job.AgentSteps,
+		"content":      job.Content,
+		"trace_id":     job.TraceID,
+		"error":        job.Error,
+		"completed_at": now,
+		"updated_at":   now,
+	}
+	if !job.MessageID.IsZero() {
+		set["message_id"] = job.MessageID
+	}
+
+	// A job requeued as stale belongs to another instance now
+	_, err := r.jobs.UpdateOne(ctx, bson.M{"_id": job.ID, "owner": job.Owner}, bson.M{"$set": set, "$unset": bson.M{"owner": "", "heartbeat_at": ""}})
+	return err
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/ui-agentbedrock/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RecordingRepository struct {
+	recordings *mongo.Collection
+}
+
+func NewRecordingRepository(db *mongo.Database) *RecordingRepository {
+	return &RecordingRepository{
+		recordings: db.Collection("agent_recordings"),
+	}
+}
+
+// SaveRecording stores a recorded agent event stream
+func (r *RecordingRepository) SaveRecording(ctx context.Context, recording *models.AgentRecording) error {
+	if recording.ID.IsZero() {
+		recording.ID = primitive.NewObjectID()
+	}
+
+	_, err := r.recordings.InsertOne(ctx, recording)
+	return err
+}
+
+// GetRecording retrieves a recording with all its events
+func (r *RecordingRepository) GetRecording(ctx context.Context, id primitive.ObjectID) (*models.AgentRecording, error) {
+	var recording models.AgentRecording
+	err := r.recordings.FindOne(ctx, bson.M{"_id": id}).Decode(&recording)
+	if err != nil {
+		return nil, err
+	}
+	return &recording, nil
+}
+
+// ListTraceRecordings returns the recordings of one traced invocation in the
+// order they were made: the first call and each return-control follow-up
+func (r *RecordingRepository) ListTraceRecordings(ctx context.Context, traceID string) ([]models.AgentRecording, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := r.recordings.Find(ctx, bson.M{"trace_id": traceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var recordings []models.AgentRecording
+	if err := cursor.All(ctx, &recordings); err != nil {
+		return nil, err
+	}
+	return recordings, nil
+}
+
+// ListRecordings returns the most recent recordings without their events
+func (r *RecordingRepository) ListRecordings(ctx context.Context, limit int64) ([]models.AgentRecording, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(limit).
+		SetProjection(bson.M{"events": 0})
+	cursor, err := r.recordings.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var recordings []models.AgentRecording
+	if err := cursor.All(ctx, &recordings); err != nil {
+		return nil, err
+	}
+
+	if recordings == nil {
+		recordings = []models.AgentRecording{}
+	}
+	return recordings, nil
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"log"
 	"time"
 
 	"github.com/ui-agentbedrock/backend/internal/models"
@@ -11,15 +13,20 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrSessionRotated is returned when another request rotated the AgentBedrock session first
+var ErrSessionRotated = errors.New("agent session was already rotated")
+
 type SessionRepository struct {
 	sessions *mongo.Collection
 	messages *mongo.Collection
+	usage    *mongo.Collection
 }
 
 func NewSessionRepository(db *mongo.Database) *SessionRepository {
 	return &SessionRepository{
 		sessions: db.Collection("sessions"),
 		messages: db.Collection("messages"),
+		usage:    db.Collection("usage_records"),
 	}
 }
 
@@ -80,6 +87,22 @@ func (r *SessionRepository) UpdateSession(ctx context.Context, id primitive.Obje
 	return err
 }
 
+// UpdateAttributes replaces the session's persistent agent attributes
+func (r *SessionRepository) UpdateAttributes(ctx context.Context, id primitive.ObjectID, attributes models.AgentAttributes) error {
+	_, err := r.sessions.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$set": bson.M{
+				"session_attributes":        attributes.SessionAttributes,
+				"prompt_session_attributes": attributes.PromptSessionAttributes,
+				"updated_at":                time.Now(),
+			},
+		},
+	)
+	return err
+}
+
 func (r *SessionRepository) DeleteSession(ctx context.Context, id primitive.ObjectID) error {
 	// Delete all messages in the session
 	_, err := r.messages.DeleteMany(ctx, bson.M{"session_id": id})
@@ -92,9 +115,53 @@ func (r *SessionRepository) DeleteSession(ctx context.Context, id primitive.Obje
 	return err
 }
 
+// GetMessages returns the messages of the session's active branch
 func (r *SessionRepository) GetMessages(ctx context.Context, sessionID primitive.ObjectID) ([]models.Message, error) {
+	session, err := r.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetActiveMessages(ctx, session)
+}
+
+// GetActiveMessages returns the messages of the session's active branch,
+// including those inherited from its parent branches
+func (r *SessionRepository) GetActiveMessages(ctx context.Context, session *models.Session) ([]models.Message, error) {
+	return r.getVisibleMessages(ctx, session, session.ActiveBranchID)
+}
+
+// getVisibleMessages returns a branch's messages with inherited ones, leaving out
+// those before the branch's summary cutoff
+func (r *SessionRepository) getVisibleMessages(ctx context.Context, session *models.Session, branchID string) ([]models.Message, error) {
+	messages, err := r.getBranchMessages(ctx, session, branchID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := session.SummaryCutoff(branchID)
+	if cutoff.IsZero() {
+		return messages, nil
+	}
+	visible := messages[:0]
+	for _, message := range messages {
+		if !message.CreatedAt.Before(cutoff) {
+			visible = append(visible, message)
+		}
+	}
+	return visible, nil
+}
+
+// getBranchMessages returns a branch's messages (created before the limit, if set)
+// preceded by the parent branch messages it shares
+func (r *SessionRepository) getBranchMessages(ctx context.Context, session *models.Session, branchID string, before *time.Time) ([]models.Message, error) {
+	filter := bson.M{"session_id": session.ID, "branch_id": branchFilter(branchID)}
+	if before != nil {
+		filter["created_at"] = bson.M{"$lt": *before}
+	}
+
 	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
-	cursor, err := r.messages.Find(ctx, bson.M{"session_id": sessionID}, opts)
+	cursor, err := r.messages.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -105,30 +172,169 @@ func (r *SessionRepository) GetMessages(ctx context.Context, sessionID primitive
 		return nil, err
 	}
 
-	if messages == nil {
-		messages = []models.Message{}
+	branch := session.FindBranch(branchID)
+	if models.IsMainBranch(branchID) || branch == nil {
+		if messages == nil {
+			messages = []models.Message{}
+		}
+		return messages, nil
 	}
-	return messages, nil
+
+	// Inherit the parent's messages up to the fork point
+	limit := branch.ForkedAt
+	if before != nil && before.Before(limit) {
+		limit = *before
+	}
+	inherited, err := r.getBranchMessages(ctx, session, branch.ParentBranchID, &limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(inherited, messages...), nil
 }
 
+// branchFilter matches the messages of a branch; main branch messages have no branch_id
+func branchFilter(branchID string) interface{} {
+	if models.IsMainBranch(branchID) {
+		return bson.M{"$in": bson.A{nil, "", models.MainBranchID}}
+	}
+	return branchID
+}
+
+// SaveMessage stores a message in the branch set on it ("" for the main branch)
 func (r *SessionRepository) SaveMessage(ctx context.Context, message *models.Message) error {
 	message.ID = primitive.NewObjectID()
 	message.CreatedAt = time.Now()
 
+	// Roll the invocation's token usage up onto the message
+	if message.Usage == nil && message.Trace != nil {
+		message.Usage = message.Trace.Usage
+	}
+
+	// Main branch messages are stored without a branch_id
+	if models.IsMainBranch(message.BranchID) {
+		message.BranchID = ""
+	}
+
 	_, err := r.messages.InsertOne(ctx, message)
 	if err != nil {
 		return err
 	}
 
-	// Update session's updated_at
+	// The message is stored, a missing usage record must not make callers save it again
+	if err := r.saveUsageRecord(ctx, agentUsageRecord(message.SessionID, message.ID, message.Trace, message.Usage, message.CreatedAt)); err != nil {
+		log.Printf("Warning: Failed to save usage record of message %s: %v", message.ID.Hex(), err)
+	}
+
+	// Update session's updated_at, usage and guardrail totals
 	_, err = r.sessions.UpdateOne(
 		ctx,
 		bson.M{"_id": message.SessionID},
-		bson.M{"$set": bson.M{"updated_at": time.Now()}},
+		sessionTotalsUpdate(message.Usage, message.Trace.GuardrailHits()),
 	)
 	return err
 }
 
+// sessionTotalsUpdate touches updated_at and adds usage and guardrail hits to the session's totals
+func sessionTotalsUpdate(usage *models.TokenUsage, guardrailHits int) bson.M {
+	update := bson.M{"$set": bson.M{"updated_at": time.Now()}}
+	inc := bson.M{}
+	if usage != nil {
+		inc["usage.input_tokens"] = usage.InputTokens
+		inc["usage.output_tokens"] = usage.OutputTokens
+		inc["usage.cost"] = usage.Cost
+	}
+	if guardrailHits > 0 {
+		inc["guardrail_hits"] = guardrailHits
+	}
+	if len(inc) > 0 {
+		update["$inc"] = inc
+	}
+	return update
+}
+
+func (r *SessionRepository) GetMessage(ctx context.Context, id primitive.ObjectID) (*models.Message, error) {
+	var message models.Message
+	err := r.messages.FindOne(ctx, bson.M{"_id": id}).Decode(&message)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// GetPreviousUserMessage returns the latest user message before a message in
+// the message's branch, including the messages the branch inherits
+func (r *SessionRepository) GetPreviousUserMessage(ctx context.Context, message *models.Message) (*models.Message, error) {
+	session, err := r.GetSession(ctx, message.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := r.getBranchMessages(ctx, session, message.BranchID, &message.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return &messages[i], nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+// AddMessageVersion moves the current content of a message into its alternates
+// and replaces it with a new version
+func (r *SessionRepository) AddMessageVersion(ctx context.Context, message *models.Message, content string, trace *models.Trace, status string) error {
+	previous := models.MessageVersion{
+		Content:    message.Content,
+		Trace:      message.Trace,
+		Citations:  message.Citations,
+		Usage:      message.Usage,
+		Status:     message.Status,
+		ReplacedAt: time.Now(),
+	}
+
+	var usage *models.TokenUsage
+	if trace != nil {
+		usage = trace.Usage
+	}
+
+	_, err := r.messages.UpdateOne(
+		ctx,
+		bson.M{"_id": message.ID},
+		bson.M{
+			"$push": bson.M{"alternates": previous},
+			"$set": bson.M{
+				"content": content,
+				"trace":   trace,
+				"usage":   usage,
+				"status":  status,
+			},
+			"$unset": bson.M{"citations": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := r.saveUsageRecord(ctx, agentUsageRecord(message.SessionID, message.ID, trace, usage, time.Now())); err != nil {
+		log.Printf("Warning: Failed to save usage record of message %s: %v", message.ID.Hex(), err)
+	}
+
+	// The replaced version's tokens and guardrail hits still count, add the new ones
+	if _, err := r.sessions.UpdateOne(ctx, bson.M{"_id": message.SessionID}, sessionTotalsUpdate(usage, trace.GuardrailHits())); err != nil {
+		return err
+	}
+
+	message.Alternates = append(message.Alternates, previous)
+	message.Content = content
+	message.Trace = trace
+	message.Citations = nil
+	message.Usage = usage
+	message.Status = status
+	return nil
+}
+
 func (r *SessionRepository) UpdateMessageTrace(ctx context.Context, messageID primitive.ObjectID, trace *models.Trace) error {
 	_, err := r.messages.UpdateOne(
 		ctx,
@@ -138,75 +344,125 @@ func (r *SessionRepository) UpdateMessageTrace(ctx context.Context, messageID pr
 	return err
 }
 
-// ClearMessages deletes all messages for a session
+// UpdateMessageCitations stores the knowledge base citations of a message
+func (r *SessionRepository) UpdateMessageCitations(ctx context.Context, messageID primitive.ObjectID, citations []models.Citation) error {
+	_, err := r.messages.UpdateOne(
+		ctx,
+		bson.M{"_id": messageID},
+		bson.M{"$set": bson.M{"citations": citations}},
+	)
+	return err
+}
+
+// ClearMessages deletes all messages for a session, including every branch
 func (r *SessionRepository) ClearMessages(ctx context.Context, sessionID primitive.ObjectID) error {
 	_, err := r.messages.DeleteMany(ctx, bson.M{"session_id": sessionID})
+	if err != nil {
+		return err
+	}
+
+	// Branches have nothing left to show, go back to the main branch
+	_, err = r.sessions.UpdateOne(
+		ctx,
+		bson.M{"_id": sessionID, "branches": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"branches": "", "active_branch_id": "", "summary_cutoffs": ""}},
+	)
 	return err
 }
 
-// GetMessageCount returns the number of messages in a session
+// GetMessageCount returns the number of messages in the session's active branch,
+// not counting messages inherited from parent branches
 func (r *SessionRepository) GetMessageCount(ctx context.Context, sessionID primitive.ObjectID) (int64, error) {
-	return r.messages.CountDocuments(ctx, bson.M{"session_id": sessionID})
+	session, err := r.GetSession(ctx, sessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.messages.CountDocuments(ctx, bson.M{"session_id": sessionID, "branch_id": branchFilter(session.ActiveBranchID)})
 }
 
-// GetRecentMessages gets the N most recent messages
+// GetRecentMessages gets the N most recent messages of the active branch
 func (r *SessionRepository) GetRecentMessages(ctx context.Context, sessionID primitive.ObjectID, limit int64) ([]models.Message, error) {
-	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
-	cursor, err := r.messages.Find(ctx, bson.M{"session_id": sessionID}, opts)
+	session, err := r.GetSession(ctx, sessionID)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
 
-	var messages []models.Message
-	if err := cursor.All(ctx, &messages); err != nil {
+	messages, err := r.GetActiveMessages(ctx, session)
+	if err != nil {
 		return nil, err
 	}
 
-	// Reverse to get chronological order
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	if int64(len(messages)) > limit {
+		messages = messages[int64(len(messages))-limit:]
 	}
-
 	return messages, nil
 }
 
-// DeleteOldMessages deletes messages except the most recent N
-func (r *SessionRepository) DeleteOldMessages(ctx context.Context, sessionID primitive.ObjectID, keepRecent int64) error {
-	// Get IDs of recent messages to keep
-	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(keepRecent)
-	cursor, err := r.messages.Find(ctx, bson.M{"session_id": sessionID}, opts)
+// DeleteOldMessages hides all but the most recent N messages of a branch behind
+// its summary cutoff, inherited messages included. The branch's own hidden
+// messages are deleted, except those a child branch still inherits.
+func (r *SessionRepository) DeleteOldMessages(ctx context.Context, sessionID primitive.ObjectID, branchID string, keepRecent int64) error {
+	session, err := r.GetSession(ctx, sessionID)
 	if err != nil {
 		return err
 	}
-	defer cursor.Close(ctx)
 
-	var recentMessages []models.Message
-	if err := cursor.All(ctx, &recentMessages); err != nil {
+	messages, err := r.getVisibleMessages(ctx, session, branchID)
+	if err != nil {
 		return err
 	}
+	if keepRecent < 1 || int64(len(messages)) <= keepRecent {
+		return nil
+	}
+	cutoff := messages[int64(len(messages))-keepRecent].CreatedAt
 
-	// Collect IDs to keep
-	keepIDs := make([]primitive.ObjectID, len(recentMessages))
-	for i, msg := range recentMessages {
-		keepIDs[i] = msg.ID
+	if err := r.setSummaryCutoff(ctx, sessionID, branchID, cutoff); err != nil {
+		return err
 	}
 
-	// Delete all except recent
+	createdAt := bson.M{"$lt": cutoff}
+	if inherited := session.LatestChildFork(branchID); !inherited.IsZero() {
+		createdAt["$gte"] = inherited
+	}
 	_, err = r.messages.DeleteMany(ctx, bson.M{
 		"session_id": sessionID,
-		"_id":        bson.M{"$nin": keepIDs},
+		"branch_id":  branchFilter(branchID),
+		"created_at": createdAt,
 	})
 	return err
 }
 
-// RotateAgentSession generates a new AgentBedrock session ID and stores context
-func (r *SessionRepository) RotateAgentSession(ctx context.Context, sessionID primitive.ObjectID, summaryContext string) (string, error) {
-	newAgentSessionID := generateAgentSessionID()
+// setSummaryCutoff stores the time before which a branch's messages are hidden
+func (r *SessionRepository) setSummaryCutoff(ctx context.Context, sessionID primitive.ObjectID, branchID string, cutoff time.Time) error {
+	if models.IsMainBranch(branchID) {
+		branchID = models.MainBranchID
+	}
 
 	_, err := r.sessions.UpdateOne(
 		ctx,
 		bson.M{"_id": sessionID},
+		bson.M{"$set": bson.M{"summary_cutoffs." + branchID: cutoff}},
+	)
+	return err
+}
+
+// RotateAgentSession generates a new AgentBedrock session ID and stores context.
+// The swap only happens if the session still uses currentAgentSessionID, so of
+// two concurrent rotations one fails with ErrSessionRotated.
+func (r *SessionRepository) RotateAgentSession(ctx context.Context, sessionID primitive.ObjectID, currentAgentSessionID, summaryContext string) (string, error) {
+	newAgentSessionID := generateAgentSessionID()
+
+	// Sessions without an agent session ID use their MongoDB ID
+	current := bson.M{"agent_session_id": currentAgentSessionID}
+	if currentAgentSessionID == sessionID.Hex() {
+		current = bson.M{"agent_session_id": bson.M{"$in": bson.A{currentAgentSessionID, "", nil}}}
+	}
+	current["_id"] = sessionID
+
+	result, err := r.sessions.UpdateOne(
+		ctx,
+		current,
 		bson.M{
 			"$set": bson.M{
 				"agent_session_id": newAgentSessionID,
@@ -218,6 +474,9 @@ func (r *SessionRepository) RotateAgentSession(ctx context.Context, sessionID pr
 	if err != nil {
 		return "", err
 	}
+	if result.MatchedCount == 0 {
+		return "", ErrSessionRotated
+	}
 
 	return newAgentSessionID, nil
 }
@@ -236,3 +495,50 @@ func (r *SessionRepository) ClearSummaryContext(ctx context.Context, sessionID p
 	)
 	return err
 }
+
+// CreateBranch gives the branch a new AgentBedrock session ID, appends it to the
+// session's branches and makes it the active branch
+func (r *SessionRepository) CreateBranch(ctx context.Context, session *models.Session, branch *models.Branch) error {
+	branch.AgentSessionID = generateAgentSessionID()
+	branch.CreatedAt = time.Now()
+
+	branches := append(session.Branches, *branch)
+	if err := r.UpdateBranches(ctx, session.ID, branches, branch.ID, branch.AgentSessionID, branch.SummaryContext); err != nil {
+		return err
+	}
+
+	// What the parent summarized away stays hidden in the branch
+	if cutoff := session.SummaryCutoff(branch.ParentBranchID); !cutoff.IsZero() {
+		if err := r.setSummaryCutoff(ctx, session.ID, branch.ID, cutoff); err != nil {
+			return err
+		}
+		if session.SummaryCutoffs == nil {
+			session.SummaryCutoffs = map[string]time.Time{}
+		}
+		session.SummaryCutoffs[branch.ID] = cutoff
+	}
+
+	session.Branches = branches
+	session.ActiveBranchID = branch.ID
+	session.AgentSessionID = branch.AgentSessionID
+	session.SummaryContext = branch.SummaryContext
+	return nil
+}
+
+// UpdateBranches stores the branch list and makes activeBranchID the active branch
+func (r *SessionRepository) UpdateBranches(ctx context.Context, sessionID primitive.ObjectID, branches []models.Branch, activeBranchID, agentSessionID, summaryContext string) error {
+	_, err := r.sessions.UpdateOne(
+		ctx,
+		bson.M{"_id": sessionID},
+		bson.M{
+			"$set": bson.M{
+				"branches":         branches,
+				"active_branch_id": activeBranchID,
+				"agent_session_id": agentSessionID,
+				"summary_context":  summaryContext,
+				"updated_at":       time.Now(),
+			},
+		},
+	)
+	return err
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SessionLeaseRepository struct {
+	leases *mongo.Collection
+}
+
+func NewSessionLeaseRepository(db *mongo.Database) *SessionLeaseRepository {
+	return &SessionLeaseRepository{
+		leases: db.Collection("session_leases"),
+	}
+}
+
+// EnsureIndexes creates the TTL index that removes expired leases.
+// Mongo's TTL monitor runs about once a minute, so AcquireLease also takes over
+// expired leases itself.
+func (r *SessionLeaseRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.leases.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// AcquireLease takes the session's lease for holder if it is free or expired.
+// It returns false if another holder has a live lease.
+func (r *SessionLeaseRepository) AcquireLease(ctx context.Context, sessionID primitive.ObjectID, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	// A live lease doesn't match the filter, so the upsert collides with its _id
+	_, err := r.leases.UpdateOne(
+		ctx,
+		bson.M{"_id": sessionID, "expires_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{
+			"holder":      holder,
+			"acquired_at": now,
+			"expires_at":  now.Add(ttl),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RenewLease extends the holder's lease. It returns false if the lease was lost
+// (it expired and another holder took it).
+func (r *SessionLeaseRepository) RenewLease(ctx context.Context, sessionID primitive.ObjectID, holder string, ttl time.Duration) (bool, error) {
+	result, err := r.leases.UpdateOne(
+		ctx,
+		bson.M{"_id": sessionID, "holder": holder},
+		bson.M{"$set": bson.M{"expires_at": time.Now().Add(ttl)}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// ReleaseLease deletes the holder's lease, leaving other holders' leases alone
+func (r *SessionLeaseRepository) ReleaseLease(ctx context.Context, sessionID primitive.ObjectID, holder string) error {
+	_, err := r.leases.DeleteOne(ctx, bson.M{"_id": sessionID, "holder": holder})
+	return err
+}
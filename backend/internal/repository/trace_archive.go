@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"github.com/ui-agentbedrock/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxInlineTraceArchive is the largest archive stored inside its document,
+// bigger ones go to GridFS to stay clear of the 16MB document limit
+const maxInlineTraceArchive = 1 << 20
+
+type TraceArchiveRepository struct {
+	archives *mongo.Collection
+	bucket   *gridfs.Bucket
+}
+
+func NewTraceArchiveRepository(db *mongo.Database) *TraceArchiveRepository {
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName("trace_archives"))
+	if err != nil {
+		panic("Failed to create GridFS bucket: " + err.Error())
+	}
+
+	return &TraceArchiveRepository{
+		archives: db.Collection("trace_archives"),
+		bucket:   bucket,
+	}
+}
+
+// EnsureIndexes creates the indexes used to look up and expire archives
+func (r *TraceArchiveRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.archives.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "trace_id", Value: 1}}},
+		{Keys: bson.D{{Key: "created_at", Value: 1}}},
+	})
+	return err
+}
+
+// SaveTraceArchive stores the raw trace JSON inline or in GridFS, depending on its size
+func (r *TraceArchiveRepository) SaveTraceArchive(ctx context.Context, archive *models.TraceArchive, data []byte) error {
+	archive.ID = primitive.NewObjectID()
+	archive.CreatedAt = time.Now()
+	archive.Size = int64(len(data))
+
+	if len(data) > maxInlineTraceArchive {
+		if err := r.bucket.UploadFromStreamWithID(archive.ID, archive.TraceID+".json", bytes.NewReader(data)); err != nil {
+			return err
+		}
+		archive.GridFSID = &archive.ID
+	} else {
+		archive.Data = data
+	}
+
+	_, err := r.archives.InsertOne(ctx, archive)
+	return err
+}
+
+// GetTraceArchive returns the archive of a trace
+func (r *TraceArchiveRepository) GetTraceArchive(ctx context.Context, traceID string) (*models.TraceArchive, error) {
+	var archive models.TraceArchive
+	err := r.archives.FindOne(ctx, bson.M{"trace_id": traceID}).Decode(&archive)
+	if err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+// OpenTraceArchive returns a reader over the raw trace JSON of an archive
+func (r *TraceArchiveRepository) OpenTraceArchive(ctx context.Context, archive *models.TraceArchive) (io.ReadCloser, error) {
+	if archive.GridFSID == nil {
+		return io.NopCloser(bytes.NewReader(archive.Data)), nil
+	}
+	return r.bucket.OpenDownloadStream(*archive.GridFSID)
+}
+
+// DeleteTraceArchivesBefore deletes archives created before the given time
+func (r *TraceArchiveRepository) DeleteTraceArchivesBefore(ctx context.Context, before time.Time) (int64, error) {
+	return r.deleteTraceArchives(ctx, bson.M{"created_at": bson.M{"$lt": before}})
+}
+
+// DeleteTraceArchivesOverSize deletes the oldest archives until the rest fit in maxBytes
+func (r *TraceArchiveRepository) DeleteTraceArchivesOverSize(ctx context.Context, maxBytes int64) (int64, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetProjection(bson.M{"_id": 1, "size": 1})
+	cursor, err := r.archives.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var total int64
+	var expired []primitive.ObjectID
+	for cursor.Next(ctx) {
+		var archive models.TraceArchive
+		if err := cursor.Decode(&archive); err != nil {
+			return 0, err
+		}
+		total += archive.Size
+		if total > maxBytes {
+			expired = append(expired, archive.ID)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, err
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	return r.deleteTraceArchives(ctx, bson.M{"_id": bson.M{"$in": expired}})
+}
+
+// deleteTraceArchives deletes the matching archives and their GridFS files
+func (r *TraceArchiveRepository) deleteTraceArchives(ctx context.Context, filter bson.M) (int64, error) {
+	gridFSFilter := bson.M{"$and": bson.A{filter, bson.M{"gridfs_id": bson.M{"$exists": true}}}}
+	cursor, err := r.archives.Find(ctx, gridFSFilter, options.Find().SetProjection(bson.M{"gridfs_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var archive models.TraceArchive
+		if err := cursor.Decode(&archive); err != nil {
+			return 0, err
+		}
+		if err := r.bucket.Delete(*archive.GridFSID); err != nil && err != gridfs.ErrFileNotFound {
+			return 0, err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, err
+	}
+
+	result, err := r.archives.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ui-agentbedrock/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// agentUsageRecord builds the usage record of an agent reply, split per model by
+// the usage of its trace steps. It returns nil if the reply reported no usage.
+func agentUsageRecord(sessionID, messageID primitive.ObjectID, trace *models.Trace, usage *models.TokenUsage, createdAt time.Time) *models.UsageRecord {
+	if usage == nil {
+		return nil
+	}
+
+	record := &models.UsageRecord{
+		SessionID:  sessionID,
+		MessageID:  messageID,
+		Kind:       "agent",
+		TokenUsage: *usage,
+		CreatedAt:  createdAt,
+	}
+	if trace == nil {
+		return record
+	}
+
+	byModel := make(map[string]int)
+	for _, step := range trace.AgentSteps {
+		if step.Usage == nil {
+			continue
+		}
+		i, ok := byModel[step.Model]
+		if !ok {
+			i = len(record.Models)
+			byModel[step.Model] = i
+			record.Models = append(record.Models, models.ModelUsage{Model: step.Model})
+		}
+		record.Models[i].Add(*step.Usage)
+	}
+	return record
+}
+
+// saveUsageRecord stores a usage record; nil records are skipped
+func (r *SessionRepository) saveUsageRecord(ctx context.Context, record *models.UsageRecord) error {
+	if record == nil {
+		return nil
+	}
+
+	record.ID = primitive.NewObjectID()
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	_, err := r.usage.InsertOne(ctx, record)
+	return err
+}
+
+// SaveSummaryUsage records the usage of a summarization and adds it to the session's totals
+func (r *SessionRepository) SaveSummaryUsage(ctx context.Context, sessionID primitive.ObjectID, model string, usage models.TokenUsage) error {
+	err := r.saveUsageRecord(ctx, &models.UsageRecord{
+		SessionID:  sessionID,
+		Kind:       "summary",
+		Models:     []models.ModelUsage{{Model: model, TokenUsage: usage}},
+		TokenUsage: usage,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.sessions.UpdateOne(ctx, bson.M{"_id": sessionID}, sessionTotalsUpdate(&usage, 0))
+	return err
+}
+
+// EnsureUsageIndexes creates the indexes of the usage reports and, on first
+// start, backfills the records of messages saved before usage records existed
+func (r *SessionRepository) EnsureUsageIndexes(ctx context.Context) error {
+	_, err := r.usage.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "session_id", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "created_at", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	count, err := r.usage.EstimatedDocumentCount(ctx)
+	if err != nil || count > 0 {
+		return err
+	}
+	return r.backfillUsageRecords(ctx)
+}
+
+// backfillUsageRecords creates the records of the current and replaced versions
+// of existing messages. Messages already summarized away can't be recovered.
+func (r *SessionRepository) backfillUsageRecords(ctx context.Context) error {
+	filter := bson.M{"role": "assistant", "$or": bson.A{
+		bson.M{"usage": bson.M{"$exists": true}},
+		bson.M{"alternates.usage": bson.M{"$exists": true}},
+	}}
+	cursor, err := r.messages.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var message models.Message
+		if err := cursor.Decode(&message); err != nil {
+			return err
+		}
+
+		for _, version := range message.Alternates {
+			if err := r.saveUsageRecord(ctx, agentUsageRecord(message.SessionID, message.ID, version.Trace, version.Usage, version.ReplacedAt)); err != nil {
+				return err
+			}
+		}
+		if err := r.saveUsageRecord(ctx, agentUsageRecord(message.SessionID, message.ID, message.Trace, message.Usage, message.CreatedAt)); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// usageMatch selects usage records, optionally in a time range
+func usageMatch(extra bson.M, from, to *time.Time) bson.M {
+	match := bson.M{}
+	for key, value := range extra {
+		match[key] = value
+	}
+
+	createdAt := bson.M{}
+	if from != nil {
+		createdAt["$gte"] = *from
+	}
+	if to != nil {
+		createdAt["$lt"] = *to
+	}
+	if len(createdAt) > 0 {
+		match["created_at"] = createdAt
+	}
+	return match
+}
+
+// GetUsageByModel sums the usage of matching records per foundation model
+func (r *SessionRepository) GetUsageByModel(ctx context.Context, filter bson.M, from, to *time.Time) ([]models.UsageBreakdown, error) {
+	pipeline := bson.A{
+		bson.M{"$match": usageMatch(filter, from, to)},
+		bson.M{"$unwind": "$models"},
+		bson.M{"$group": bson.M{
+			"_id":           "$models.model",
+			"messages":      bson.M{"$sum": 1},
+			"input_tokens":  bson.M{"$sum": "$models.input_tokens"},
+			"output_tokens": bson.M{"$sum": "$models.output_tokens"},
+			"cost":          bson.M{"$sum": "$models.cost"},
+		}},
+		bson.M{"$sort": bson.M{"cost": -1}},
+	}
+
+	return r.aggregateUsage(ctx, pipeline)
+}
+
+// GetUsageBySession sums the usage of matching records per session, most expensive first
+func (r *SessionRepository) GetUsageBySession(ctx context.Context, filter bson.M, from, to *time.Time) ([]models.UsageBreakdown, error) {
+	pipeline := bson.A{
+		bson.M{"$match": usageMatch(filter, from, to)},
+		bson.M{"$group": bson.M{
+			"_id":           "$session_id",
+			"messages":      bson.M{"$sum": 1},
+			"input_tokens":  bson.M{"$sum": "$input_tokens"},
+			"output_tokens": bson.M{"$sum": "$output_tokens"},
+			"cost":          bson.M{"$sum": "$cost"},
+		}},
+		bson.M{"$lookup": bson.M{
+			"from":         "sessions",
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "session",
+		}},
+		bson.M{"$unwind": bson.M{"path": "$session", "preserveNullAndEmptyArrays": true}},
+		bson.M{"$project": bson.M{
+			"_id":           bson.M{"$toString": "$_id"},
+			"label":         "$session.title",
+			"agent_key":     "$session.agent_key",
+			"messages":      1,
+			"input_tokens":  1,
+			"output_tokens": 1,
+			"cost":          1,
+		}},
+		bson.M{"$sort": bson.M{"cost": -1}},
+	}
+
+	return r.aggregateUsage(ctx, pipeline)
+}
+
+func (r *SessionRepository) aggregateUsage(ctx context.Context, pipeline bson.A) ([]models.UsageBreakdown, error) {
+	cursor, err := r.usage.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var breakdown []models.UsageBreakdown
+	if err := cursor.All(ctx, &breakdown); err != nil {
+		return nil, err
+	}
+
+	if breakdown == nil {
+		breakdown = []models.UsageBreakdown{}
+	}
+	return breakdown, nil
+}
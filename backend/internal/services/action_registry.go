@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/ui-agentbedrock/backend/internal/models"
+)
+
+// maxReturnControlRounds limits how many times one message can hand control back
+// to the backend, so a misbehaving agent can't loop forever
+const maxReturnControlRounds = 10
+
+// ActionCall is a return-of-control request for a backend action.
+// Function holds the function name, or the API path for OpenAPI action groups.
+type ActionCall struct {
+	ActionGroup string
+	Function    string
+	HTTPMethod  string            // Only set for OpenAPI action groups
+	Parameters  map[string]string // Function/API parameters and request body properties
+
+	invocationType types.ActionInvocationType
+}
+
+// needsConfirmation reports whether the user must approve the call first
+func (c ActionCall) needsConfirmation() bool {
+	return c.invocationType == types.ActionInvocationTypeUserConfirmation ||
+		c.invocationType == types.ActionInvocationTypeUserConfirmationAndResult
+}
+
+// runsLocally reports whether the backend executes the call. For
+// USER_CONFIRMATION the action group's Lambda runs it after the user confirms.
+func (c ActionCall) runsLocally() bool {
+	return c.invocationType != types.ActionInvocationTypeUserConfirmation
+}
+
+// ActionHandler runs an action and returns the text handed back to the agent
+type ActionHandler func(ctx context.Context, call ActionCall) (string, error)
+
+// ActionRegistry maps action group functions to Go handlers.
+// Action groups configured with "Return control" in Bedrock are executed here
+// instead of in a Lambda.
+type ActionRegistry struct {
+	mu       sync.RWMutex
+	handlers map[string]ActionHandler
+}
+
+func NewActionRegistry() *ActionRegistry {
+	return &ActionRegistry{
+		handlers: make(map[string]ActionHandler),
+	}
+}
+
+// Register sets the handler for a function (or API path) of an action group
+func (r *ActionRegistry) Register(actionGroup, function string, handler ActionHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[actionKey(actionGroup, function)] = handler
+}
+
+// Lookup returns the handler for a function of an action group
+func (r *ActionRegistry) Lookup(actionGroup, function string) (ActionHandler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	handler, ok := r.handlers[actionKey(actionGroup, function)]
+	return handler, ok
+}
+
+// Execute runs the handler for a call. Missing handlers are reported as errors
+// so the agent can recover instead of the invocation failing.
+func (r *ActionRegistry) Execute(ctx context.Context, call ActionCall) (string, error) {
+	handler, ok := r.Lookup(call.ActionGroup, call.Function)
+	if !ok {
+		return "", fmt.Errorf("no handler registered for %s/%s", call.ActionGroup, call.Function)
+	}
+	return handler(ctx, call)
+}
+
+func actionKey(actionGroup, function string) string {
+	return actionGroup + "/" + function
+}
+
+// RegisterBuiltinActions registers the actions every deployment gets.
+// Add a "backend" action group with return control to the agent to use them.
+func RegisterBuiltinActions(r *ActionRegistry) {
+	r.Register("backend", "get_current_time", func(ctx context.Context, call ActionCall) (string, error) {
+		location := time.UTC
+		if name := call.Parameters["timezone"]; name != "" {
+			loaded, err := time.LoadLocation(name)
+			if err != nil {
+				return "", fmt.Errorf("unknown timezone %q", name)
+			}
+			location = loaded
+		}
+		return time.Now().In(location).Format(time.RFC3339), nil
+	})
+}
+
+// actionCallFromInput converts a return-of-control invocation input into an ActionCall
+func actionCallFromInput(input types.InvocationInputMember) (ActionCall, bool) {
+	switch v := input.(type) {
+	case *types.InvocationInputMemberMemberFunctionInvocationInput:
+		call := ActionCall{
+			ActionGroup:    aws.ToString(v.Value.ActionGroup),
+			Function:       aws.ToString(v.Value.Function),
+			Parameters:     make(map[string]string, len(v.Value.Parameters)),
+			invocationType: v.Value.ActionInvocationType,
+		}
+		for _, param := range v.Value.Parameters {
+			call.Parameters[aws.ToString(param.Name)] = aws.ToString(param.Value)
+		}
+		return call, true
+
+	case *types.InvocationInputMemberMemberApiInvocationInput:
+		call := ActionCall{
+			ActionGroup:    aws.ToString(v.Value.ActionGroup),
+			Function:       aws.ToString(v.Value.ApiPath),
+			HTTPMethod:     aws.ToString(v.Value.HttpMethod),
+			Parameters:     make(map[string]string, len(v.Value.Parameters)),
+			invocationType: v.Value.ActionInvocationType,
+		}
+		for _, param := range v.Value.Parameters {
+			call.Parameters[aws.ToString(param.Name)] = aws.ToString(param.Value)
+		}
+		if v.Value.RequestBody != nil {
+			for _, content := range v.Value.RequestBody.Content {
+				for _, prop := range content.Properties {
+					call.Parameters[aws.ToString(prop.Name)] = aws.ToString(prop.Value)
+				}
+			}
+		}
+		return call, true
+	}
+
+	return ActionCall{}, false
+}
+
+// actionResult builds the invocation result sent back to the agent for a call.
+// confirmation is empty unless the user was asked to confirm the call.
+func actionResult(call ActionCall, output string, err error, confirmation types.ConfirmationState) types.InvocationResultMember {
+	state := types.ResponseState("")
+	statusCode := int32(200)
+	if err != nil {
+		output = err.Error()
+		state = types.ResponseStateFailure
+		statusCode = 500
+	}
+
+	if call.HTTPMethod != "" {
+		return &types.InvocationResultMemberMemberApiResult{
+			Value: types.ApiResult{
+				ActionGroup:       aws.String(call.ActionGroup),
+				ApiPath:           aws.String(call.Function),
+				HttpMethod:        aws.String(call.HTTPMethod),
+				HttpStatusCode:    aws.Int32(statusCode),
+				ResponseBody:      map[string]types.ContentBody{"application/json": {Body: aws.String(output)}},
+				ResponseState:     state,
+				ConfirmationState: confirmation,
+			},
+		}
+	}
+
+	return &types.InvocationResultMemberMemberFunctionResult{
+		Value: types.FunctionResult{
+			ActionGroup:       aws.String(call.ActionGroup),
+			Function:          aws.String(call.Function),
+			ResponseBody:      map[string]types.ContentBody{"TEXT": {Body: aws.String(output)}},
+			ResponseState:     state,
+			ConfirmationState: confirmation,
+		},
+	}
+}
+
+// runReturnControl executes the actions of a return-of-control payload,
+// reporting each one as an action step, and returns the results for the agent
+func (s *AgentService) runReturnControl(ctx context.Context, payload *types.ReturnControlPayload, stepIndex *int, trace *models.Trace, callback StreamCallback) []types.InvocationResultMember {
+	results := make([]types.InvocationResultMember, 0, len(payload.InvocationInputs))
+
+	for _, input := range payload.InvocationInputs {
+		call, ok := actionCallFromInput(input)
+		if !ok {
+			continue
+		}
+
+		*stepIndex++
+		step := models.AgentStep{
+			StepIndex: *stepIndex,
+			AgentName: call.ActionGroup,
+			AgentID:   s.agentID,
+			Type:      "action",
+			Action:    fmt.Sprintf("Function: %s", call.Function),
+			Status:    "running",
+			Input:     toJSON(call.Parameters),
+			StartTime: time.Now(),
+		}
+		if call.HTTPMethod != "" {
+			step.Action = fmt.Sprintf("API: %s %s", call.HTTPMethod, call.Function)
+		}
+		callback(models.SSEEvent{Event: "agent_step", Data: stepEvent(step)})
+
+		var output string
+		var confirmation types.ConfirmationState
+		var err error
+		if s.replay != nil {
+			// Replays hand the agent what the recorded run did
+			output, confirmation, err = s.replay.actionResult(aws.ToString(payload.InvocationId), call)
+		} else {
+			output, confirmation, err = s.runAction(ctx, call, step.StepIndex, trace, callback)
+		}
+
+		step.EndTime = time.Now()
+		step.Duration = step.EndTime.Sub(step.StartTime).Milliseconds()
+		step.Status = "success"
+		step.Output = truncateString(output, 500)
+		if err != nil {
+			step.Status = "error"
+			step.Output = err.Error()
+		} else if confirmation == types.ConfirmationStateDeny {
+			step.Status = "cancelled"
+		}
+		trace.AgentSteps = append(trace.AgentSteps, step)
+		callback(models.SSEEvent{Event: "agent_step", Data: stepEvent(step)})
+
+		results = append(results, actionResult(call, output, err, confirmation))
+
+		// Stopped while waiting for the user, don't run the remaining actions
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return results
+}
+
+// runAction runs an action, asking the user first if it requires confirmation.
+// The confirmation state is empty unless the user was asked.
+func (s *AgentService) runAction(ctx context.Context, call ActionCall, stepIndex int, trace *models.Trace, callback StreamCallback) (string, types.ConfirmationState, error) {
+	var confirmation types.ConfirmationState
+	if call.needsConfirmation() {
+		record := s.confirmAction(ctx, call, stepIndex, callback)
+		trace.Confirmations = append(trace.Confirmations, record)
+
+		confirmation = types.ConfirmationStateDeny
+		if record.Decision == "approved" {
+			confirmation = types.ConfirmationStateConfirm
+		}
+	}
+
+	switch {
+	case confirmation == types.ConfirmationStateDeny:
+		return "The user denied this action.", confirmation, nil
+	case !call.runsLocally():
+		return "The user approved this action.", confirmation, nil
+	case s.actions == nil:
+		return "", confirmation, fmt.Errorf("no action handlers are configured")
+	default:
+		output, err := s.actions.Execute(ctx, call)
+		return output, confirmation, err
+	}
+}
+
+// confirmAction sends a confirmation_required event and waits for the user's
+// decision. Without a confirmation registry, or if the user doesn't answer in
+// time, the action is denied.
+func (s *AgentService) confirmAction(ctx context.Context, call ActionCall, stepIndex int, callback StreamCallback) models.Confirmation {
+	record := models.Confirmation{
+		StepIndex:   stepIndex,
+		ActionGroup: call.ActionGroup,
+		Function:    call.Function,
+		Parameters:  call.Parameters,
+		Decision:    "expired",
+		RequestedAt: time.Now(),
+	}
+
+	if s.confirmations != nil {
+		record.ID = s.confirmations.Open(SessionIDFromContext(ctx))
+		callback(models.SSEEvent{
+			Event: "confirmation_required",
+			Data: models.ConfirmationRequiredEvent{
+				ConfirmationID: record.ID,
+				StepIndex:      stepIndex,
+				ActionGroup:    call.ActionGroup,
+				Function:       call.Function,
+				HTTPMethod:     call.HTTPMethod,
+				Parameters:     call.Parameters,
+			},
+		})
+
+		if approved, decided := s.confirmations.Wait(ctx, record.ID); decided {
+			record.Decision = "denied"
+			if approved {
+				record.Decision = "approved"
+			}
+		}
+	}
+	record.DecidedAt = time.Now()
+
+	callback(models.SSEEvent{
+		Event: "confirmation_resolved",
+		Data:  models.ConfirmationResolvedEvent{ConfirmationID: record.ID, Decision: record.Decision},
+	})
+	return record
+}
+
+// stepEvent converts a step to its agent_step event
+func stepEvent(step models.AgentStep) models.AgentStepEvent {
+	return models.AgentStepEvent{
+		StepIndex:       step.StepIndex,
+		AgentName:       step.AgentName,
+		AgentID:         step.AgentID,
+		Type:            step.Type,
+		Action:          step.Action,
+		Status:          step.Status,
+		Rationale:       step.Rationale,
+		Observation:     step.Observation,
+		Input:           step.Input,
+		Output:          step.Output,
+		Duration:        step.Duration,
+		Model:           step.Model,
+		Usage:           step.Usage,
+		ParentStepIndex: step.ParentStepIndex,
+		Guardrail:       step.Guardrail,
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -15,11 +17,19 @@ import (
 )
 
 type AgentService struct {
-	client       *bedrockagentruntime.Client
-	awsConfig    aws.Config
-	agentID      string
-	agentAliasID string
-	agentName    string // Display name for the main agent
+	runtime       AgentRuntime
+	actions       *ActionRegistry            // Go handlers for return-of-control action groups
+	confirmations *ConfirmationRegistry      // Pending user confirmations of agent actions
+	prices        *PriceTable                // Model prices for token usage cost
+	workflow      *models.WorkflowDefinition // Collaborator pipeline for progress events and fallback answers
+	archive       *TraceArchiveService       // Stores the untruncated raw trace of each invocation
+	retry         RetryPolicy                // Backoff for transient Bedrock errors
+	breaker       *CircuitBreaker            // Fails fast while Bedrock keeps failing, shared by all agents
+	replay        *ReplayRuntime             // Answers return-control rounds with the recorded action results
+	awsConfig     aws.Config
+	agentID       string
+	agentAliasID  string
+	agentName     string // Display name for the main agent
 }
 
 func NewAgentService(agentID, agentAliasID, agentName, region string) (*AgentService, error) {
@@ -28,20 +38,115 @@ func NewAgentService(agentID, agentAliasID, agentName, region string) (*AgentSer
 		return nil, fmt.Errorf("unable to load AWS config: %w", err)
 	}
 
-	client := bedrockagentruntime.NewFromConfig(cfg)
+	runtime := NewBedrockRuntime(bedrockagentruntime.NewFromConfig(cfg))
 
+	return NewAgentServiceWithRuntime(runtime, cfg, agentID, agentAliasID, agentName), nil
+}
+
+// NewAgentServiceWithRuntime creates an AgentService on top of any AgentRuntime
+// (e.g. FakeRuntime for offline development)
+func NewAgentServiceWithRuntime(runtime AgentRuntime, awsConfig aws.Config, agentID, agentAliasID, agentName string) *AgentService {
 	// Default agent name if not provided
 	if agentName == "" {
 		agentName = "Main Agent"
 	}
 
 	return &AgentService{
-		client:       client,
-		awsConfig:    cfg,
+		runtime:      runtime,
+		awsConfig:    awsConfig,
 		agentID:      agentID,
 		agentAliasID: agentAliasID,
 		agentName:    agentName,
-	}, nil
+		retry:        DefaultRetryPolicy,
+	}
+}
+
+// WithRuntime returns a copy of the service that invokes agents through runtime
+// (e.g. a ReplayRuntime for debugging a recorded invocation)
+func (s *AgentService) WithRuntime(runtime AgentRuntime) *AgentService {
+	clone := *s
+	clone.runtime = runtime
+	return &clone
+}
+
+// WithReplay returns a copy of the service that plays back runtime. Return-control
+// rounds are answered with the recorded action results instead of running handlers
+// or asking the user.
+func (s *AgentService) WithReplay(runtime *ReplayRuntime) *AgentService {
+	clone := *s
+	clone.runtime = runtime
+	clone.replay = runtime
+	return &clone
+}
+
+// WithAgent returns a copy of the service that invokes another Bedrock agent
+func (s *AgentService) WithAgent(agentID, agentAliasID, agentName string) *AgentService {
+	clone := *s
+	clone.agentID = agentID
+	clone.agentAliasID = agentAliasID
+	if agentName != "" {
+		clone.agentName = agentName
+	}
+	return &clone
+}
+
+// WithActions returns a copy of the service that runs return-of-control
+// action groups with the registry's handlers
+func (s *AgentService) WithActions(actions *ActionRegistry) *AgentService {
+	clone := *s
+	clone.actions = actions
+	return &clone
+}
+
+// WithConfirmations returns a copy of the service that asks the user to confirm
+// actions through the registry
+func (s *AgentService) WithConfirmations(confirmations *ConfirmationRegistry) *AgentService {
+	clone := *s
+	clone.confirmations = confirmations
+	return &clone
+}
+
+// WithPrices returns a copy of the service that prices token usage with the table
+func (s *AgentService) WithPrices(prices *PriceTable) *AgentService {
+	clone := *s
+	clone.prices = prices
+	return &clone
+}
+
+// WithWorkflow returns a copy of the service that reports progress through the
+// workflow's stages
+func (s *AgentService) WithWorkflow(workflow *models.WorkflowDefinition) *AgentService {
+	clone := *s
+	clone.workflow = workflow
+	return &clone
+}
+
+// WithTraceArchive returns a copy of the service that archives the raw trace of
+// every invocation
+func (s *AgentService) WithTraceArchive(archive *TraceArchiveService) *AgentService {
+	clone := *s
+	clone.archive = archive
+	return &clone
+}
+
+// WithRetry returns a copy of the service that retries transient errors with the policy
+func (s *AgentService) WithRetry(policy RetryPolicy) *AgentService {
+	clone := *s
+	clone.retry = policy
+	return &clone
+}
+
+// WithCircuitBreaker returns a copy of the service that stops invoking Bedrock
+// while the breaker is open
+func (s *AgentService) WithCircuitBreaker(breaker *CircuitBreaker) *AgentService {
+	clone := *s
+	clone.breaker = breaker
+	return &clone
+}
+
+// Runtime returns the AgentRuntime used for invocations
+func (s *AgentService) Runtime() AgentRuntime {
+	return s.runtime
 }
 
 // GetAWSConfig returns the AWS configuration for reuse by other services
@@ -52,6 +157,12 @@ func (s *AgentService) GetAWSConfig() aws.Config {
 type StreamCallback func(event models.SSEEvent) error
 
 func (s *AgentService) InvokeAgentStream(ctx context.Context, sessionID, message string, callback StreamCallback) (*models.Trace, string, error) {
+	return s.InvokeAgentStreamWithAttributes(ctx, sessionID, message, models.AgentAttributes{}, callback)
+}
+
+// InvokeAgentStreamWithAttributes invokes the agent with session and prompt
+// session attributes passed through SessionState
+func (s *AgentService) InvokeAgentStreamWithAttributes(ctx context.Context, sessionID, message string, attributes models.AgentAttributes, callback StreamCallback) (*models.Trace, string, error) {
 	trace := &models.Trace{
 		TraceID:    fmt.Sprintf("trace-%d", time.Now().UnixNano()),
 		AgentSteps: []models.AgentStep{},
@@ -60,6 +171,12 @@ func (s *AgentService) InvokeAgentStream(ctx context.Context, sessionID, message
 	var fullContent string
 	var finalResponseFromTrace string // Capture final response from trace if no content chunks
 	stepIndex := 0
+	citations := newCitationTracker()
+	usage := newUsageTracker(s.prices)
+	defer func() { trace.Usage = usage.totalUsage() }()
+	timeline := newStepTimeline()
+	hierarchy := newStepHierarchy()
+	workflow := newWorkflowTracker(s.workflow)
 
 	// Send thinking event
 	callback(models.SSEEvent{
@@ -75,83 +192,202 @@ func (s *AgentService) InvokeAgentStream(ctx context.Context, sessionID, message
 		EnableTrace:  aws.Bool(true),
 		EndSession:   aws.Bool(false),
 	}
+	if !attributes.IsEmpty() {
+		input.SessionState = &types.SessionState{
+			SessionAttributes:       attributes.SessionAttributes,
+			PromptSessionAttributes: attributes.PromptSessionAttributes,
+		}
+	}
 
-	output, err := s.client.InvokeAgent(ctx, input)
-	if err != nil {
-		errorEvent := models.ErrorEvent{
-			Type:    "InvokeAgentError",
-			Message: err.Error(),
-			Source:  "AgentBedrock",
+	raw := newRawTrace(trace.TraceID, input)
+	defer s.archiveTrace(trace, raw)
+
+	// emit sends an event of the stream to the client. A failed attempt is only
+	// retried before its first event, so the client never sees steps, citations
+	// or content twice.
+	emitted := 0
+	emit := func(event models.SSEEvent) error {
+		emitted++
+		return callback(event)
+	}
+
+	// invoke runs one InvokeAgent call and consumes its stream. It returns the
+	// classified error if the call fails or the stream breaks off.
+	invoke := func(input *bedrockagentruntime.InvokeAgentInput) (*types.ReturnControlPayload, error) {
+		stream, err := s.runtime.InvokeAgent(ContextWithTraceID(ctx, trace.TraceID), input)
+		if err != nil {
+			return nil, classifyError(err, false)
+		}
+		defer stream.Close()
+
+		var returnControl *types.ReturnControlPayload
+		for event := range stream.Events() {
+			raw.observe(event)
+
+			switch v := event.(type) {
+			case *types.ResponseStreamMemberChunk:
+				chunk := string(v.Value.Bytes)
+				offset := utf8.RuneCountInString(fullContent)
+				fullContent += chunk
+				emit(models.SSEEvent{
+					Event: "content",
+					Data:  models.ContentEvent{Chunk: chunk},
+				})
+
+				// Knowledge base citations for this part of the answer
+				for _, citation := range citations.observeAttribution(v.Value.Attribution, offset, utf8.RuneCountInString(chunk)) {
+					emit(models.SSEEvent{Event: "citation", Data: citation})
+				}
+
+			case *types.ResponseStreamMemberTrace:
+				if v.Value.Trace != nil {
+					stepIndex++
+					eventTime := traceEventTime(v.Value, time.Now())
+
+					// Get agent name from trace - use CollaboratorName if available
+					agentName := s.agentName
+					if v.Value.CollaboratorName != nil && *v.Value.CollaboratorName != "" {
+						agentName = *v.Value.CollaboratorName
+					}
+
+					step, traceResponse := s.parseTraceToStepWithResponse(stepIndex, v.Value.Trace, eventTime, agentName)
+					step.Model, step.Usage = usage.observe(v.Value.Trace)
+
+					// References retrieved by knowledge base lookups
+					for _, citation := range citations.observeTrace(v.Value.Trace) {
+						emit(models.SSEEvent{Event: "citation", Data: citation})
+					}
+
+					// Capture final response from trace (for multi-agent collaboration)
+					if traceResponse != "" {
+						finalResponseFromTrace = traceResponse
+					}
+
+					// An output or observation ends the step of its input
+					if index, ok := timeline.finish(v.Value, trace.AgentSteps, &step); ok {
+						emit(models.SSEEvent{Event: "agent_step", Data: stepEvent(trace.AgentSteps[index])})
+					}
+
+					if step.Action != "" { // Only add non-empty steps
+						hierarchy.place(v.Value, &step)
+						timeline.start(v.Value, &step, len(trace.AgentSteps))
+						trace.AgentSteps = append(trace.AgentSteps, step)
+
+						emit(models.SSEEvent{Event: "agent_step", Data: stepEvent(step)})
+
+						if progress, ok := workflow.observe(step); ok {
+							emit(models.SSEEvent{Event: "workflow_progress", Data: progress})
+						}
+
+						if step.Guardrail.Blocked() {
+							emit(models.SSEEvent{
+								Event: "guardrail_blocked",
+								Data: models.GuardrailBlockedEvent{
+									StepIndex:     step.StepIndex,
+									InputBlocked:  step.Guardrail.InputBlocked,
+									OutputBlocked: step.Guardrail.OutputBlocked,
+									Policies:      step.Guardrail.Policies,
+								},
+							})
+						}
+					}
+				}
+
+			case *types.ResponseStreamMemberReturnControl:
+				// The agent hands actions back to the backend, run them once the stream ends
+				returnControl = &v.Value
+			}
 		}
-		callback(models.SSEEvent{Event: "error", Data: errorEvent})
-		trace.Error = &models.ErrorInfo{
-			Type:    errorEvent.Type,
-			Message: errorEvent.Message,
-			Source:  errorEvent.Source,
+
+		// A cancelled request also ends the stream with an error
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			return returnControl, classifyError(err, true)
 		}
-		return trace, "", err
+		return returnControl, nil
 	}
 
-	stream := output.GetStream()
-	defer stream.Close()
+	// Re-invoke with the action results each time the agent returns control
+	for round := 0; ; round++ {
+		var returnControl *types.ReturnControlPayload
+		for attempt := 0; ; attempt++ {
+			if retryAfter, err := s.breaker.Allow(); err != nil {
+				return trace, fullContent, s.failInvocation(trace, classifyError(err, false), retryAfter, callback)
+			}
 
-	for event := range stream.Events() {
-		switch v := event.(type) {
-		case *types.ResponseStreamMemberChunk:
-			chunk := string(v.Value.Bytes)
-			fullContent += chunk
-			callback(models.SSEEvent{
-				Event: "content",
-				Data:  models.ContentEvent{Chunk: chunk},
-			})
+			streamed := emitted
+			var err error
+			returnControl, err = invoke(input)
+			if err == nil {
+				s.breaker.RecordSuccess()
+				break
+			}
+			if ctx.Err() != nil {
+				s.breaker.Release()
+				break
+			}
 
-		case *types.ResponseStreamMemberTrace:
-			if v.Value.Trace != nil {
-				stepIndex++
-				startTime := time.Now()
+			agentErr := classifyError(err, false)
+			if agentErr.degradesService() {
+				s.breaker.RecordFailure()
+			} else {
+				s.breaker.RecordSuccess() // Bedrock answered, the request itself was bad
+			}
+			failRunningSteps(trace, callback)
 
-				// Get agent name from trace - use CollaboratorName if available
-				agentName := s.agentName
-				if v.Value.CollaboratorName != nil && *v.Value.CollaboratorName != "" {
-					agentName = *v.Value.CollaboratorName
-				}
+			// Retrying after part of the stream reached the client would repeat it
+			if !agentErr.Retryable() || emitted != streamed || attempt >= s.retry.MaxRetries {
+				return trace, fullContent, s.failInvocation(trace, agentErr, 0, callback)
+			}
 
-				step, traceResponse := s.parseTraceToStepWithResponse(stepIndex, v.Value.Trace, startTime, agentName)
+			log.Printf("Warning: Agent invocation failed (%s), retrying (%d/%d): %v", agentErr.Class, attempt+1, s.retry.MaxRetries, agentErr.Err)
+			callback(models.SSEEvent{
+				Event: "thinking",
+				Data:  models.ThinkingEvent{Status: "retrying"},
+			})
+			if !s.retry.wait(ctx, attempt) {
+				break
+			}
+		}
 
-				// Capture final response from trace (for multi-agent collaboration)
-				if traceResponse != "" {
-					finalResponseFromTrace = traceResponse
-				}
+		if returnControl == nil || ctx.Err() != nil {
+			break
+		}
+		if round >= maxReturnControlRounds {
+			log.Printf("Warning: Agent returned control more than %d times, stopping", maxReturnControlRounds)
+			break
+		}
 
-				if step.Action != "" { // Only add non-empty steps
-					trace.AgentSteps = append(trace.AgentSteps, step)
-
-					callback(models.SSEEvent{
-						Event: "agent_step",
-						Data: models.AgentStepEvent{
-							StepIndex:   step.StepIndex,
-							AgentName:   step.AgentName,
-							AgentID:     step.AgentID,
-							Type:        step.Type,
-							Action:      step.Action,
-							Status:      step.Status,
-							Rationale:   step.Rationale,
-							Observation: step.Observation,
-							Input:       step.Input,
-							Output:      step.Output,
-							Duration:    step.Duration,
-						},
-					})
-				}
+		results := s.runReturnControl(ctx, returnControl, &stepIndex, trace, callback)
+		if ctx.Err() != nil {
+			break
+		}
+		input = returnControlInput(input, returnControl, results)
+	}
+
+	// Invocation was cancelled - keep the partial content and skip the fallbacks
+	if ctx.Err() != nil {
+		for i := range trace.AgentSteps {
+			if trace.AgentSteps[i].Status == "running" {
+				finishStep(&trace.AgentSteps[i], time.Now(), "cancelled")
 			}
 		}
+
+		callback(models.SSEEvent{
+			Event: "trace",
+			Data: models.TraceEvent{
+				TraceID:    trace.TraceID,
+				AgentSteps: trace.AgentSteps,
+				Tree:       trace.StepTree(),
+			},
+		})
+
+		return trace, fullContent, ctx.Err()
 	}
 
-	// Mark all remaining steps as success
+	// Steps whose output never arrived ran until the end of the stream
 	for i := range trace.AgentSteps {
 		if trace.AgentSteps[i].Status == "running" {
-			trace.AgentSteps[i].Status = "success"
-			trace.AgentSteps[i].EndTime = time.Now()
+			finishStep(&trace.AgentSteps[i], time.Now(), "success")
 		}
 	}
 
@@ -179,15 +415,7 @@ func (s *AgentService) InvokeAgentStream(ctx context.Context, sessionID, message
 
 	// Send final agent step status
 	for _, step := range trace.AgentSteps {
-		callback(models.SSEEvent{
-			Event: "agent_step",
-			Data: models.AgentStepEvent{
-				StepIndex: step.StepIndex,
-				AgentName: step.AgentName,
-				Action:    step.Action,
-				Status:    step.Status,
-			},
-		})
+		callback(models.SSEEvent{Event: "agent_step", Data: stepEvent(step)})
 	}
 
 	// Send trace event
@@ -196,12 +424,35 @@ func (s *AgentService) InvokeAgentStream(ctx context.Context, sessionID, message
 		Data: models.TraceEvent{
 			TraceID:    trace.TraceID,
 			AgentSteps: trace.AgentSteps,
+			Tree:       trace.StepTree(),
 		},
 	})
 
 	return trace, fullContent, nil
 }
 
+// returnControlInput builds the follow-up invocation that hands action results
+// back to the agent, keeping the session attributes of the original input
+func returnControlInput(previous *bedrockagentruntime.InvokeAgentInput, payload *types.ReturnControlPayload, results []types.InvocationResultMember) *bedrockagentruntime.InvokeAgentInput {
+	sessionState := &types.SessionState{
+		InvocationId:                   payload.InvocationId,
+		ReturnControlInvocationResults: results,
+	}
+	if previous.SessionState != nil {
+		sessionState.SessionAttributes = previous.SessionState.SessionAttributes
+		sessionState.PromptSessionAttributes = previous.SessionState.PromptSessionAttributes
+	}
+
+	return &bedrockagentruntime.InvokeAgentInput{
+		AgentId:      previous.AgentId,
+		AgentAliasId: previous.AgentAliasId,
+		SessionId:    previous.SessionId,
+		EnableTrace:  aws.Bool(true),
+		EndSession:   aws.Bool(false),
+		SessionState: sessionState,
+	}
+}
+
 func toJSON(v interface{}) string {
 	b, _ := json.Marshal(v)
 	return string(b)
@@ -220,8 +471,9 @@ func (s *AgentService) parseTraceToStep(stepIndex int, trace types.Trace, startT
 	return step
 }
 
-// parseTraceToStepInternal is the internal implementation that returns step and final response
-func (s *AgentService) parseTraceToStepInternal(stepIndex int, trace types.Trace, startTime time.Time, defaultAgentName string) (models.AgentStep, string) {
+// parseTraceToStepInternal is the internal implementation that returns step and final response.
+// The step starts and ends at eventTime; paired input/output events are timed by stepTimeline.
+func (s *AgentService) parseTraceToStepInternal(stepIndex int, trace types.Trace, eventTime time.Time, defaultAgentName string) (models.AgentStep, string) {
 	step := models.AgentStep{
 		StepIndex: stepIndex,
 		AgentName: defaultAgentName, // Use passed agent name (may come from trace)
@@ -229,10 +481,9 @@ func (s *AgentService) parseTraceToStepInternal(stepIndex int, trace types.Trace
 		Type:      "orchestration",
 		Action:    "",
 		Status:    "success",
-		StartTime: startTime,
-		EndTime:   time.Now(),
+		StartTime: eventTime,
+		EndTime:   eventTime,
 	}
-	step.Duration = step.EndTime.Sub(step.StartTime).Milliseconds()
 
 	var finalResponse string
 
@@ -266,7 +517,7 @@ func (s *AgentService) parseTraceToStepInternal(stepIndex int, trace types.Trace
 
 	case *types.TraceMemberGuardrailTrace:
 		step.Type = "guardrail"
-		step.Action = "Content check"
+		s.parseGuardrailTrace(&step, t.Value)
 	}
 
 	return step, finalResponse
@@ -427,8 +678,7 @@ func (s *AgentService) generateFallbackResponse(steps []models.AgentStep) string
 		return ""
 	}
 
-	// Track which agents were called in the workflow
-	// Expected workflow: DataReader → Analyzer → Auditor → Reporter
+	// Track which agents were called, to report how far the workflow got
 	agentsCalled := make(map[string]bool)
 	var lastCollaboratorName string
 	var lastOutput string
@@ -462,21 +712,11 @@ func (s *AgentService) generateFallbackResponse(steps []models.AgentStep) string
 		}
 	}
 
-	// Check if workflow is complete (Reporter was called = final step)
-	workflowComplete := agentsCalled["Reporter"]
-
-	// Determine workflow status message
-	var statusPrefix string
-	if workflowComplete {
-		statusPrefix = "✅ Audit complete"
-	} else if agentsCalled["Auditor"] {
-		statusPrefix = "⏳ Workflow stopped at Auditor (waiting for Reporter)"
-	} else if agentsCalled["Analyzer"] {
-		statusPrefix = "⏳ Workflow stopped at Analyzer (waiting for Auditor)"
-	} else if agentsCalled["DataReader"] {
-		statusPrefix = "⏳ Workflow stopped at DataReader (waiting for Analyzer)"
-	} else {
-		statusPrefix = "⚠️ No agents were called"
+	// Status line from the agent's workflow definition (empty without one)
+	statusPrefix := workflowStatus(s.workflow, agentsCalled)
+	templates := defaultWorkflowTemplates
+	if s.workflow != nil {
+		templates = s.workflow.Templates
 	}
 
 	// Generate response based on what we found
@@ -485,14 +725,17 @@ func (s *AgentService) generateFallbackResponse(steps []models.AgentStep) string
 		if len(lastOutput) > 2000 {
 			lastOutput = lastOutput[:2000] + "..."
 		}
-		return fmt.Sprintf("%s\n\nLast response from %s:\n%s",
-			statusPrefix, lastCollaboratorName, lastOutput)
+		return strings.TrimSpace(fillWorkflowTemplate(templates.LastResponse, map[string]string{
+			"status": statusPrefix,
+			"agent":  lastCollaboratorName,
+			"output": lastOutput,
+		}))
 	}
 
 	// If we only have action summaries
 	if len(actionsSummary) > 0 {
-		return fmt.Sprintf("%s\n\n%s",
-			statusPrefix, strings.Join(actionsSummary, "\n"))
+		return strings.TrimSpace(fmt.Sprintf("%s\n\n%s",
+			statusPrefix, strings.Join(actionsSummary, "\n")))
 	}
 
 	// Last resort
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/ui-agentbedrock/backend/internal/models"
+	"github.com/ui-agentbedrock/backend/internal/repository"
+)
+
+// AgentRegistry holds the Bedrock agents sessions can talk to.
+// Each agent gets an AgentService sharing the base service's runtime, so
+// fake, replay and recording runtimes apply to every agent.
+type AgentRegistry struct {
+	base       *AgentService
+	mu         sync.RWMutex
+	agents     []models.AgentDefinition
+	services   map[string]*AgentService
+	defaultKey string
+}
+
+func NewAgentRegistry(base *AgentService) *AgentRegistry {
+	return &AgentRegistry{
+		base:     base,
+		services: make(map[string]*AgentService),
+	}
+}
+
+// Register adds an agent, replacing any agent with the same key.
+// The first agent, or the last one marked as default, becomes the default.
+func (r *AgentRegistry) Register(agent models.AgentDefinition) error {
+	if agent.Key == "" {
+		return fmt.Errorf("agent key is required")
+	}
+	if agent.Name == "" {
+		agent.Name = agent.Key
+	}
+	if agent.Workflow != nil {
+		if err := normalizeWorkflow(agent.Workflow); err != nil {
+			return fmt.Errorf("workflow of agent %q: %w", agent.Key, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	replaced := false
+	for i := range r.agents {
+		if r.agents[i].Key == agent.Key {
+			r.agents[i] = agent
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		r.agents = append(r.agents, agent)
+	}
+	r.services[agent.Key] = r.base.WithAgent(agent.AgentID, agent.AgentAliasID, agent.Name).WithWorkflow(agent.Workflow)
+
+	if r.defaultKey == "" || agent.Default {
+		r.defaultKey = agent.Key
+	}
+	return nil
+}
+
+// RegisterJSON registers the agents of a JSON array, as set in the AGENTS variable
+func (r *AgentRegistry) RegisterJSON(data string) error {
+	var agents []models.AgentDefinition
+	if err := json.Unmarshal([]byte(data), &agents); err != nil {
+		return fmt.Errorf("invalid agent list: %w", err)
+	}
+
+	for _, agent := range agents {
+		if err := r.Register(agent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetWorkflowsJSON sets the workflows of registered agents from a JSON object
+// of agent key -> workflow, as set in the WORKFLOWS variable
+func (r *AgentRegistry) SetWorkflowsJSON(data string) error {
+	workflows, err := ParseWorkflows(data)
+	if err != nil {
+		return err
+	}
+
+	for key, workflow := range workflows {
+		agent, ok := r.find(key)
+		if !ok {
+			return fmt.Errorf("workflow for unknown agent %q", key)
+		}
+		agent.Workflow = workflow
+		if err := r.Register(agent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SeedWorkflow gives a registered agent the workflow if it has none.
+// It reports whether the workflow was set.
+func (r *AgentRegistry) SeedWorkflow(key string, workflow *models.WorkflowDefinition) (bool, error) {
+	agent, ok := r.find(key)
+	if !ok || agent.Workflow != nil {
+		return false, nil
+	}
+
+	agent.Workflow = workflow
+	if err := r.Register(agent); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// find returns the registered agent with the key
+func (r *AgentRegistry) find(key string) (models.AgentDefinition, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, agent := range r.agents {
+		if agent.Key == key {
+			return agent, true
+		}
+	}
+	return models.AgentDefinition{}, false
+}
+
+// LoadFromRepository registers the agents stored in the agents collection
+func (r *AgentRegistry) LoadFromRepository(ctx context.Context, repo *repository.AgentRepository) error {
+	agents, err := repo.GetAgents(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, agent := range agents {
+		if err := r.Register(agent); err != nil {
+			log.Printf("Warning: Skipping agent %q: %v", agent.Name, err)
+		}
+	}
+	return nil
+}
+
+// List returns the registered agents in registration order
+func (r *AgentRegistry) List() []models.AgentDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	agents := make([]models.AgentDefinition, len(r.agents))
+	for i, agent := range r.agents {
+		agent.Default = agent.Key == r.defaultKey
+		agents[i] = agent
+	}
+	return agents
+}
+
+// Has reports whether an agent with the key is registered
+func (r *AgentRegistry) Has(key string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.services[key]
+	return ok
+}
+
+// DefaultKey returns the key of the default agent
+func (r *AgentRegistry) DefaultKey() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.defaultKey
+}
+
+// Get returns the AgentService for a key, falling back to the default agent
+// (and to the base service if nothing is registered)
+func (r *AgentRegistry) Get(key string) *AgentService {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if service, ok := r.services[key]; ok {
+		return service
+	}
+	if key != "" {
+		log.Printf("Warning: Unknown agent %q, using default agent", key)
+	}
+	if service, ok := r.services[r.defaultKey]; ok {
+		return service
+	}
+	return r.base
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/ui-agentbedrock/backend/internal/models"
+)
+
+// invokeFake runs one invocation of a fake agent and collects the SSE events it sends
+func invokeFake(t *testing.T, script FakeScript, message string) (*models.Trace, string, []models.SSEEvent) {
+	t.Helper()
+
+	service := NewAgentServiceWithRuntime(NewFakeRuntime(script, 0), aws.Config{}, "AGENT", "ALIAS", "")
+	var events []models.SSEEvent
+	trace, content, err := service.InvokeAgentStream(context.Background(), "session", message, func(event models.SSEEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("InvokeAgentStream: %v", err)
+	}
+	return trace, content, events
+}
+
+// script returns a FakeScript that always emits events
+func script(events ...types.ResponseStream) FakeScript {
+	return func(*bedrockagentruntime.InvokeAgentInput) []types.ResponseStream {
+		return events
+	}
+}
+
+func eventsOf(events []models.SSEEvent, name string) []models.SSEEvent {
+	var matched []models.SSEEvent
+	for _, event := range events {
+		if event.Event == name {
+			matched = append(matched, event)
+		}
+	}
+	return matched
+}
+
+func findStep(trace *models.Trace, stepType, action string) *models.AgentStep {
+	for i := range trace.AgentSteps {
+		if trace.AgentSteps[i].Type == stepType && trace.AgentSteps[i].Action == action {
+			return &trace.AgentSteps[i]
+		}
+	}
+	return nil
+}
+
+func TestInvokeAgentStreamChunks(t *testing.T) {
+	trace, content, events := invokeFake(t, script(FakeChunk("Hello, "), FakeChunk("world")), "hi")
+
+	if content != "Hello, world" {
+		t.Errorf("content = %q, want %q", content, "Hello, world")
+	}
+
+	var streamed strings.Builder
+	for _, event := range eventsOf(events, "content") {
+		streamed.WriteString(event.Data.(models.ContentEvent).Chunk)
+	}
+	if streamed.String() != content {
+		t.Errorf("streamed content = %q, want %q", streamed.String(), content)
+	}
+
+	if events[0].Event != "thinking" {
+		t.Errorf("first event = %q, want thinking", events[0].Event)
+	}
+	last := events[len(events)-1]
+	if last.Event != "trace" || last.Data.(models.TraceEvent).TraceID != trace.TraceID {
+		t.Errorf("last event = %q, want the trace event of %s", last.Event, trace.TraceID)
+	}
+	if trace.Error != nil {
+		t.Errorf("trace error = %+v, want none", trace.Error)
+	}
+}
+
+func TestInvokeAgentStreamCollaboratorTrace(t *testing.T) {
+	events := append(FakeCollaboratorCall("Analyzer", "Analyze the data", "The data looks fine."), FakeChunk("Done."))
+	trace, content, _ := invokeFake(t, script(events...), "hi")
+
+	if content != "Done." {
+		t.Errorf("content = %q, want %q", content, "Done.")
+	}
+
+	call := findStep(trace, "collaborator", "Calling")
+	if call == nil {
+		t.Fatalf("no collaborator call step in %+v", trace.AgentSteps)
+	}
+	if call.AgentName != "Analyzer" {
+		t.Errorf("call agent = %q, want Analyzer", call.AgentName)
+	}
+
+	response := findStep(trace, "collaborator", "Response")
+	if response == nil {
+		t.Fatalf("no collaborator response step in %+v", trace.AgentSteps)
+	}
+	if response.Output != "The data looks fine." || response.Status != "success" {
+		t.Errorf("response step = %q (%s), want the collaborator output", response.Output, response.Status)
+	}
+}
+
+func TestInvokeAgentStreamKnowledgeBaseTrace(t *testing.T) {
+	events := FakeKnowledgeBaseLookup("KB0001", "refund policy", "Refunds within 30 days", "No refunds on sale items")
+	events = append(events, FakeCitedChunk("Refunds are possible within 30 days.", "s3://kb/policy.txt", "Refunds within 30 days"))
+	trace, content, streamed := invokeFake(t, script(events...), "hi")
+
+	if content != "Refunds are possible within 30 days." {
+		t.Errorf("content = %q", content)
+	}
+	if findStep(trace, "knowledge_base", "Searching") == nil {
+		t.Errorf("no knowledge base search step in %+v", trace.AgentSteps)
+	}
+	if findStep(trace, "knowledge_base", "Results") == nil {
+		t.Errorf("no knowledge base results step in %+v", trace.AgentSteps)
+	}
+	if citations := eventsOf(streamed, "citation"); len(citations) == 0 {
+		t.Error("no citation events for the knowledge base references")
+	}
+}
+
+func TestInvokeAgentStreamFailureTrace(t *testing.T) {
+	trace, content, events := invokeFake(t, script(FakeRationale("Checking"), FakeFailure("Lambda timed out")), "hi")
+
+	if content != "" {
+		t.Errorf("content = %q, want none", content)
+	}
+
+	failure := findStep(trace, "error", "Lambda timed out")
+	if failure == nil {
+		t.Fatalf("no failure step in %+v", trace.AgentSteps)
+	}
+	if failure.Status != "error" {
+		t.Errorf("failure step status = %q, want error", failure.Status)
+	}
+
+	var reported bool
+	for _, event := range eventsOf(events, "agent_step") {
+		if step := event.Data.(models.AgentStepEvent); step.Type == "error" && step.Status == "error" {
+			reported = true
+		}
+	}
+	if !reported {
+		t.Error("the failure step was not sent as an agent_step event")
+	}
+}
+
+func TestInvokeAgentStreamFallbackResponse(t *testing.T) {
+	// The supervisor ends without an answer of its own
+	trace, content, events := invokeFake(t, script(FakeCollaboratorCall("Reporter", "Write the report", "Quarterly report is ready.")...), "hi")
+
+	if !strings.Contains(content, "Quarterly report is ready.") {
+		t.Errorf("content = %q, want the last collaborator output", content)
+	}
+	if !strings.Contains(content, "Reporter") {
+		t.Errorf("content = %q, want the collaborator name", content)
+	}
+
+	chunks := eventsOf(events, "content")
+	if len(chunks) != 1 || chunks[0].Data.(models.ContentEvent).Chunk != content {
+		t.Errorf("fallback sent as %d content events, want one with the full answer", len(chunks))
+	}
+	if trace.Error != nil {
+		t.Errorf("trace error = %+v, want none", trace.Error)
+	}
+}
+
+func TestInvokeAgentStreamFinalResponseFromTrace(t *testing.T) {
+	_, content, _ := invokeFake(t, script(FakeRationale("Answering"), FakeFinalResponse("From the orchestration trace.")), "hi")
+
+	if content != "From the orchestration trace." {
+		t.Errorf("content = %q, want the final response of the trace", content)
+	}
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/ui-agentbedrock/backend/internal/models"
+)
+
+// Metadata keys Bedrock knowledge bases attach to retrieved references
+const (
+	kbSourceURIKey = "x-amz-bedrock-kb-source-uri"
+	kbScoreKey     = "x-amz-bedrock-kb-score"
+)
+
+// citationTracker maps knowledge base references of one invocation to citations.
+// Lookups in the trace tell which knowledge base a source came from; chunk
+// attributions tell which part of the answer cites it.
+type citationTracker struct {
+	knowledgeBaseID string            // Knowledge base of the lookup in progress
+	sources         map[string]string // Source URI -> knowledge base ID
+}
+
+func newCitationTracker() *citationTracker {
+	return &citationTracker{sources: make(map[string]string)}
+}
+
+// observeTrace records knowledge base lookups and returns the references they
+// retrieved as citations without a span
+func (t *citationTracker) observeTrace(trace types.Trace) []models.Citation {
+	orchestration, ok := trace.(*types.TraceMemberOrchestrationTrace)
+	if !ok {
+		return nil
+	}
+
+	switch v := orchestration.Value.(type) {
+	case *types.OrchestrationTraceMemberInvocationInput:
+		if lookup := v.Value.KnowledgeBaseLookupInput; lookup != nil {
+			t.knowledgeBaseID = aws.ToString(lookup.KnowledgeBaseId)
+		}
+
+	case *types.OrchestrationTraceMemberObservation:
+		output := v.Value.KnowledgeBaseLookupOutput
+		if output == nil {
+			return nil
+		}
+
+		citations := make([]models.Citation, 0, len(output.RetrievedReferences))
+		for _, ref := range output.RetrievedReferences {
+			citation := citationFromReference(ref)
+			citation.KnowledgeBaseID = t.knowledgeBaseID
+			if citation.SourceURI != "" {
+				t.sources[citation.SourceURI] = t.knowledgeBaseID
+			}
+			citations = append(citations, citation)
+		}
+		return citations
+	}
+
+	return nil
+}
+
+// observeAttribution returns the citations of a response chunk, with spans
+// shifted by offset (the answer length before the chunk, in characters)
+func (t *citationTracker) observeAttribution(attribution *types.Attribution, offset, chunkLength int) []models.Citation {
+	if attribution == nil {
+		return nil
+	}
+
+	var citations []models.Citation
+	for _, cited := range attribution.Citations {
+		span := &models.Span{Start: offset, End: offset + chunkLength}
+		if part := cited.GeneratedResponsePart; part != nil && part.TextResponsePart != nil && part.TextResponsePart.Span != nil {
+			s := part.TextResponsePart.Span
+			span = &models.Span{
+				Start: offset + int(aws.ToInt32(s.Start)),
+				End:   offset + int(aws.ToInt32(s.End)),
+			}
+		}
+
+		for _, ref := range cited.RetrievedReferences {
+			citation := citationFromReference(ref)
+			citation.KnowledgeBaseID = t.sources[citation.SourceURI]
+			citation.Span = span
+			citations = append(citations, citation)
+		}
+	}
+	return citations
+}
+
+// citationFromReference extracts the source, passage and score of a reference
+func citationFromReference(ref types.RetrievedReference) models.Citation {
+	citation := models.Citation{SourceURI: referenceURI(ref)}
+	if ref.Content != nil {
+		citation.Snippet = truncateString(aws.ToString(ref.Content.Text), 500)
+	}
+
+	if doc, ok := ref.Metadata[kbScoreKey]; ok && doc != nil {
+		var score float64
+		if err := doc.UnmarshalSmithyDocument(&score); err == nil {
+			citation.Score = &score
+		}
+	}
+	return citation
+}
+
+// referenceURI returns the location of a reference for any data source type
+func referenceURI(ref types.RetrievedReference) string {
+	if loc := ref.Location; loc != nil {
+		switch {
+		case loc.S3Location != nil:
+			return aws.ToString(loc.S3Location.Uri)
+		case loc.WebLocation != nil:
+			return aws.ToString(loc.WebLocation.Url)
+		case loc.ConfluenceLocation != nil:
+			return aws.ToString(loc.ConfluenceLocation.Url)
+		case loc.SalesforceLocation != nil:
+			return aws.ToString(loc.SalesforceLocation.Url)
+		case loc.SharePointLocation != nil:
+			return aws.ToString(loc.SharePointLocation.Url)
+		case loc.KendraDocumentLocation != nil:
+			return aws.ToString(loc.KendraDocumentLocation.Uri)
+		case loc.CustomDocumentLocation != nil:
+			return aws.ToString(loc.CustomDocumentLocation.Id)
+		case loc.SqlLocation != nil:
+			return aws.ToString(loc.SqlLocation.Query)
+		}
+	}
+
+	if doc, ok := ref.Metadata[kbSourceURIKey]; ok && doc != nil {
+		var uri string
+		if err := doc.UnmarshalSmithyDocument(&uri); err == nil {
+			return uri
+		}
+	}
+	return ""
+}
+
+// CitationCollector gathers the citation events of an invocation so they can be
+// saved with the assistant message
+type CitationCollector struct {
+	mu        sync.Mutex
+	citations []models.Citation
+}
+
+// Observe records the event if it is a citation
+func (c *CitationCollector) Observe(event models.SSEEvent) {
+	citation, ok := event.Data.(models.Citation)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.citations = append(c.citations, citation)
+}
+
+// Citations returns the collected citations. Retrieved references that were
+// later cited in the answer are only kept with their span.
+func (c *CitationCollector) Citations() []models.Citation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cited := make(map[string]bool)
+	for _, citation := range c.citations {
+		if citation.Span != nil {
+			cited[citation.SourceURI] = true
+		}
+	}
+
+	var citations []models.Citation
+	seen := make(map[string]bool)
+	for _, citation := range c.citations {
+		if citation.Span == nil {
+			if cited[citation.SourceURI] || seen[citation.SourceURI+"\x00"+citation.Snippet] {
+				continue
+			}
+			seen[citation.SourceURI+"\x00"+citation.Snippet] = true
+		}
+		citations = append(citations, citation)
+	}
+	return citations
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// ConfirmationRegistry holds the agent actions waiting for the user to approve
+// or deny them. The invocation blocks in Wait until the decision arrives
+// through Resolve, the timeout expires or the invocation is cancelled.
+type ConfirmationRegistry struct {
+	mu      sync.Mutex
+	pending map[string]*pendingConfirmation
+	timeout time.Duration
+}
+
+type pendingConfirmation struct {
+	sessionID string // Only this session's clients may decide
+	decision  chan bool
+}
+
+func NewConfirmationRegistry(timeout time.Duration) *ConfirmationRegistry {
+	return &ConfirmationRegistry{
+		pending: make(map[string]*pendingConfirmation),
+		timeout: timeout,
+	}
+}
+
+// Open registers a new pending confirmation of a session and returns its ID,
+// a random token that can't be guessed from other confirmations
+func (r *ConfirmationRegistry) Open(sessionID string) string {
+	token := make([]byte, 16)
+	rand.Read(token)
+	id := hex.EncodeToString(token)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[id] = &pendingConfirmation{sessionID: sessionID, decision: make(chan bool, 1)}
+	return id
+}
+
+// Wait blocks until the confirmation is resolved. It returns the decision and
+// false if the timeout expired or ctx was cancelled first.
+func (r *ConfirmationRegistry) Wait(ctx context.Context, id string) (approved bool, decided bool) {
+	r.mu.Lock()
+	pending, ok := r.pending[id]
+	r.mu.Unlock()
+	if !ok {
+		return false, false
+	}
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, id)
+		r.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(r.timeout)
+	defer timer.Stop()
+
+	select {
+	case approved := <-pending.decision:
+		return approved, true
+	case <-timer.C:
+		return false, false
+	case <-ctx.Done():
+		return false, false
+	}
+}
+
+// Resolve delivers the user's decision. It returns false if no confirmation
+// with the ID is pending for the session.
+func (r *ConfirmationRegistry) Resolve(sessionID, id string, approved bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pending, ok := r.pending[id]
+	if !ok || pending.sessionID != sessionID {
+		return false
+	}
+	delete(r.pending, id)
+	pending.decision <- approved
+	return true
+}
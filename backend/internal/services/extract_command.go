@@ -0,0 +1,196 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ui-agentbedrock/backend/internal/models"
+)
+
+const (
+	defaultCommandTimeout = 60 * time.Second
+	maxCommandOutput      = 8 << 20 // Bytes of text kept from the command
+	maxCommandStderr      = 2048    // Bytes of the error output quoted in errors
+)
+
+// fileArgument in a command argument is replaced with the path of the uploaded
+// file, written to a temporary file. Without it the file is piped to stdin.
+const fileArgument = "{file}"
+
+// CommandExtractorConfig is an external extractor as configured in EXTERNAL_EXTRACTORS
+type CommandExtractorConfig struct {
+	FileType       string   `json:"fileType"`
+	Label          string   `json:"label"`
+	Extensions     []string `json:"extensions"`
+	MimeTypes      []string `json:"mimeTypes"`
+	Command        []string `json:"command"` // Program and arguments, e.g. ["pdftotext", "-layout", "{file}", "-"]
+	MaxSizeMB      float64  `json:"maxSizeMB"`
+	TimeoutSeconds int      `json:"timeoutSeconds"`
+}
+
+// CommandExtractor extracts text by running an external program that writes
+// the text (plain or Markdown) to stdout
+type CommandExtractor struct {
+	format  models.FileFormat
+	command []string
+	timeout time.Duration
+}
+
+// NewCommandExtractor checks a configured extractor and finds its program
+func NewCommandExtractor(config CommandExtractorConfig) (*CommandExtractor, error) {
+	if config.FileType == "" {
+		return nil, fmt.Errorf("external extractor file type is required")
+	}
+	if len(config.Command) == 0 || config.Command[0] == "" {
+		return nil, fmt.Errorf("external extractor %q has no command", config.FileType)
+	}
+	if _, err := exec.LookPath(config.Command[0]); err != nil {
+		return nil, fmt.Errorf("external extractor %q: %w", config.FileType, err)
+	}
+
+	timeout := time.Duration(config.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	format, err := normalizeFormat(models.FileFormat{
+		FileType:   config.FileType,
+		Label:      config.Label,
+		Extensions: config.Extensions,
+		MimeTypes:  config.MimeTypes,
+		MaxSize:    int64(config.MaxSizeMB * 1024 * 1024),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CommandExtractor{format: format, command: config.Command, timeout: timeout}, nil
+}
+
+// ParseCommandExtractors parses a JSON array of external extractors
+func ParseCommandExtractors(data string) ([]*CommandExtractor, error) {
+	var configs []CommandExtractorConfig
+	if err := json.Unmarshal([]byte(data), &configs); err != nil {
+		return nil, fmt.Errorf("invalid external extractor list: %w", err)
+	}
+
+	extractors := make([]*CommandExtractor, 0, len(configs))
+	for _, config := range configs {
+		extractor, err := NewCommandExtractor(config)
+		if err != nil {
+			return nil, err
+		}
+		extractors = append(extractors, extractor)
+	}
+	return extractors, nil
+}
+
+func (e *CommandExtractor) Format() models.FileFormat { return e.format }
+
+// Extract runs the command on the content and returns what it wrote to stdout
+func (e *CommandExtractor) Extract(ctx context.Context, content []byte) (*Extraction, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	args, cleanup, err := e.arguments(content)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	cmd := exec.CommandContext(ctx, e.command[0], args...)
+	// Stop waiting for output a while after the kill, in case the program left children holding the pipes
+	cmd.WaitDelay = 5 * time.Second
+	if !e.usesFile() {
+		cmd.Stdin = bytes.NewReader(content)
+	}
+	stdout := &cappedBuffer{max: maxCommandOutput}
+	stderr := &cappedBuffer{max: maxCommandStderr}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%s timed out after %s", e.command[0], e.timeout)
+		}
+		if message := strings.TrimSpace(strings.ToValidUTF8(stderr.String(), "")); message != "" {
+			return nil, fmt.Errorf("%s failed: %v: %s", e.command[0], err, message)
+		}
+		return nil, fmt.Errorf("%s failed: %v", e.command[0], err)
+	}
+
+	text := strings.TrimSpace(strings.ToValidUTF8(stdout.String(), ""))
+	if text == "" {
+		return nil, ErrNoExtractableText
+	}
+	if stdout.truncated {
+		text += fmt.Sprintf("\n\n_Truncated: showing the first %d MB of the extracted text._", maxCommandOutput>>20)
+	}
+	return &Extraction{Content: text}, nil
+}
+
+func (e *CommandExtractor) usesFile() bool {
+	for _, arg := range e.command[1:] {
+		if strings.Contains(arg, fileArgument) {
+			return true
+		}
+	}
+	return false
+}
+
+// arguments returns the command arguments, writing the content to a temporary
+// file if they refer to it. The file keeps the format's extension, which some
+// converters go by.
+func (e *CommandExtractor) arguments(content []byte) ([]string, func(), error) {
+	if !e.usesFile() {
+		return e.command[1:], func() {}, nil
+	}
+
+	ext := ""
+	if len(e.format.Extensions) > 0 {
+		ext = e.format.Extensions[0]
+	}
+	file, err := os.CreateTemp("", "extract-*"+ext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	cleanup := func() { os.Remove(file.Name()) }
+	_, writeErr := file.Write(content)
+	if err := file.Close(); writeErr == nil {
+		writeErr = err
+	}
+	if writeErr != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to write temporary file: %w", writeErr)
+	}
+
+	args := make([]string, len(e.command)-1)
+	for i, arg := range e.command[1:] {
+		args[i] = strings.ReplaceAll(arg, fileArgument, file.Name())
+	}
+	return args, cleanup, nil
+}
+
+// cappedBuffer keeps the first max bytes written to it and drops the rest
+type cappedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,548 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// DocxOptions selects the optional parts of a Word document included in its Markdown
+type DocxOptions struct {
+	Footnotes bool // Footnotes and endnotes as Markdown footnotes at the end
+	Comments  bool // Reviewer comments in a Comments section at the end
+}
+
+// docxStyle is what the converter needs from a paragraph style
+type docxStyle struct {
+	name         string
+	basedOn      string
+	outlineLevel int // 0-based heading level, -1 if none
+	numID        string
+	level        int
+}
+
+// docxDocument converts the main part of a DOCX to Markdown
+type docxDocument struct {
+	options       DocxOptions
+	styles        map[string]docxStyle
+	numFormats    map[string][]string // numId -> number format per level ("bullet", "decimal", ...)
+	numStarts     map[string][]int    // numId -> start value per level
+	counters      map[string][]int    // numId -> current number per level
+	relationships map[string]string   // Relationship ID -> target (hyperlink URLs)
+	footnotes     []string
+	comments      []string
+}
+
+// extractFromDOCX converts a Word document to Markdown: headings, bulleted and
+// numbered lists, tables, links and bold/italic text
+func (s *ExtractionService) extractFromDOCX(ctx context.Context, content []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		if isCompoundFile(content) {
+			// Encrypted OOXML files are wrapped in a compound file
+			return "", ErrEncryptedDocument
+		}
+		return "", fmt.Errorf("invalid DOCX: %w", err)
+	}
+
+	body, err := readOOXMLPart(archive, "word/document.xml", "DOCX")
+	if err != nil {
+		return "", err
+	}
+	if body == nil {
+		return "", fmt.Errorf("invalid DOCX: word/document.xml is missing")
+	}
+
+	doc := &docxDocument{
+		options:    s.docx,
+		styles:     map[string]docxStyle{},
+		numFormats: map[string][]string{},
+		numStarts:  map[string][]int{},
+		counters:   map[string][]int{},
+	}
+	if err := doc.load(archive); err != nil {
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	var blocks []markdownBlock
+	if b := body.child("body"); b != nil {
+		blocks = doc.blocks(b)
+	}
+	markdown := joinMarkdownBlocks(blocks)
+	if strings.TrimSpace(markdown) == "" {
+		return "", ErrNoExtractableText
+	}
+
+	if len(doc.footnotes) > 0 {
+		markdown += "\n\n" + strings.Join(doc.footnotes, "\n")
+	}
+	if len(doc.comments) > 0 {
+		markdown += "\n\n## Comments\n\n" + strings.Join(doc.comments, "\n")
+	}
+	return strings.TrimSpace(markdown), nil
+}
+
+// load reads styles, numbering, relationships and the optional footnotes and comments
+func (d *docxDocument) load(archive *zip.Reader) error {
+	styles, err := readOOXMLPart(archive, "word/styles.xml", "DOCX")
+	if err != nil {
+		return err
+	}
+	if styles != nil {
+		d.loadStyles(styles)
+	}
+
+	numbering, err := readOOXMLPart(archive, "word/numbering.xml", "DOCX")
+	if err != nil {
+		return err
+	}
+	if numbering != nil {
+		d.loadNumbering(numbering)
+	}
+
+	if d.relationships, err = readRelationships(archive, "word/document.xml", "DOCX"); err != nil {
+		return err
+	}
+
+	if d.options.Footnotes {
+		for _, part := range []string{"word/footnotes.xml", "word/endnotes.xml"} {
+			notes, err := readOOXMLPart(archive, part, "DOCX")
+			if err != nil {
+				return err
+			}
+			if notes != nil {
+				d.loadNotes(notes, strings.TrimSuffix(path.Base(part), "s.xml"))
+			}
+		}
+	}
+
+	if d.options.Comments {
+		comments, err := readOOXMLPart(archive, "word/comments.xml", "DOCX")
+		if err != nil {
+			return err
+		}
+		if comments != nil {
+			d.loadComments(comments)
+		}
+	}
+	return nil
+}
+
+func (d *docxDocument) loadStyles(styles *ooxmlNode) {
+	for _, style := range styles.Nodes {
+		if style.XMLName.Local != "style" {
+			continue
+		}
+
+		entry := docxStyle{outlineLevel: -1}
+		if name := style.child("name"); name != nil {
+			entry.name = strings.ToLower(name.attr("val"))
+		}
+		if basedOn := style.child("basedOn"); basedOn != nil {
+			entry.basedOn = basedOn.attr("val")
+		}
+		if pPr := style.child("pPr"); pPr != nil {
+			if outline := pPr.child("outlineLvl"); outline != nil {
+				if level, err := strconv.Atoi(outline.attr("val")); err == nil {
+					entry.outlineLevel = level
+				}
+			}
+			if numPr := pPr.child("numPr"); numPr != nil {
+				entry.numID, entry.level = docxNumbering(numPr)
+			}
+		}
+		d.styles[style.attr("styleId")] = entry
+	}
+}
+
+func (d *docxDocument) loadNumbering(numbering *ooxmlNode) {
+	formats := map[string][]string{}
+	starts := map[string][]int{}
+	for _, abstract := range numbering.Nodes {
+		if abstract.XMLName.Local != "abstractNum" {
+			continue
+		}
+
+		id := abstract.attr("abstractNumId")
+		for _, lvl := range abstract.Nodes {
+			if lvl.XMLName.Local != "lvl" {
+				continue
+			}
+			level, err := strconv.Atoi(lvl.attr("ilvl"))
+			if err != nil || level < 0 || level > 8 {
+				continue
+			}
+			for len(formats[id]) <= level {
+				formats[id] = append(formats[id], "decimal")
+				starts[id] = append(starts[id], 1)
+			}
+			if format := lvl.child("numFmt"); format != nil {
+				formats[id][level] = format.attr("val")
+			}
+			if start := lvl.child("start"); start != nil {
+				if value, err := strconv.Atoi(start.attr("val")); err == nil {
+					starts[id][level] = value
+				}
+			}
+		}
+	}
+
+	for _, num := range numbering.Nodes {
+		if num.XMLName.Local != "num" {
+			continue
+		}
+		if abstract := num.child("abstractNumId"); abstract != nil {
+			id := num.attr("numId")
+			d.numFormats[id] = formats[abstract.attr("val")]
+			d.numStarts[id] = starts[abstract.attr("val")]
+		}
+	}
+}
+
+// loadNotes collects footnotes or endnotes as Markdown footnote definitions
+func (d *docxDocument) loadNotes(notes *ooxmlNode, kind string) {
+	for _, note := range notes.Nodes {
+		if note.XMLName.Local != kind {
+			continue
+		}
+		// Separators are layout, not content
+		if t := note.attr("type"); t == "separator" || t == "continuationSeparator" || t == "continuationNotice" {
+			continue
+		}
+
+		text := docxPlainText(d, &note)
+		if text != "" {
+			d.footnotes = append(d.footnotes, fmt.Sprintf("[^%s%s]: %s", docxNoteLabel(kind), note.attr("id"), text))
+		}
+	}
+}
+
+func (d *docxDocument) loadComments(comments *ooxmlNode) {
+	for _, comment := range comments.Nodes {
+		if comment.XMLName.Local != "comment" {
+			continue
+		}
+
+		text := docxPlainText(d, &comment)
+		if text == "" {
+			continue
+		}
+		author := comment.attr("author")
+		if author == "" {
+			author = "Unknown"
+		}
+		d.comments = append(d.comments, fmt.Sprintf("- [comment %s] **%s**: %s", comment.attr("id"), author, text))
+	}
+}
+
+// docxNoteLabel keeps endnote labels apart from footnote labels with the same ID
+func docxNoteLabel(kind string) string {
+	if kind == "endnote" {
+		return "e"
+	}
+	return ""
+}
+
+// docxPlainText renders the paragraphs of a note or comment on one line
+func docxPlainText(d *docxDocument, node *ooxmlNode) string {
+	var parts []string
+	for _, block := range d.blocks(node) {
+		parts = append(parts, strings.ReplaceAll(block.text, "\n", " "))
+	}
+	return strings.TrimSpace(strings.Join(parts, " "))
+}
+
+// blocks renders the paragraphs and tables of a container (body, cell, note, content control)
+func (d *docxDocument) blocks(container *ooxmlNode) []markdownBlock {
+	var blocks []markdownBlock
+	for i := range container.Nodes {
+		node := &container.Nodes[i]
+		switch node.XMLName.Local {
+		case "p":
+			if block, ok := d.paragraph(node); ok {
+				blocks = append(blocks, block)
+			}
+		case "tbl":
+			if table := d.table(node); table != "" {
+				blocks = append(blocks, markdownBlock{text: table})
+			}
+		case "sdt":
+			if content := node.child("sdtContent"); content != nil {
+				blocks = append(blocks, d.blocks(content)...)
+			}
+		case "customXml", "ins":
+			blocks = append(blocks, d.blocks(node)...)
+		}
+	}
+	return blocks
+}
+
+// paragraph renders a heading, list item or plain paragraph. Empty paragraphs are skipped.
+func (d *docxDocument) paragraph(p *ooxmlNode) (markdownBlock, bool) {
+	text := strings.TrimSpace(d.inline(p))
+	if text == "" {
+		return markdownBlock{}, false
+	}
+
+	styleID, numID, level, outline := "", "", 0, -1
+	if pPr := p.child("pPr"); pPr != nil {
+		if style := pPr.child("pStyle"); style != nil {
+			styleID = style.attr("val")
+		}
+		if numPr := pPr.child("numPr"); numPr != nil {
+			numID, level = docxNumbering(numPr)
+		}
+		if outlineLvl := pPr.child("outlineLvl"); outlineLvl != nil {
+			if value, err := strconv.Atoi(outlineLvl.attr("val")); err == nil {
+				outline = value
+			}
+		}
+	}
+
+	if heading := d.headingLevel(styleID, outline); heading > 0 {
+		return markdownBlock{text: strings.Repeat("#", heading) + " " + strings.ReplaceAll(text, "\n", " ")}, true
+	}
+
+	if numID == "" {
+		numID, level = d.styleNumbering(styleID)
+	}
+	// numId 0 explicitly removes the numbering of a list style
+	if numID != "" && numID != "0" {
+		indent := strings.Repeat("    ", level)
+		return markdownBlock{text: indent + d.listMarker(numID, level) + " " + strings.ReplaceAll(text, "\n", "\n"+indent+"    "), list: numID}, true
+	}
+
+	// Hard line breaks within a paragraph
+	return markdownBlock{text: strings.ReplaceAll(text, "\n", "  \n")}, true
+}
+
+// headingLevel returns the Markdown heading level (1-6) of a paragraph, or 0.
+// Built-in heading styles are recognized by name, so localized style IDs work too.
+func (d *docxDocument) headingLevel(styleID string, outline int) int {
+	level := 0
+	if outline >= 0 && outline < 9 {
+		level = outline + 1
+	}
+
+	for depth := 0; styleID != "" && depth < 10 && level == 0; depth++ {
+		style, ok := d.styles[styleID]
+		if !ok {
+			break
+		}
+		switch {
+		case style.name == "title":
+			level = 1
+		case strings.HasPrefix(style.name, "heading "):
+			if n, err := strconv.Atoi(strings.TrimPrefix(style.name, "heading ")); err == nil {
+				level = n
+			}
+		case style.outlineLevel >= 0 && style.outlineLevel < 9:
+			level = style.outlineLevel + 1
+		}
+		styleID = style.basedOn
+	}
+
+	if level > 6 {
+		level = 6
+	}
+	return level
+}
+
+// styleNumbering returns the numbering a paragraph inherits from its style (e.g. "List Bullet")
+func (d *docxDocument) styleNumbering(styleID string) (string, int) {
+	for depth := 0; styleID != "" && depth < 10; depth++ {
+		style, ok := d.styles[styleID]
+		if !ok {
+			break
+		}
+		if style.numID != "" {
+			return style.numID, style.level
+		}
+		styleID = style.basedOn
+	}
+	return "", 0
+}
+
+func docxNumbering(numPr *ooxmlNode) (numID string, level int) {
+	if id := numPr.child("numId"); id != nil {
+		numID = id.attr("val")
+	}
+	if ilvl := numPr.child("ilvl"); ilvl != nil {
+		level, _ = strconv.Atoi(ilvl.attr("val"))
+	}
+	if level < 0 || level > 8 {
+		level = 0
+	}
+	return numID, level
+}
+
+// listMarker returns "-" for bullets or the item's number, counting per list and
+// restarting nested levels when a parent item follows
+func (d *docxDocument) listMarker(numID string, level int) string {
+	formats := d.numFormats[numID]
+	format := "bullet"
+	if level < len(formats) {
+		format = formats[level]
+	}
+	if format == "bullet" || format == "none" {
+		return "-"
+	}
+
+	counters := d.counters[numID]
+	for len(counters) <= level {
+		start := 1
+		if starts := d.numStarts[numID]; len(counters) < len(starts) {
+			start = starts[len(counters)]
+		}
+		counters = append(counters, start-1)
+	}
+	counters[level]++
+	d.counters[numID] = counters[:level+1]
+	return strconv.Itoa(counters[level]) + "."
+}
+
+// table renders a table as a Markdown table with the first row as header.
+// Merged cells repeat as empty cells so the columns stay aligned.
+func (d *docxDocument) table(tbl *ooxmlNode) string {
+	var rows [][]string
+	columns := 0
+	for i := range tbl.Nodes {
+		tr := &tbl.Nodes[i]
+		if tr.XMLName.Local != "tr" {
+			continue
+		}
+
+		var row []string
+		for j := range tr.Nodes {
+			tc := &tr.Nodes[j]
+			if tc.XMLName.Local != "tc" {
+				continue
+			}
+
+			var parts []string
+			for _, block := range d.blocks(tc) {
+				parts = append(parts, block.text)
+			}
+			row = append(row, markdownCell(strings.Join(parts, "\n")))
+
+			if tcPr := tc.child("tcPr"); tcPr != nil {
+				if span := tcPr.child("gridSpan"); span != nil {
+					if n, err := strconv.Atoi(span.attr("val")); err == nil {
+						for k := 1; k < n && k < 64; k++ {
+							row = append(row, "")
+						}
+					}
+				}
+			}
+		}
+		if len(row) > columns {
+			columns = len(row)
+		}
+		rows = append(rows, row)
+	}
+
+	return markdownTable(rows, columns)
+}
+
+// inline renders the runs of a paragraph. Adjacent runs with the same formatting
+// are merged before emphasis is added, so Word's run splitting doesn't show.
+func (d *docxDocument) inline(p *ooxmlNode) string {
+	var spans []textSpan
+	d.collectSpans(p, &spans)
+
+	var out strings.Builder
+	for i := 0; i < len(spans); {
+		span := spans[i]
+		j := i + 1
+		for j < len(spans) && spans[j].bold == span.bold && spans[j].italic == span.italic {
+			span.text += spans[j].text
+			j++
+		}
+		out.WriteString(emphasize(span))
+		i = j
+	}
+	return out.String()
+}
+
+func (d *docxDocument) collectSpans(node *ooxmlNode, spans *[]textSpan) {
+	for i := range node.Nodes {
+		child := &node.Nodes[i]
+		switch child.XMLName.Local {
+		case "r":
+			d.run(child, spans)
+		case "hyperlink":
+			var link []textSpan
+			d.collectSpans(child, &link)
+			text := ""
+			for _, span := range link {
+				text += span.text
+			}
+			target := d.relationships[child.relationshipID()]
+			if target != "" && strings.TrimSpace(text) != "" {
+				*spans = append(*spans, textSpan{text: "[" + strings.TrimSpace(text) + "](" + target + ")"})
+			} else {
+				*spans = append(*spans, link...)
+			}
+		case "AlternateContent":
+			// Choice and Fallback hold the same content (e.g. text boxes), use one
+			if choice := child.child("Choice"); choice != nil {
+				d.collectSpans(choice, spans)
+			}
+		case "ins", "smartTag", "fldSimple", "customXml", "sdtContent", "sdt",
+			"drawing", "inline", "anchor", "graphic", "graphicData", "wsp", "txbx", "txbxContent", "p":
+			d.collectSpans(child, spans)
+		}
+	}
+}
+
+// run appends the text of a run: text, tabs, breaks and note/comment references
+func (d *docxDocument) run(r *ooxmlNode, spans *[]textSpan) {
+	span := textSpan{}
+	if rPr := r.child("rPr"); rPr != nil {
+		span.bold = rPr.flag("b")
+		span.italic = rPr.flag("i")
+	}
+
+	var text strings.Builder
+	for i := range r.Nodes {
+		child := &r.Nodes[i]
+		switch child.XMLName.Local {
+		case "t":
+			text.WriteString(child.Text)
+		case "tab":
+			text.WriteString("\t")
+		case "br", "cr":
+			text.WriteString("\n")
+		case "noBreakHyphen":
+			text.WriteString("-")
+		case "footnoteReference", "endnoteReference":
+			if d.options.Footnotes {
+				kind := strings.TrimSuffix(child.XMLName.Local, "Reference")
+				text.WriteString("[^" + docxNoteLabel(kind) + child.attr("id") + "]")
+			}
+		case "commentReference":
+			if d.options.Comments {
+				text.WriteString(" [comment " + child.attr("id") + "]")
+			}
+		case "AlternateContent", "drawing":
+			// Text boxes inside the run
+			var nested []textSpan
+			d.collectSpans(&ooxmlNode{Nodes: []ooxmlNode{*child}}, &nested)
+			for _, n := range nested {
+				text.WriteString(" " + n.text)
+			}
+		}
+	}
+
+	if text.Len() > 0 {
+		span.text = text.String()
+		*spans = append(*spans, span)
+	}
+}
@@ -0,0 +1,352 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// lineBreak marks a <br> in collected text, so collapsing whitespace keeps it
+const lineBreak = "\x00"
+
+// extractFromHTML converts a web page to Markdown: the readable text with
+// headings, lists, tables, code blocks and links. Scripts, styles, navigation
+// and form controls are dropped.
+func (s *ExtractionService) extractFromHTML(ctx context.Context, content []byte) (string, error) {
+	// Honors the charset of a <meta> tag or BOM, defaulting to UTF-8
+	reader, err := charset.NewReader(bytes.NewReader(content), "text/html")
+	if err != nil {
+		return "", fmt.Errorf("invalid HTML: %w", err)
+	}
+	document, err := html.Parse(reader)
+	if err != nil {
+		return "", fmt.Errorf("invalid HTML: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	renderer := &htmlRenderer{}
+	root := document
+	if body := findHTMLElement(document, atom.Body); body != nil {
+		root = body
+	}
+	renderer.children(root)
+	renderer.flush()
+
+	blocks := renderer.blocks
+	// The <title> heads the text unless the page has its own main heading
+	if title := findHTMLElement(document, atom.Title); title != nil && findHTMLElement(root, atom.H1) == nil {
+		if text := collapseHTMLText(htmlTextContent(title)); text != "" {
+			blocks = append([]markdownBlock{{text: "# " + text}}, blocks...)
+		}
+	}
+
+	markdown := joinMarkdownBlocks(blocks)
+	if strings.TrimSpace(markdown) == "" {
+		return "", ErrNoExtractableText
+	}
+	return markdown, nil
+}
+
+// htmlRenderer collects Markdown blocks while walking the HTML tree. Inline
+// content accumulates until the next block element flushes it.
+type htmlRenderer struct {
+	blocks []markdownBlock
+	inline strings.Builder
+	prefix string     // Prefix of the pending block, e.g. "## " or "- "
+	list   string     // Set while the pending block is a list item
+	lists  []htmlList // Open lists, innermost last
+}
+
+type htmlList struct {
+	ordered bool
+	next    int
+}
+
+// flush ends the pending block. Without text the prefix stays for the next
+// block, so <li><p>text</p></li> keeps its list marker.
+func (r *htmlRenderer) flush() {
+	text := collapseHTMLText(r.inline.String())
+	r.inline.Reset()
+	if text != "" {
+		r.blocks = append(r.blocks, markdownBlock{text: r.prefix + text, list: r.list})
+		r.prefix = ""
+		r.list = ""
+	}
+}
+
+// breakBlock ends the pending block and drops its prefix, before content that
+// can't carry one (nested lists, tables, code blocks)
+func (r *htmlRenderer) breakBlock() {
+	r.flush()
+	r.prefix = ""
+	r.list = ""
+}
+
+// add appends a finished block, such as a table
+func (r *htmlRenderer) add(text string) {
+	r.blocks = append(r.blocks, markdownBlock{text: text})
+}
+
+// text returns the collected blocks as one string
+func (r *htmlRenderer) text(separator string) string {
+	texts := make([]string, len(r.blocks))
+	for i, block := range r.blocks {
+		texts[i] = block.text
+	}
+	return strings.Join(texts, separator)
+}
+
+// block renders an element as its own block with the given prefix
+func (r *htmlRenderer) block(n *html.Node, prefix string) {
+	r.flush()
+	r.prefix += prefix
+	r.children(n)
+	r.breakBlock()
+}
+
+func (r *htmlRenderer) children(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		r.node(child)
+	}
+}
+
+func (r *htmlRenderer) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.inline.WriteString(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		r.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Svg, atom.Head, atom.Iframe,
+		atom.Object, atom.Canvas, atom.Nav, atom.Form, atom.Button, atom.Select, atom.Input, atom.Textarea:
+		return
+
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level, _ := strconv.Atoi(n.Data[1:])
+		r.block(n, strings.Repeat("#", level)+" ")
+
+	case atom.Blockquote:
+		r.block(n, "> ")
+
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header, atom.Footer, atom.Aside,
+		atom.Figure, atom.Figcaption, atom.Dl, atom.Dt, atom.Dd, atom.Address, atom.Details, atom.Summary:
+		r.block(n, "")
+
+	case atom.Ul, atom.Ol:
+		r.breakBlock()
+		list := htmlList{ordered: n.DataAtom == atom.Ol, next: 1}
+		if start, err := strconv.Atoi(htmlAttr(n, "start")); err == nil {
+			list.next = start
+		}
+		r.lists = append(r.lists, list)
+		r.children(n)
+		r.breakBlock()
+		r.lists = r.lists[:len(r.lists)-1]
+
+	case atom.Li:
+		marker := "- "
+		if depth := len(r.lists); depth > 0 && r.lists[depth-1].ordered {
+			marker = strconv.Itoa(r.lists[depth-1].next) + ". "
+			r.lists[depth-1].next++
+		}
+		indent := ""
+		if len(r.lists) > 1 {
+			indent = strings.Repeat("    ", len(r.lists)-1)
+		}
+		// Nested lists continue the outer list's run of lines
+		r.flush()
+		r.list = "li"
+		r.block(n, indent+marker)
+
+	case atom.Br:
+		r.inline.WriteString(lineBreak)
+
+	case atom.Hr:
+		r.breakBlock()
+		r.add("---")
+
+	case atom.Pre:
+		r.breakBlock()
+		if code := strings.Trim(htmlTextContent(n), "\n"); strings.TrimSpace(code) != "" {
+			r.add(fencedBlock(htmlCodeLanguage(n), code))
+		}
+
+	case atom.Code, atom.Kbd, atom.Samp:
+		if code := collapseHTMLText(htmlTextContent(n)); code != "" {
+			r.inline.WriteString("`" + code + "`")
+		}
+
+	case atom.Strong, atom.B:
+		r.inline.WriteString(emphasize(textSpan{text: r.capture(n), bold: true}))
+
+	case atom.Em, atom.I:
+		r.inline.WriteString(emphasize(textSpan{text: r.capture(n), italic: true}))
+
+	case atom.A:
+		text := strings.TrimSpace(r.capture(n))
+		href := strings.TrimSpace(htmlAttr(n, "href"))
+		if text != "" && href != "" && !strings.HasPrefix(href, "#") && !strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			text = "[" + text + "](" + href + ")"
+		}
+		r.inline.WriteString(padLike(htmlTextContent(n), text))
+
+	case atom.Table:
+		r.breakBlock()
+		if table := r.table(n); table != "" {
+			r.add(table)
+		}
+
+	default:
+		r.children(n)
+	}
+}
+
+// capture renders the children of an element as inline text, keeping the
+// element's leading and trailing whitespace
+func (r *htmlRenderer) capture(n *html.Node) string {
+	nested := &htmlRenderer{}
+	nested.children(n)
+	nested.flush()
+	return padLike(htmlTextContent(n), nested.text(" "))
+}
+
+// padLike surrounds text with a space where raw starts or ends with whitespace
+func padLike(raw, text string) string {
+	if text == "" {
+		return raw
+	}
+	if strings.TrimLeftFunc(raw, unicode.IsSpace) != raw {
+		text = " " + text
+	}
+	if strings.TrimRightFunc(raw, unicode.IsSpace) != raw {
+		text += " "
+	}
+	return text
+}
+
+// table renders the rows of a table (including thead/tbody/tfoot) as a Markdown table.
+// The first row is the header, whether it uses <th> or not.
+func (r *htmlRenderer) table(n *html.Node) string {
+	var rows [][]string
+	columns := 0
+
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			switch child.DataAtom {
+			case atom.Tr:
+				var row []string
+				for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom != atom.Td && cell.DataAtom != atom.Th {
+						continue
+					}
+					nested := &htmlRenderer{}
+					nested.children(cell)
+					nested.flush()
+					row = append(row, markdownCell(nested.text("\n")))
+
+					if span, err := strconv.Atoi(htmlAttr(cell, "colspan")); err == nil {
+						for k := 1; k < span && k < 64; k++ {
+							row = append(row, "")
+						}
+					}
+				}
+				if len(row) > columns {
+					columns = len(row)
+				}
+				rows = append(rows, row)
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(child)
+			case atom.Caption:
+				if caption := collapseHTMLText(htmlTextContent(child)); caption != "" {
+					r.add(caption)
+				}
+			}
+		}
+	}
+	walk(n)
+
+	return markdownTable(rows, columns)
+}
+
+// collapseHTMLText collapses whitespace the way a browser does, keeping <br> as line breaks
+func collapseHTMLText(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	text = strings.ReplaceAll(text, " "+lineBreak, lineBreak)
+	text = strings.ReplaceAll(text, lineBreak+" ", lineBreak)
+	return strings.TrimSpace(strings.ReplaceAll(text, lineBreak, "\n"))
+}
+
+// htmlTextContent returns the raw text of an element and its descendants
+func htmlTextContent(n *html.Node) string {
+	var text strings.Builder
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			text.WriteString(node.Data)
+		}
+		if node.DataAtom == atom.Br {
+			text.WriteString("\n")
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return text.String()
+}
+
+// htmlCodeLanguage reads the language of a <pre> from a "language-x" or "lang-x"
+// class on it or its <code> child
+func htmlCodeLanguage(pre *html.Node) string {
+	nodes := []*html.Node{pre}
+	if code := findHTMLElement(pre, atom.Code); code != nil {
+		nodes = append(nodes, code)
+	}
+	for _, node := range nodes {
+		for _, class := range strings.Fields(htmlAttr(node, "class")) {
+			for _, prefix := range []string{"language-", "lang-"} {
+				if strings.HasPrefix(class, prefix) {
+					return strings.TrimPrefix(class, prefix)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// findHTMLElement returns the first element of the type in document order
+func findHTMLElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findHTMLElement(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
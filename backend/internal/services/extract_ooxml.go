@@ -0,0 +1,111 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ooxmlNode is a generic element of an Office Open XML part (DOCX, PPTX).
+// Elements are matched by their local name, namespaces are ignored.
+type ooxmlNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr  `xml:",any,attr"`
+	Text    string      `xml:",chardata"`
+	Nodes   []ooxmlNode `xml:",any"`
+}
+
+// attr returns the value of the attribute with the local name
+func (n *ooxmlNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// child returns the first child element with the local name
+func (n *ooxmlNode) child(name string) *ooxmlNode {
+	for i := range n.Nodes {
+		if n.Nodes[i].XMLName.Local == name {
+			return &n.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// flag reports whether a toggle property like <w:b/> is on (w:val may turn it off)
+func (n *ooxmlNode) flag(name string) bool {
+	property := n.child(name)
+	if property == nil {
+		return false
+	}
+	switch property.attr("val") {
+	case "0", "false", "off", "none":
+		return false
+	}
+	return true
+}
+
+// readOOXMLPart parses a part of the package, or returns nil if it doesn't exist
+func readOOXMLPart(archive *zip.Reader, name, format string) (*ooxmlNode, error) {
+	for _, file := range archive.File {
+		if file.Name != name {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s: %w", format, name, err)
+		}
+		defer reader.Close()
+
+		var node ooxmlNode
+		if err := xml.NewDecoder(io.LimitReader(reader, maxOOXMLPartSize)).Decode(&node); err != nil {
+			return nil, fmt.Errorf("invalid %s: %s: %w", format, name, err)
+		}
+		return &node, nil
+	}
+	return nil, nil
+}
+
+// maxOOXMLPartSize guards against zip bombs, uncompressed parts are rarely above a few MB
+const maxOOXMLPartSize = 64 << 20
+
+// relationshipID returns the r:id attribute, which links to a target in the part's relationships
+func (n *ooxmlNode) relationshipID() string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == "id" && strings.HasSuffix(a.Name.Space, "/relationships") {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// readRelationships reads the relationships of a part (ID -> target). Targets of
+// other parts are resolved to their path in the package; external targets (URLs) are kept.
+func readRelationships(archive *zip.Reader, partName, format string) (map[string]string, error) {
+	relsName := path.Join(path.Dir(partName), "_rels", path.Base(partName)+".rels")
+	rels, err := readOOXMLPart(archive, relsName, format)
+	if err != nil || rels == nil {
+		return map[string]string{}, err
+	}
+
+	targets := make(map[string]string, len(rels.Nodes))
+	for _, rel := range rels.Nodes {
+		target := rel.attr("Target")
+		if rel.attr("TargetMode") != "External" {
+			if strings.HasPrefix(target, "/") {
+				target = strings.TrimPrefix(target, "/")
+			} else {
+				target = path.Join(path.Dir(partName), target)
+			}
+		}
+		targets[rel.attr("Id")] = target
+	}
+	return targets, nil
+}
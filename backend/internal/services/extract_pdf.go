@@ -0,0 +1,236 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"github.com/ui-agentbedrock/backend/internal/models"
+)
+
+// maxPDFTreeDepth bounds the nesting of the page tree
+const maxPDFTreeDepth = 32
+
+// extractFromPDF extracts the text layer of every page. Each page starts with a
+// [Page N] marker so the agent can cite page numbers.
+func (s *ExtractionService) extractFromPDF(ctx context.Context, content []byte) (extraction *Extraction, err error) {
+	// Resolving pages panics on a malformed cross-reference table too
+	defer func() {
+		if r := recover(); r != nil {
+			extraction, err = nil, fmt.Errorf("invalid PDF: %v", r)
+		}
+	}()
+
+	reader, err := openPDF(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var text strings.Builder
+	var pages []models.PageStats
+	total := 0
+	for i, page := range pdfPages(reader, len(content)) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		number := i + 1
+
+		pageText, err := pdfPageText(page)
+		if err != nil {
+			// Keep the other pages, this one is reported with 0 characters
+			log.Printf("Warning: Failed to extract text from PDF page %d: %v", number, err)
+		}
+
+		chars := utf8.RuneCountInString(pageText)
+		pages = append(pages, models.PageStats{Page: number, Chars: chars})
+		total += chars
+
+		if text.Len() > 0 {
+			text.WriteString("\n\n")
+		}
+		fmt.Fprintf(&text, "[Page %d]\n%s", number, pageText)
+	}
+
+	if total == 0 {
+		return nil, ErrNoExtractableText
+	}
+	return &Extraction{Content: text.String(), Pages: pages}, nil
+}
+
+// pdfPages returns the pages found in the page tree. The page count the file
+// declares isn't trusted: it can be far larger than the tree, and reader.Page
+// never returns for numbers past the last page. The walk is bounded by the file
+// size since a malformed tree can contain cycles.
+func pdfPages(reader *pdf.Reader, size int) []pdf.Page {
+	budget := size/16 + 1 // No object is shorter than that
+	var pages []pdf.Page
+	var walk func(node pdf.Value, depth int)
+	walk = func(node pdf.Value, depth int) {
+		if budget--; budget < 0 {
+			return
+		}
+		switch node.Key("Type").Name() {
+		case "Page":
+			pages = append(pages, pdf.Page{V: node})
+		case "Pages":
+			if depth >= maxPDFTreeDepth {
+				return
+			}
+			kids := node.Key("Kids")
+			for i := 0; i < kids.Len() && budget > 0; i++ {
+				walk(kids.Index(i), depth+1)
+			}
+		}
+	}
+	walk(reader.Trailer().Key("Root").Key("Pages"), 0)
+	return pages
+}
+
+// openPDF parses the PDF's cross-reference table. Encrypted PDFs only open if
+// they have an empty user password (i.e. they merely restrict editing).
+func openPDF(content []byte) (reader *pdf.Reader, err error) {
+	// The parser panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			reader, err = nil, fmt.Errorf("invalid PDF: %v", r)
+		}
+	}()
+
+	reader, err = pdf.NewReader(bytes.NewReader(content), int64(len(content)))
+	switch {
+	case errors.Is(err, pdf.ErrInvalidPassword):
+		return nil, ErrEncryptedDocument
+	case err != nil && bytes.Contains(content, []byte("/Encrypt")):
+		// Encryption schemes the parser doesn't support
+		return nil, ErrEncryptedDocument
+	case err != nil:
+		return nil, fmt.Errorf("invalid PDF: %w", err)
+	}
+	return reader, nil
+}
+
+// pdfPageText lays out the glyphs of a page as lines of text. Glyphs are grouped
+// into lines by their baseline, words are separated where the gap between two
+// glyphs is wider than a space, and a larger vertical gap starts a new paragraph.
+func pdfPageText(page pdf.Page) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("%v", r)
+		}
+	}()
+
+	glyphs := page.Content().Text
+	if len(glyphs) == 0 {
+		return "", nil
+	}
+
+	// Top to bottom, then left to right
+	sort.SliceStable(glyphs, func(i, j int) bool {
+		if glyphs[i].Y != glyphs[j].Y {
+			return glyphs[i].Y > glyphs[j].Y
+		}
+		return glyphs[i].X < glyphs[j].X
+	})
+
+	var lines [][]pdf.Text
+	for _, glyph := range glyphs {
+		if n := len(lines); n > 0 {
+			first := lines[n-1][0]
+			if math.Abs(first.Y-glyph.Y) <= pdfLineTolerance(first) {
+				lines[n-1] = append(lines[n-1], glyph)
+				continue
+			}
+		}
+		lines = append(lines, []pdf.Text{glyph})
+	}
+
+	var out strings.Builder
+	for i, line := range lines {
+		sort.SliceStable(line, func(a, b int) bool { return line[a].X < line[b].X })
+
+		if i > 0 {
+			out.WriteByte('\n')
+			// A gap of more than about two lines separates paragraphs
+			previous := lines[i-1][0]
+			if previous.Y-line[0].Y > 2*pdfFontSize(previous) {
+				out.WriteByte('\n')
+			}
+		}
+		out.WriteString(pdfLineText(line))
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// pdfLineText joins the glyphs of one line, inserting spaces at word gaps.
+// Fonts without a widths table give glyphs no width; their gaps are measured
+// against the line's typical glyph advance instead, which still separates the
+// columns of tables.
+func pdfLineText(line []pdf.Text) string {
+	advance := pdfTypicalAdvance(line)
+
+	var out strings.Builder
+	for i, glyph := range line {
+		if i > 0 {
+			previous := line[i-1]
+
+			// Fake bold draws each glyph twice, slightly offset
+			if glyph.S == previous.S && glyph.X-previous.X < 0.15*pdfFontSize(glyph) {
+				continue
+			}
+
+			separated := false
+			if previous.W > 0 {
+				separated = glyph.X-(previous.X+previous.W) > 0.2*pdfFontSize(glyph)
+			} else if advance > 0 {
+				separated = glyph.X-previous.X > 2.5*advance
+			}
+			if separated && !endsWithSpace(previous.S) && !strings.HasPrefix(glyph.S, " ") {
+				out.WriteByte(' ')
+			}
+		}
+		out.WriteString(glyph.S)
+	}
+	return strings.TrimRightFunc(out.String(), unicode.IsSpace)
+}
+
+// pdfTypicalAdvance is the median distance between neighbouring glyphs of a line
+func pdfTypicalAdvance(line []pdf.Text) float64 {
+	advances := make([]float64, 0, len(line))
+	for i := 1; i < len(line); i++ {
+		if advance := line[i].X - line[i-1].X; advance > 0.15*pdfFontSize(line[i]) {
+			advances = append(advances, advance)
+		}
+	}
+	if len(advances) == 0 {
+		return 0
+	}
+
+	sort.Float64s(advances)
+	return advances[len(advances)/2]
+}
+
+// pdfLineTolerance is how far apart two baselines may be and still count as one
+// line (sub- and superscripts sit slightly off the baseline)
+func pdfLineTolerance(glyph pdf.Text) float64 {
+	return pdfFontSize(glyph) / 2
+}
+
+func pdfFontSize(glyph pdf.Text) float64 {
+	if glyph.FontSize <= 0 {
+		return 10 // Reasonable default for PDFs without font sizes
+	}
+	return glyph.FontSize
+}
+
+func endsWithSpace(s string) bool {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return unicode.IsSpace(r)
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ui-agentbedrock/backend/internal/models"
+)
+
+// extractFromPPTX extracts the text of each slide in presentation order, with
+// its title as heading, bullet levels, tables, links and the speaker notes.
+// Pages holds the characters per slide.
+func (s *ExtractionService) extractFromPPTX(ctx context.Context, content []byte) (*Extraction, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		if isCompoundFile(content) {
+			return nil, ErrEncryptedDocument
+		}
+		return nil, fmt.Errorf("invalid PPTX: %w", err)
+	}
+
+	slides, err := pptxSlideParts(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	var sections []string
+	var pages []models.PageStats
+	total := 0
+	for i, part := range slides {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		slide, err := readPPTXSlide(archive, part)
+		if err != nil {
+			return nil, err
+		}
+
+		heading := fmt.Sprintf("## Slide %d", i+1)
+		if slide.title != "" {
+			heading += ": " + slide.title
+		}
+		if slide.hidden {
+			heading += " (hidden)"
+		}
+
+		section := []string{heading}
+		section = append(section, slide.blocks...)
+		if len(slide.notes) > 0 {
+			section = append(section, "**Notes:** "+strings.Join(slide.notes, "\n"))
+		}
+		sections = append(sections, strings.Join(section, "\n\n"))
+
+		chars := utf8.RuneCountInString(slide.title)
+		for _, block := range append(slide.blocks, slide.notes...) {
+			chars += utf8.RuneCountInString(block)
+		}
+		pages = append(pages, models.PageStats{Page: i + 1, Chars: chars})
+		total += chars
+	}
+
+	if total == 0 {
+		return nil, ErrNoExtractableText
+	}
+	return &Extraction{Content: strings.Join(sections, "\n\n"), Pages: pages}, nil
+}
+
+// pptxSlideParts returns the slide part names in presentation order
+func pptxSlideParts(archive *zip.Reader) ([]string, error) {
+	presentation, err := readOOXMLPart(archive, "ppt/presentation.xml", "PPTX")
+	if err != nil {
+		return nil, err
+	}
+	if presentation == nil {
+		return nil, fmt.Errorf("invalid PPTX: ppt/presentation.xml is missing")
+	}
+	rels, err := readRelationships(archive, "ppt/presentation.xml", "PPTX")
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []string
+	if list := presentation.child("sldIdLst"); list != nil {
+		for _, slide := range list.Nodes {
+			if target, ok := rels[slide.relationshipID()]; ok {
+				parts = append(parts, target)
+			}
+		}
+	}
+	return parts, nil
+}
+
+// pptxSlide is the rendered text of a slide
+type pptxSlide struct {
+	title  string
+	blocks []string
+	notes  []string
+	hidden bool
+}
+
+func readPPTXSlide(archive *zip.Reader, part string) (*pptxSlide, error) {
+	root, err := readOOXMLPart(archive, part, "PPTX")
+	if err != nil || root == nil {
+		return &pptxSlide{}, err
+	}
+	rels, err := readRelationships(archive, part, "PPTX")
+	if err != nil {
+		return nil, err
+	}
+
+	slide := &pptxSlide{hidden: root.attr("show") == "0"}
+	renderer := &pptxRenderer{relationships: rels}
+	if tree := pptxShapeTree(root); tree != nil {
+		renderer.shapes(tree, slide)
+	}
+
+	// The notes page links back to its slide; only the notes text itself is wanted
+	for _, target := range rels {
+		if !strings.Contains(target, "notesSlides/") {
+			continue
+		}
+		notesRoot, err := readOOXMLPart(archive, target, "PPTX")
+		if err != nil {
+			return nil, err
+		}
+		if tree := pptxShapeTree(notesRoot); tree != nil {
+			notesRels, err := readRelationships(archive, target, "PPTX")
+			if err != nil {
+				return nil, err
+			}
+			notes := &pptxSlide{}
+			(&pptxRenderer{relationships: notesRels, notesOnly: true}).shapes(tree, notes)
+			slide.notes = notes.blocks
+		}
+	}
+	return slide, nil
+}
+
+func pptxShapeTree(root *ooxmlNode) *ooxmlNode {
+	if root == nil {
+		return nil
+	}
+	if cSld := root.child("cSld"); cSld != nil {
+		return cSld.child("spTree")
+	}
+	return nil
+}
+
+// pptxRenderer renders the shapes of a slide or notes page
+type pptxRenderer struct {
+	relationships map[string]string
+	notesOnly     bool // Only the body placeholder of a notes page (not the slide image or number)
+}
+
+func (r *pptxRenderer) shapes(tree *ooxmlNode, slide *pptxSlide) {
+	for i := range tree.Nodes {
+		shape := &tree.Nodes[i]
+		switch shape.XMLName.Local {
+		case "sp":
+			r.shape(shape, slide)
+		case "grpSp":
+			r.shapes(shape, slide)
+		case "graphicFrame":
+			if r.notesOnly {
+				continue
+			}
+			if table := r.table(shape); table != "" {
+				slide.blocks = append(slide.blocks, table)
+			}
+		case "AlternateContent":
+			if choice := shape.child("Choice"); choice != nil {
+				r.shapes(choice, slide)
+			}
+		}
+	}
+}
+
+// shape renders a text shape: the title placeholder becomes the slide title,
+// paragraphs of body placeholders or with bullets become list items
+func (r *pptxRenderer) shape(shape *ooxmlNode, slide *pptxSlide) {
+	placeholder, isPlaceholder := pptxPlaceholder(shape)
+	switch placeholder {
+	case "sldNum", "dt", "ftr", "hdr", "sldImg":
+		return
+	}
+	if r.notesOnly && placeholder != "body" {
+		return
+	}
+
+	body := shape.child("txBody")
+	if body == nil {
+		return
+	}
+
+	if placeholder == "title" || placeholder == "ctrTitle" {
+		var lines []string
+		for i := range body.Nodes {
+			if body.Nodes[i].XMLName.Local == "p" {
+				if text := strings.TrimSpace(r.paragraphText(&body.Nodes[i])); text != "" {
+					lines = append(lines, text)
+				}
+			}
+		}
+		title := strings.ReplaceAll(strings.Join(lines, " "), "\n", " ")
+		if slide.title == "" {
+			slide.title = title
+		} else if title != "" {
+			slide.blocks = append(slide.blocks, "**"+title+"**")
+		}
+		return
+	}
+
+	// Placeholders without a type are content placeholders, bulleted by the layout
+	bulleted := !r.notesOnly && isPlaceholder && (placeholder == "" || placeholder == "body" || placeholder == "obj")
+
+	var lines []string
+	for i := range body.Nodes {
+		p := &body.Nodes[i]
+		if p.XMLName.Local != "p" {
+			continue
+		}
+		text := strings.TrimSpace(r.paragraphText(p))
+		if text == "" {
+			continue
+		}
+
+		level, bullet := 0, bulleted
+		if pPr := p.child("pPr"); pPr != nil {
+			level, _ = strconv.Atoi(pPr.attr("lvl"))
+			if pPr.child("buChar") != nil || pPr.child("buAutoNum") != nil {
+				bullet = true
+			}
+			if pPr.child("buNone") != nil {
+				bullet = false
+			}
+		}
+		if !bullet {
+			lines = append(lines, text)
+			continue
+		}
+		indent := strings.Repeat("    ", level)
+		lines = append(lines, indent+"- "+strings.ReplaceAll(text, "\n", "\n"+indent+"  "))
+	}
+	if len(lines) > 0 {
+		slide.blocks = append(slide.blocks, strings.Join(lines, "\n"))
+	}
+}
+
+// pptxPlaceholder returns the placeholder type of a shape ("" for a content
+// placeholder) and whether the shape is a placeholder at all
+func pptxPlaceholder(shape *ooxmlNode) (string, bool) {
+	if nvSpPr := shape.child("nvSpPr"); nvSpPr != nil {
+		if nvPr := nvSpPr.child("nvPr"); nvPr != nil {
+			if ph := nvPr.child("ph"); ph != nil {
+				return ph.attr("type"), true
+			}
+		}
+	}
+	return "", false
+}
+
+// paragraphText renders the runs of a DrawingML paragraph with links and line breaks
+func (r *pptxRenderer) paragraphText(p *ooxmlNode) string {
+	var text strings.Builder
+	for i := range p.Nodes {
+		run := &p.Nodes[i]
+		switch run.XMLName.Local {
+		case "r", "fld":
+			t := run.child("t")
+			if t == nil {
+				continue
+			}
+			if rPr := run.child("rPr"); rPr != nil {
+				if link := rPr.child("hlinkClick"); link != nil {
+					if target := r.relationships[link.relationshipID()]; strings.Contains(target, "://") && strings.TrimSpace(t.Text) != "" {
+						text.WriteString("[" + strings.TrimSpace(t.Text) + "](" + target + ")")
+						continue
+					}
+				}
+			}
+			text.WriteString(t.Text)
+		case "br":
+			text.WriteString("\n")
+		}
+	}
+	return text.String()
+}
+
+// table renders a DrawingML table of a graphic frame as a Markdown table
+func (r *pptxRenderer) table(frame *ooxmlNode) string {
+	graphic := frame.child("graphic")
+	if graphic == nil || graphic.child("graphicData") == nil {
+		return ""
+	}
+	tbl := graphic.child("graphicData").child("tbl")
+	if tbl == nil {
+		return ""
+	}
+
+	var rows [][]string
+	columns := 0
+	for i := range tbl.Nodes {
+		tr := &tbl.Nodes[i]
+		if tr.XMLName.Local != "tr" {
+			continue
+		}
+
+		// Cells covered by a merge are still there (empty), so the columns line up
+		var row []string
+		for j := range tr.Nodes {
+			tc := &tr.Nodes[j]
+			if tc.XMLName.Local != "tc" {
+				continue
+			}
+			var lines []string
+			if body := tc.child("txBody"); body != nil {
+				for k := range body.Nodes {
+					if body.Nodes[k].XMLName.Local == "p" {
+						lines = append(lines, strings.TrimSpace(r.paragraphText(&body.Nodes[k])))
+					}
+				}
+			}
+			row = append(row, markdownCell(strings.Join(lines, "\n")))
+		}
+		if len(row) > columns {
+			columns = len(row)
+		}
+		rows = append(rows, row)
+	}
+	return markdownTable(rows, columns)
+}
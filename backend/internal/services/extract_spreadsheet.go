@@ -0,0 +1,396 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// SpreadsheetOptions limits how much of a spreadsheet ends up in the extracted text
+type SpreadsheetOptions struct {
+	MaxRows    int  // Data rows per sheet
+	MaxColumns int  // Columns per sheet
+	Sample     bool // Sample rows from the whole sheet instead of keeping the first MaxRows
+}
+
+// DefaultSpreadsheetOptions keeps the first 200 rows and 30 columns of each sheet
+var DefaultSpreadsheetOptions = SpreadsheetOptions{
+	MaxRows:    200,
+	MaxColumns: 30,
+}
+
+const (
+	headerDetectionRows = 10               // Leading rows searched for the header row
+	maxSpreadsheetCell  = 256              // Characters per cell, longer values are cut
+	maxSpreadsheetUnzip = 256 << 20        // Uncompressed size limit of a workbook
+	spreadsheetSeed     = 0x5eed5eed5eed5e // Fixed, so the same file always samples the same rows
+)
+
+var errEmptySpreadsheet = errors.New("the spreadsheet contains no data")
+
+// extractFromXLSX renders each sheet of a workbook as a Markdown table
+func (s *ExtractionService) extractFromXLSX(ctx context.Context, content []byte) (string, error) {
+	if isCompoundFile(content) {
+		// Encrypted OOXML files are wrapped in a compound file
+		return "", ErrEncryptedDocument
+	}
+
+	workbook, err := excelize.OpenReader(bytes.NewReader(content), excelize.Options{UnzipSizeLimit: maxSpreadsheetUnzip})
+	if err != nil {
+		return "", fmt.Errorf("invalid XLSX: %w", err)
+	}
+	defer workbook.Close()
+
+	var sections []string
+	for _, name := range workbook.GetSheetList() {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		table := newSheetTable(s.spreadsheet)
+		if err := readSheet(workbook, name, table); err != nil {
+			// Chart sheets and the like have no cells
+			sections = append(sections, fmt.Sprintf("## Sheet: %s\n\n_Could not be read: %v_", name, err))
+			continue
+		}
+		if table.empty() {
+			continue
+		}
+
+		heading := "## Sheet: " + name
+		if visible, err := workbook.GetSheetVisible(name); err == nil && !visible {
+			heading += " (hidden)"
+		}
+		sections = append(sections, heading+"\n\n"+table.markdown())
+	}
+
+	if len(sections) == 0 {
+		return "", errEmptySpreadsheet
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+func readSheet(workbook *excelize.File, name string, table *sheetTable) error {
+	rows, err := workbook.Rows(name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		// Columns returns the cells formatted as displayed, e.g. dates and percentages
+		cells, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		table.add(cells)
+	}
+	return rows.Error()
+}
+
+// extractFromDelimited renders a CSV or TSV file as a Markdown table. With
+// comma 0 the delimiter is detected from the first line (",", ";", tab or "|").
+func (s *ExtractionService) extractFromDelimited(ctx context.Context, content []byte, comma rune) (string, error) {
+	content = bytes.TrimPrefix(content, []byte{0xEF, 0xBB, 0xBF})
+	if !utf8.Valid(content) {
+		// Spreadsheet exports without UTF-8 are almost always Latin-1/Windows-1252
+		content = latin1ToUTF8(content)
+	}
+	if comma == 0 {
+		comma = detectDelimiter(content)
+	}
+
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	table := newSheetTable(s.spreadsheet)
+	for line := 0; ; line++ {
+		if line%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+		}
+
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid CSV: %w", err)
+		}
+		table.add(record)
+	}
+
+	if table.empty() {
+		return "", errEmptySpreadsheet
+	}
+	return table.markdown(), nil
+}
+
+// detectDelimiter picks the most frequent candidate delimiter of the first line
+func detectDelimiter(content []byte) rune {
+	line := content
+	if end := bytes.IndexByte(content, '\n'); end >= 0 {
+		line = content[:end]
+	}
+
+	best, bestCount := ',', 0
+	for _, candidate := range []rune{',', ';', '\t', '|'} {
+		if count := bytes.Count(line, []byte(string(candidate))); count > bestCount {
+			best, bestCount = candidate, count
+		}
+	}
+	return best
+}
+
+func latin1ToUTF8(content []byte) []byte {
+	runes := make([]rune, len(content))
+	for i, b := range content {
+		runes[i] = rune(b)
+	}
+	return []byte(string(runes))
+}
+
+// isCompoundFile reports whether content is an OLE2 compound file: legacy Office
+// formats (.doc, .xls) and password protected OOXML files
+func isCompoundFile(content []byte) bool {
+	return bytes.HasPrefix(content, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1})
+}
+
+// sheetTable collects the rows of a sheet as they are read. The first rows are
+// kept to detect the header; after it only MaxRows data rows are held, either
+// the first ones or, when sampling, the first half plus a reservoir sample of the rest.
+type sheetTable struct {
+	options SpreadsheetOptions
+	random  *rand.Rand
+
+	lead     [][]string // Leading rows, until the header is detected
+	detected bool
+	titles   []string // Rows above the header, e.g. a report title
+	header   []string // nil if the sheet has no header row
+
+	rows    []sampledRow
+	total   int // Data rows seen
+	columns int // Widest row seen
+}
+
+type sampledRow struct {
+	index int
+	cells []string
+}
+
+func newSheetTable(options SpreadsheetOptions) *sheetTable {
+	if options.MaxRows <= 0 {
+		options.MaxRows = DefaultSpreadsheetOptions.MaxRows
+	}
+	if options.MaxColumns <= 0 {
+		options.MaxColumns = DefaultSpreadsheetOptions.MaxColumns
+	}
+	return &sheetTable{
+		options: options,
+		random:  rand.New(rand.NewSource(spreadsheetSeed)),
+	}
+}
+
+// add adds a row; empty rows are dropped
+func (t *sheetTable) add(cells []string) {
+	cells = trimRow(cells)
+	if len(cells) == 0 {
+		return
+	}
+	if len(cells) > t.columns {
+		t.columns = len(cells)
+	}
+
+	if t.detected {
+		t.addData(cells)
+		return
+	}
+	t.lead = append(t.lead, cells)
+	if len(t.lead) == headerDetectionRows {
+		t.detectHeader()
+	}
+}
+
+func (t *sheetTable) empty() bool {
+	return len(t.lead) == 0 && !t.detected
+}
+
+// detectHeader splits the leading rows into title rows, the header row and
+// data rows. The header is the first row that fills most columns with distinct
+// text; a numeric first row means the sheet has no header.
+func (t *sheetTable) detectHeader() {
+	lead := t.lead
+	t.lead = nil
+	t.detected = true
+
+	width := 0
+	for _, row := range lead {
+		if filled := filledCells(row); filled > width {
+			width = filled
+		}
+	}
+
+	start := 0
+	for i, row := range lead {
+		filled := filledCells(row)
+		if width >= 3 && filled < (width+1)/2 {
+			// A title or note above the table
+			continue
+		}
+		if looksLikeHeader(row) {
+			t.header = row
+			start = i + 1
+			for _, title := range lead[:i] {
+				t.titles = append(t.titles, strings.Join(nonEmpty(title), " "))
+			}
+		}
+		break
+	}
+
+	for _, row := range lead[start:] {
+		t.addData(row)
+	}
+}
+
+func (t *sheetTable) addData(cells []string) {
+	index := t.total
+	t.total++
+
+	limit := t.options.MaxRows
+	keepFirst := limit
+	if t.options.Sample {
+		keepFirst = limit / 2
+	}
+
+	switch {
+	case index < keepFirst:
+		t.rows = append(t.rows, sampledRow{index, cells})
+	case !t.options.Sample:
+	case len(t.rows) < limit:
+		t.rows = append(t.rows, sampledRow{index, cells})
+	default:
+		// Reservoir sampling over the rows after the first ones
+		if slot := t.random.Intn(index - keepFirst + 1); slot < limit-keepFirst {
+			t.rows[keepFirst+slot] = sampledRow{index, cells}
+		}
+	}
+}
+
+// markdown renders the title rows, the table and notes on what was left out
+func (t *sheetTable) markdown() string {
+	if !t.detected {
+		t.detectHeader()
+	}
+	sort.Slice(t.rows, func(i, j int) bool { return t.rows[i].index < t.rows[j].index })
+
+	columns := t.columns
+	if columns > t.options.MaxColumns {
+		columns = t.options.MaxColumns
+	}
+
+	header := t.header
+	if header == nil {
+		header = make([]string, columns)
+		for i := range header {
+			header[i], _ = excelize.ColumnNumberToName(i + 1)
+		}
+	}
+
+	table := [][]string{tableRow(header, columns)}
+	for _, row := range t.rows {
+		table = append(table, tableRow(row.cells, columns))
+	}
+
+	var parts []string
+	parts = append(parts, t.titles...)
+	parts = append(parts, markdownTable(table, columns))
+
+	var notes []string
+	switch {
+	case len(t.rows) < t.total && t.options.Sample:
+		notes = append(notes, fmt.Sprintf("Sampled %d of %d rows: the first %d and %d spread over the rest.",
+			len(t.rows), t.total, t.options.MaxRows/2, len(t.rows)-t.options.MaxRows/2))
+	case len(t.rows) < t.total:
+		notes = append(notes, fmt.Sprintf("Showing the first %d of %d rows.", len(t.rows), t.total))
+	}
+	if hidden := t.columns - columns; hidden == 1 {
+		notes = append(notes, "1 more column not shown.")
+	} else if hidden > 1 {
+		notes = append(notes, fmt.Sprintf("%d more columns not shown.", hidden))
+	}
+	if len(notes) > 0 {
+		parts = append(parts, "_"+strings.Join(notes, " ")+"_")
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// tableRow cuts or pads a row to the column count and makes its cells Markdown safe
+func tableRow(cells []string, columns int) []string {
+	row := make([]string, columns)
+	for i := 0; i < columns && i < len(cells); i++ {
+		cell := cells[i]
+		if utf8.RuneCountInString(cell) > maxSpreadsheetCell {
+			cell = string([]rune(cell)[:maxSpreadsheetCell]) + "…"
+		}
+		row[i] = markdownCell(cell)
+	}
+	return row
+}
+
+// trimRow trims the cells and drops trailing empty ones
+func trimRow(cells []string) []string {
+	trimmed := make([]string, len(cells))
+	last := -1
+	for i, cell := range cells {
+		trimmed[i] = strings.TrimSpace(cell)
+		if trimmed[i] != "" {
+			last = i
+		}
+	}
+	return trimmed[:last+1]
+}
+
+func filledCells(row []string) int {
+	return len(nonEmpty(row))
+}
+
+func nonEmpty(row []string) []string {
+	var cells []string
+	for _, cell := range row {
+		if cell != "" {
+			cells = append(cells, cell)
+		}
+	}
+	return cells
+}
+
+// looksLikeHeader reports whether all filled cells are distinct and not numbers
+func looksLikeHeader(row []string) bool {
+	seen := map[string]bool{}
+	for _, cell := range nonEmpty(row) {
+		if isNumeric(cell) || seen[cell] {
+			return false
+		}
+		seen[cell] = true
+	}
+	return len(seen) > 0
+}
+
+func isNumeric(cell string) bool {
+	cell = strings.NewReplacer(",", "", "%", "", "$", "", "€", "", " ", "").Replace(cell)
+	_, err := strconv.ParseFloat(cell, 64)
+	return err == nil
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultStructuredLimit is the default size cap of pretty-printed data and source files
+const DefaultStructuredLimit = 100_000
+
+// sourceLanguages maps the extensions of supported source files to the
+// language tag of their fenced code block. The extension is the file type.
+var sourceLanguages = map[string]string{
+	"go": "go", "py": "python", "js": "javascript", "mjs": "javascript", "jsx": "jsx",
+	"ts": "typescript", "tsx": "tsx", "vue": "vue", "java": "java", "kt": "kotlin",
+	"scala": "scala", "groovy": "groovy", "gradle": "groovy", "rb": "ruby", "php": "php",
+	"rs": "rust", "c": "c", "h": "c", "cpp": "cpp", "cc": "cpp", "hpp": "cpp",
+	"cs": "csharp", "swift": "swift", "m": "objectivec", "r": "r", "lua": "lua", "pl": "perl",
+	"sh": "bash", "bash": "bash", "zsh": "bash", "ps1": "powershell", "sql": "sql",
+	"css": "css", "scss": "scss", "less": "less", "proto": "protobuf", "tf": "hcl",
+	"toml": "toml", "ini": "ini", "dart": "dart", "ex": "elixir", "exs": "elixir",
+	"hs": "haskell", "clj": "clojure", "graphql": "graphql",
+}
+
+// SourceLanguage returns the language tag of a source file type, if it is one
+func SourceLanguage(fileType string) (string, bool) {
+	language, ok := sourceLanguages[fileType]
+	return language, ok
+}
+
+// SourceFileTypes returns the file types (extensions) of the supported source files
+func SourceFileTypes() []string {
+	types := make([]string, 0, len(sourceLanguages))
+	for fileType := range sourceLanguages {
+		types = append(types, fileType)
+	}
+	return types
+}
+
+// extractFromJSON pretty-prints a JSON document in a fenced block
+func (s *ExtractionService) extractFromJSON(ctx context.Context, content []byte) (string, error) {
+	content = bytes.TrimPrefix(content, []byte{0xEF, 0xBB, 0xBF})
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, bytes.TrimSpace(content), "", "  "); err != nil {
+		// JSON Lines files are a sequence of documents
+		out.Reset()
+		if lineErr := indentJSONLines(&out, content); lineErr != nil {
+			return "", fmt.Errorf("invalid JSON: %w", err)
+		}
+	}
+	return s.fenced("json", out.String())
+}
+
+func indentJSONLines(out *bytes.Buffer, content []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	for count := 0; ; count++ {
+		var value json.RawMessage
+		err := decoder.Decode(&value)
+		if err == io.EOF && count > 0 {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			out.WriteString("\n")
+		}
+		if err := json.Indent(out, value, "", "  "); err != nil {
+			return err
+		}
+	}
+}
+
+// extractFromYAML re-indents a YAML file (all of its documents) in a fenced block.
+// Comments are kept.
+func (s *ExtractionService) extractFromYAML(ctx context.Context, content []byte) (string, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	for {
+		var document yaml.Node
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid YAML: %w", err)
+		}
+		if err := encoder.Encode(&document); err != nil {
+			return "", fmt.Errorf("invalid YAML: %w", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("invalid YAML: %w", err)
+	}
+	return s.fenced("yaml", out.String())
+}
+
+// extractFromXML re-indents an XML document in a fenced block
+func (s *ExtractionService) extractFromXML(ctx context.Context, content []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	// Documents in other encodings are passed through undecoded rather than rejected
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) { return input, nil }
+	decoder.Strict = false
+
+	var out bytes.Buffer
+	encoder := xml.NewEncoder(&out)
+	encoder.Indent("", "  ")
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid XML: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			// Indentation is added by the encoder
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+			token = xml.CharData(bytes.TrimSpace(t))
+		case xml.ProcInst:
+			// The encoder only allows the declaration at the start and writes it itself
+			if t.Target == "xml" {
+				continue
+			}
+		}
+		if err := encoder.EncodeToken(xml.CopyToken(token)); err != nil {
+			return "", fmt.Errorf("invalid XML: %w", err)
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return "", fmt.Errorf("invalid XML: %w", err)
+	}
+	return s.fenced("xml", out.String())
+}
+
+// extractFromSource puts a source file in a fenced block tagged with its language
+func (s *ExtractionService) extractFromSource(ctx context.Context, content []byte, language string) (string, error) {
+	content = bytes.TrimPrefix(content, []byte{0xEF, 0xBB, 0xBF})
+	if !utf8.Valid(content) {
+		return "", fmt.Errorf("the file is not UTF-8 text")
+	}
+	return s.fenced(language, string(content))
+}
+
+// fenced returns text as a fenced code block, cut at a line end if it is over the size cap
+func (s *ExtractionService) fenced(language, text string) (string, error) {
+	text = strings.TrimRight(text, "\n\r\t ")
+	if strings.TrimSpace(text) == "" {
+		return "", ErrNoExtractableText
+	}
+
+	limit := s.structuredLimit
+	if limit <= 0 {
+		limit = DefaultStructuredLimit
+	}
+	var note string
+	if total := utf8.RuneCountInString(text); total > limit {
+		// Cut after the limit-th character, then back to the last line end
+		cut, chars := 0, 0
+		for cut = range text {
+			if chars == limit {
+				break
+			}
+			chars++
+		}
+		text = text[:cut]
+		if end := strings.LastIndexByte(text, '\n'); end > 0 {
+			text = text[:end]
+		}
+		note = fmt.Sprintf("\n\n_Truncated: showing the first %d of %d characters._", utf8.RuneCountInString(text), total)
+	}
+	return fencedBlock(language, text) + note, nil
+}
+
+// fencedBlock wraps code in a fence longer than any backtick run inside it
+func fencedBlock(language, code string) string {
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fence + language + "\n" + code + "\n" + fence
+}
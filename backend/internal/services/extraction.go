@@ -3,66 +3,60 @@ package services
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/ui-agentbedrock/backend/internal/models"
 )
 
 // ExtractionService handles text extraction from various document formats
 type ExtractionService struct {
-	// Future: Can add caching, rate limiting, etc.
+	docx            DocxOptions
+	spreadsheet     SpreadsheetOptions
+	structuredLimit int // Characters of pretty-printed data and source files
 }
 
 func NewExtractionService() *ExtractionService {
-	return &ExtractionService{}
+	return &ExtractionService{
+		docx:            DocxOptions{Footnotes: true},
+		spreadsheet:     DefaultSpreadsheetOptions,
+		structuredLimit: DefaultStructuredLimit,
+	}
 }
 
-// ExtractText extracts text content from a document based on file type
-func (s *ExtractionService) ExtractText(ctx context.Context, fileType string, fileContent []byte) (string, error) {
-	switch fileType {
-	case "pdf":
-		return s.extractFromPDF(ctx, fileContent)
-	case "docx":
-		return s.extractFromDOCX(ctx, fileContent)
-	case "doc":
-		return s.extractFromDOC(ctx, fileContent)
-	case "txt", "md":
-		return s.extractFromText(ctx, fileContent)
-	default:
-		return "", fmt.Errorf("unsupported file type: %s", fileType)
-	}
+// WithDocxOptions returns a copy of the service that includes the given optional parts of DOCX files
+func (s *ExtractionService) WithDocxOptions(options DocxOptions) *ExtractionService {
+	clone := *s
+	clone.docx = options
+	return &clone
+}
+
+// WithSpreadsheetOptions returns a copy of the service with the given row and column limits for spreadsheets
+func (s *ExtractionService) WithSpreadsheetOptions(options SpreadsheetOptions) *ExtractionService {
+	clone := *s
+	clone.spreadsheet = options
+	return &clone
 }
 
-// extractFromPDF extracts text from PDF files
-// Note: This is a placeholder. In production, use a PDF library like go-fitz or pdfcpu
-func (s *ExtractionService) extractFromPDF(ctx context.Context, content []byte) (string, error) {
-	// TODO: Implement PDF extraction using github.com/gen2brain/go-fitz
-	// For now, return a placeholder message
-	// In production, this would use:
-	// doc, err := fitz.NewFromMemory(content)
-	// if err != nil { return "", err }
-	// defer doc.Close()
-	// var text strings.Builder
-	// for i := 0; i < doc.NumPage(); i++ {
-	//     pageText := doc.Text(i)
-	//     text.WriteString(pageText)
-	// }
-	// return text.String(), nil
-
-	return "", fmt.Errorf("PDF extraction not yet implemented. Please install PDF extraction library")
+// WithStructuredLimit returns a copy of the service that cuts JSON, YAML, XML and
+// source files after maxChars characters
+func (s *ExtractionService) WithStructuredLimit(maxChars int) *ExtractionService {
+	clone := *s
+	clone.structuredLimit = maxChars
+	return &clone
 }
 
-// extractFromDOCX extracts text from DOCX files
-// Note: This is a placeholder. In production, use a DOCX library like unidoc/unioffice
-func (s *ExtractionService) extractFromDOCX(ctx context.Context, content []byte) (string, error) {
-	// TODO: Implement DOCX extraction using github.com/unidoc/unioffice
-	// For now, return a placeholder message
-	// In production, this would use:
-	// docx, err := document.ReadDocxFromMemory(bytes.NewReader(content), int64(len(content)))
-	// if err != nil { return "", err }
-	// defer docx.Close()
-	// return docx.GetContent(), nil
-
-	return "", fmt.Errorf("DOCX extraction not yet implemented. Please install DOCX extraction library")
+// ErrEncryptedDocument is returned for password protected documents
+var ErrEncryptedDocument = errors.New("the document is password protected, remove the protection and upload it again")
+
+// ErrNoExtractableText is returned for documents without a text layer, e.g. scanned PDFs
+var ErrNoExtractableText = errors.New("the document contains no extractable text (scanned or image-only pages need OCR)")
+
+// Extraction is the text extracted from a document
+type Extraction struct {
+	Content string
+	Pages   []models.PageStats // Characters per page (or slide), for paginated formats
 }
 
 // extractFromDOC extracts text from DOC files (legacy Word format)
@@ -71,6 +65,12 @@ func (s *ExtractionService) extractFromDOC(ctx context.Context, content []byte)
 	return "", fmt.Errorf("DOC format is not supported. Please convert to DOCX format")
 }
 
+// extractFromXLS extracts text from XLS files (legacy Excel format)
+func (s *ExtractionService) extractFromXLS(ctx context.Context, content []byte) (string, error) {
+	// Like DOC, the binary format is only read by the Lambda behind the S3 upload path
+	return "", fmt.Errorf("XLS format is not supported without the S3 upload. Please convert to XLSX or CSV format")
+}
+
 // extractFromText extracts text from plain text or markdown files
 func (s *ExtractionService) extractFromText(ctx context.Context, content []byte) (string, error) {
 	// Remove BOM if present
@@ -82,3 +82,75 @@ func (s *ExtractionService) extractFromText(ctx context.Context, content []byte)
 
 	return text, nil
 }
+
+// markdownTable renders rows as a Markdown table with the first row as header,
+// padding short rows to the given number of columns
+func markdownTable(rows [][]string, columns int) string {
+	if len(rows) == 0 || columns == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		out.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			out.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+		}
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// markdownCell makes text safe for a table cell: pipes escaped, line breaks as <br>
+func markdownCell(text string) string {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "|", "\\|")
+	return strings.ReplaceAll(text, "\n", "<br>")
+}
+
+// textSpan is text with its formatting, e.g. a run of a Word document
+type textSpan struct {
+	text         string
+	bold, italic bool
+}
+
+// emphasize wraps text in ** or * outside its surrounding whitespace
+func emphasize(span textSpan) string {
+	marker := ""
+	if span.bold {
+		marker += "**"
+	}
+	if span.italic {
+		marker += "*"
+	}
+	trimmed := strings.TrimSpace(span.text)
+	if marker == "" || trimmed == "" {
+		return span.text
+	}
+
+	start := strings.Index(span.text, trimmed)
+	return span.text[:start] + marker + trimmed + marker + span.text[start+len(trimmed):]
+}
+
+// markdownBlock is a rendered paragraph, list item or table. Consecutive items
+// of the same list are joined without a blank line so they stay one list.
+type markdownBlock struct {
+	text string
+	list string // Identifies the list of a list item
+}
+
+func joinMarkdownBlocks(blocks []markdownBlock) string {
+	var out strings.Builder
+	for i, block := range blocks {
+		if i > 0 {
+			if block.list != "" && block.list == blocks[i-1].list {
+				out.WriteString("\n")
+			} else {
+				out.WriteString("\n\n")
+			}
+		}
+		out.WriteString(block.text)
+	}
+	return out.String()
+}
@@ -0,0 +1,392 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ui-agentbedrock/backend/internal/models"
+)
+
+// DefaultMaxFileSize is the upload size limit of formats that don't set their own
+const DefaultMaxFileSize = 10 * 1024 * 1024
+
+// Extractor turns the files of one format into text for the agent
+type Extractor interface {
+	Format() models.FileFormat
+	Extract(ctx context.Context, content []byte) (*Extraction, error)
+}
+
+// funcExtractor adapts an extraction function to the Extractor interface
+type funcExtractor struct {
+	format  models.FileFormat
+	extract func(ctx context.Context, content []byte) (*Extraction, error)
+}
+
+func (e *funcExtractor) Format() models.FileFormat { return e.format }
+
+func (e *funcExtractor) Extract(ctx context.Context, content []byte) (*Extraction, error) {
+	return e.extract(ctx, content)
+}
+
+// textExtractor adapts a function returning plain text
+func textExtractor(format models.FileFormat, extract func(ctx context.Context, content []byte) (string, error)) Extractor {
+	return &funcExtractor{format: format, extract: func(ctx context.Context, content []byte) (*Extraction, error) {
+		text, err := extract(ctx, content)
+		if err != nil {
+			return nil, err
+		}
+		return &Extraction{Content: text}, nil
+	}}
+}
+
+// sourceMimeTypes are the content types browsers declare for some source files
+var sourceMimeTypes = map[string][]string{
+	"js":   {"text/javascript", "application/javascript"},
+	"py":   {"text/x-python"},
+	"go":   {"text/x-go"},
+	"java": {"text/x-java-source"},
+	"c":    {"text/x-c"},
+	"sh":   {"text/x-shellscript", "application/x-sh"},
+	"sql":  {"application/sql"},
+	"css":  {"text/css"},
+}
+
+// ExtractorRegistry holds the extractor of every format that can be uploaded.
+// Upload validation, storage routing, download content types and extraction
+// are all looked up here.
+type ExtractorRegistry struct {
+	mu         sync.RWMutex
+	extractors []Extractor
+	formats    []models.FileFormat // Formats of the extractors, with the limits set on the registry
+	byType     map[string]int
+	byExt      map[string]int
+	byMime     map[string]int
+}
+
+// NewExtractorRegistry returns a registry with the built-in extractors of the service
+func NewExtractorRegistry(s *ExtractionService) *ExtractorRegistry {
+	r := &ExtractorRegistry{}
+	r.rebuild()
+
+	builtins := []Extractor{
+		&funcExtractor{format: models.FileFormat{
+			FileType: "pdf", Label: "PDF", Extensions: []string{".pdf"},
+			MimeTypes: []string{"application/pdf"}, Magic: "%PDF-",
+		}, extract: s.extractFromPDF},
+		textExtractor(models.FileFormat{
+			FileType: "docx", Label: "Word", Extensions: []string{".docx"},
+			MimeTypes: []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		}, s.extractFromDOCX),
+		textExtractor(models.FileFormat{
+			FileType: "doc", Label: "Word 97-2003", Extensions: []string{".doc"},
+			MimeTypes: []string{"application/msword"},
+		}, s.extractFromDOC),
+		&funcExtractor{format: models.FileFormat{
+			FileType: "pptx", Label: "PowerPoint", Extensions: []string{".pptx"},
+			MimeTypes: []string{"application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+		}, extract: s.extractFromPPTX},
+		textExtractor(models.FileFormat{
+			FileType: "xlsx", Label: "Excel", Extensions: []string{".xlsx"},
+			MimeTypes: []string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		}, s.extractFromXLSX),
+		textExtractor(models.FileFormat{
+			FileType: "xls", Label: "Excel 97-2003", Extensions: []string{".xls"},
+			MimeTypes: []string{"application/vnd.ms-excel"},
+		}, s.extractFromXLS),
+		textExtractor(models.FileFormat{
+			FileType: "csv", Label: "CSV", Extensions: []string{".csv"},
+			MimeTypes: []string{"text/csv"},
+		}, func(ctx context.Context, content []byte) (string, error) {
+			return s.extractFromDelimited(ctx, content, 0)
+		}),
+		textExtractor(models.FileFormat{
+			FileType: "tsv", Label: "TSV", Extensions: []string{".tsv"},
+			MimeTypes: []string{"text/tab-separated-values"},
+		}, func(ctx context.Context, content []byte) (string, error) {
+			return s.extractFromDelimited(ctx, content, '\t')
+		}),
+		textExtractor(models.FileFormat{
+			FileType: "txt", Label: "Text", Extensions: []string{".txt"},
+			MimeTypes: []string{"text/plain"},
+		}, s.extractFromText),
+		textExtractor(models.FileFormat{
+			FileType: "md", Label: "Markdown", Extensions: []string{".md"},
+			MimeTypes: []string{"text/markdown"},
+		}, s.extractFromText),
+		textExtractor(models.FileFormat{
+			FileType: "html", Label: "HTML", Extensions: []string{".html", ".htm"},
+			MimeTypes: []string{"text/html", "application/xhtml+xml"},
+		}, s.extractFromHTML),
+		textExtractor(models.FileFormat{
+			FileType: "json", Label: "JSON", Extensions: []string{".json", ".jsonl", ".ndjson"},
+			MimeTypes: []string{"application/json", "application/x-ndjson"},
+		}, s.extractFromJSON),
+		textExtractor(models.FileFormat{
+			FileType: "yaml", Label: "YAML", Extensions: []string{".yaml", ".yml"},
+			MimeTypes: []string{"application/yaml", "application/x-yaml", "text/yaml"},
+		}, s.extractFromYAML),
+		textExtractor(models.FileFormat{
+			FileType: "xml", Label: "XML", Extensions: []string{".xml"},
+			MimeTypes: []string{"application/xml", "text/xml"},
+		}, s.extractFromXML),
+	}
+	sourceTypes := SourceFileTypes()
+	sort.Strings(sourceTypes)
+	for _, fileType := range sourceTypes {
+		language := sourceLanguages[fileType]
+		builtins = append(builtins, textExtractor(models.FileFormat{
+			FileType: fileType, Label: "Source code", Extensions: []string{"." + fileType},
+			MimeTypes: sourceMimeTypes[fileType],
+		}, func(ctx context.Context, content []byte) (string, error) {
+			return s.extractFromSource(ctx, content, language)
+		}))
+	}
+
+	for _, extractor := range builtins {
+		if err := r.Register(extractor); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Register adds an extractor, replacing any extractor of the same file type.
+// Extensions and MIME types claimed by an earlier format move to this one.
+func (r *ExtractorRegistry) Register(extractor Extractor) error {
+	format, err := normalizeFormat(extractor.Format())
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if i, ok := r.byType[format.FileType]; ok {
+		r.extractors[i] = extractor
+		r.formats[i] = format
+	} else {
+		r.extractors = append(r.extractors, extractor)
+		r.formats = append(r.formats, format)
+	}
+	r.rebuild()
+	return nil
+}
+
+// RegisterCommandsJSON registers the external extractors of a JSON array, as
+// set in the EXTERNAL_EXTRACTORS variable
+func (r *ExtractorRegistry) RegisterCommandsJSON(data string) error {
+	extractors, err := ParseCommandExtractors(data)
+	if err != nil {
+		return err
+	}
+
+	for _, extractor := range extractors {
+		if err := r.Register(extractor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMaxSize sets the upload size limit of a format in bytes
+func (r *ExtractorRegistry) SetMaxSize(fileType string, size int64) error {
+	if size <= 0 {
+		return fmt.Errorf("size limit of %q must be positive", fileType)
+	}
+	return r.update(fileType, func(format *models.FileFormat) { format.MaxSize = size })
+}
+
+// SetStorage sets where uploads of a format are stored, models.StorageGridFS or models.StorageS3
+func (r *ExtractorRegistry) SetStorage(fileType, storage string) error {
+	if storage != models.StorageGridFS && storage != models.StorageS3 {
+		return fmt.Errorf("unknown storage %q", storage)
+	}
+	return r.update(fileType, func(format *models.FileFormat) { format.Storage = storage })
+}
+
+// SetMaxSizesJSON sets upload size limits from a JSON object of file type ->
+// megabytes, as set in the UPLOAD_MAX_SIZES_MB variable
+func (r *ExtractorRegistry) SetMaxSizesJSON(data string) error {
+	var sizes map[string]float64
+	if err := json.Unmarshal([]byte(data), &sizes); err != nil {
+		return fmt.Errorf("invalid size limits: %w", err)
+	}
+
+	for fileType, megabytes := range sizes {
+		if err := r.SetMaxSize(fileType, int64(megabytes*1024*1024)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ExtractorRegistry) update(fileType string, change func(*models.FileFormat)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, ok := r.byType[fileType]
+	if !ok {
+		return fmt.Errorf("unknown file type %q", fileType)
+	}
+	change(&r.formats[i])
+	return nil
+}
+
+// rebuild indexes the formats; later formats win extensions and MIME types
+func (r *ExtractorRegistry) rebuild() {
+	r.byType = make(map[string]int, len(r.formats))
+	r.byExt = make(map[string]int)
+	r.byMime = make(map[string]int)
+	for i, format := range r.formats {
+		r.byType[format.FileType] = i
+		for _, ext := range format.Extensions {
+			r.byExt[ext] = i
+		}
+		for _, mimeType := range format.MimeTypes {
+			r.byMime[mediaType(mimeType)] = i
+		}
+	}
+}
+
+// normalizeFormat checks a format and fills in the defaults
+func normalizeFormat(format models.FileFormat) (models.FileFormat, error) {
+	if format.FileType == "" {
+		return format, fmt.Errorf("extractor file type is required")
+	}
+	if len(format.Extensions) == 0 && len(format.MimeTypes) == 0 {
+		return format, fmt.Errorf("extractor %q needs extensions or MIME types", format.FileType)
+	}
+	if format.Label == "" {
+		format.Label = strings.ToUpper(format.FileType)
+	}
+	if format.MaxSize <= 0 {
+		format.MaxSize = DefaultMaxFileSize
+	}
+	if format.Storage == "" {
+		format.Storage = models.StorageGridFS
+	}
+
+	extensions := make([]string, len(format.Extensions))
+	for i, ext := range format.Extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensions[i] = ext
+	}
+	format.Extensions = extensions
+	return format, nil
+}
+
+// Formats returns the registered formats in registration order
+func (r *ExtractorRegistry) Formats() []models.FileFormat {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	formats := make([]models.FileFormat, len(r.formats))
+	copy(formats, r.formats)
+	return formats
+}
+
+// Format returns the format of a file type
+func (r *ExtractorRegistry) Format(fileType string) (models.FileFormat, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if i, ok := r.byType[fileType]; ok {
+		return r.formats[i], true
+	}
+	return models.FileFormat{}, false
+}
+
+// ForFilename returns the format of a file by its extension
+func (r *ExtractorRegistry) ForFilename(filename string) (models.FileFormat, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if i, ok := r.byExt[strings.ToLower(filepath.Ext(filename))]; ok {
+		return r.formats[i], true
+	}
+	return models.FileFormat{}, false
+}
+
+// MaxSize returns the largest upload size limit of all formats
+func (r *ExtractorRegistry) MaxSize() int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var max int64
+	for _, format := range r.formats {
+		if format.MaxSize > max {
+			max = format.MaxSize
+		}
+	}
+	return max
+}
+
+// ContentType returns the content type downloads of a file type are served with
+func (r *ExtractorRegistry) ContentType(fileType string) string {
+	if format, ok := r.Format(fileType); ok && len(format.MimeTypes) > 0 {
+		return format.MimeTypes[0]
+	}
+	if _, ok := SourceLanguage(fileType); ok {
+		return "text/plain; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
+
+// Detect determines the format of an upload: formats with a signature (PDF)
+// by their content, everything else by extension, falling back to the content
+// type the client declared and then the sniffed one. Text formats all sniff as
+// text/plain, so the extension is the better hint for them.
+func (r *ExtractorRegistry) Detect(filename, declared string, content []byte) (models.FileFormat, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, format := range r.formats {
+		if format.Magic != "" && bytes.HasPrefix(content, []byte(format.Magic)) {
+			return format, true
+		}
+	}
+	if i, ok := r.byExt[strings.ToLower(filepath.Ext(filename))]; ok {
+		return r.formats[i], true
+	}
+	for _, candidate := range []string{mediaType(declared), mediaType(http.DetectContentType(content))} {
+		if i, ok := r.byMime[candidate]; ok {
+			return r.formats[i], true
+		}
+	}
+	return models.FileFormat{}, false
+}
+
+// Extract extracts the text of a file with the extractor of its file type
+func (r *ExtractorRegistry) Extract(ctx context.Context, fileType string, content []byte) (*Extraction, error) {
+	r.mu.RLock()
+	i, ok := r.byType[fileType]
+	var extractor Extractor
+	if ok {
+		extractor = r.extractors[i]
+	}
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported file type: %s", fileType)
+	}
+	return extractor.Extract(ctx, content)
+}
+
+// mediaType strips the parameters (e.g. "; charset=utf-8") from a content type
+func mediaType(contentType string) string {
+	if parsed, _, err := mime.ParseMediaType(contentType); err == nil {
+		return parsed
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+)
+
+// FakeScript returns the events the fake agent emits for a single invocation
+type FakeScript func(input *bedrockagentruntime.InvokeAgentInput) []types.ResponseStream
+
+// FakeRuntime is an in-process AgentRuntime that plays back scripted events.
+// It is used for offline development (AGENT_RUNTIME=fake) and for exercising the
+// chat pipeline without AWS.
+type FakeRuntime struct {
+	script FakeScript
+	delay  time.Duration // Delay between events to simulate streaming
+}
+
+func NewFakeRuntime(script FakeScript, delay time.Duration) *FakeRuntime {
+	if script == nil {
+		script = DefaultFakeScript
+	}
+	return &FakeRuntime{
+		script: script,
+		delay:  delay,
+	}
+}
+
+// InvokeAgent starts streaming the scripted events for the input
+func (r *FakeRuntime) InvokeAgent(ctx context.Context, input *bedrockagentruntime.InvokeAgentInput) (AgentEventStream, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	events := r.script(input)
+	scripted := make([]scriptedEvent, len(events))
+	for i, event := range events {
+		scripted[i] = scriptedEvent{event: event, delay: r.delay}
+	}
+	return newScriptedEventStream(ctx, scripted, nil), nil
+}
+
+// DefaultFakeScript simulates a supervisor that looks up a knowledge base, calls a
+// collaborator and then streams an echo of the user's message.
+// Messages containing "[fail]" produce a failure trace instead of an answer, and
+// "[action]" returns control for the built-in backend/get_current_time action
+// and "[confirm]" asks the user to confirm it first. "[guardrail]" simulates a
+// guardrail blocking the input.
+func DefaultFakeScript(input *bedrockagentruntime.InvokeAgentInput) []types.ResponseStream {
+	text := aws.ToString(input.InputText)
+
+	// Follow-up invocation carrying the results of returned control
+	if input.SessionState != nil && len(input.SessionState.ReturnControlInvocationResults) > 0 {
+		return fakeActionAnswer(input.SessionState.ReturnControlInvocationResults)
+	}
+
+	events := []types.ResponseStream{
+		FakeRationale("The user sent a message. I will check the knowledge base and ask a collaborator."),
+	}
+
+	if strings.Contains(text, "[fail]") {
+		return append(events, FakeFailure("Simulated failure requested by the user"))
+	}
+
+	if strings.Contains(text, "[guardrail]") {
+		return append(events, FakeGuardrailBlock("Investment advice"), FakeChunk("Sorry, the model cannot answer this question."))
+	}
+
+	if strings.Contains(text, "[confirm]") {
+		return append(events, FakeConfirmation("fake-invocation", "backend", "get_current_time", nil))
+	}
+	if strings.Contains(text, "[action]") {
+		return append(events, FakeReturnControl("fake-invocation", "backend", "get_current_time", nil))
+	}
+
+	events = append(events, FakeKnowledgeBaseLookup("FAKEKB0001", text, "Fake reference one", "Fake reference two")...)
+	events = append(events, FakeCollaboratorCall("Analyzer", text, "Analysis of the request is complete.")...)
+
+	answer := fmt.Sprintf("This is a simulated response (offline mode). You said: %s", lastLine(text))
+	for _, word := range strings.SplitAfter(answer, " ") {
+		events = append(events, FakeChunk(word))
+	}
+	return append(events, FakeCitedChunk(" [1]", "s3://fake-kb/doc-1.txt", "Fake reference one"))
+}
+
+// fakeActionAnswer streams the bodies of the action results back as the answer
+func fakeActionAnswer(results []types.InvocationResultMember) []types.ResponseStream {
+	var outputs []string
+	for _, result := range results {
+		switch r := result.(type) {
+		case *types.InvocationResultMemberMemberFunctionResult:
+			for _, body := range r.Value.ResponseBody {
+				outputs = append(outputs, aws.ToString(body.Body))
+			}
+		case *types.InvocationResultMemberMemberApiResult:
+			for _, body := range r.Value.ResponseBody {
+				outputs = append(outputs, aws.ToString(body.Body))
+			}
+		}
+	}
+
+	answer := fmt.Sprintf("The backend action returned: %s", strings.Join(outputs, ", "))
+	var events []types.ResponseStream
+	for _, word := range strings.SplitAfter(answer, " ") {
+		events = append(events, FakeChunk(word))
+	}
+	return events
+}
+
+// lastLine returns the last non-empty line so context prefixes aren't echoed back
+func lastLine(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	return lines[len(lines)-1]
+}
+
+// FakeChunk creates a response chunk event
+func FakeChunk(text string) types.ResponseStream {
+	return &types.ResponseStreamMemberChunk{
+		Value: types.PayloadPart{Bytes: []byte(text)},
+	}
+}
+
+// FakeCitedChunk creates a response chunk attributed to a knowledge base reference
+func FakeCitedChunk(text, sourceURI, snippet string) types.ResponseStream {
+	return &types.ResponseStreamMemberChunk{
+		Value: types.PayloadPart{
+			Bytes: []byte(text),
+			Attribution: &types.Attribution{
+				Citations: []types.Citation{{
+					GeneratedResponsePart: &types.GeneratedResponsePart{
+						TextResponsePart: &types.TextResponsePart{
+							Text: aws.String(text),
+							Span: &types.Span{Start: aws.Int32(0), End: aws.Int32(int32(len([]rune(text))))},
+						},
+					},
+					RetrievedReferences: []types.RetrievedReference{{
+						Content: &types.RetrievalResultContent{Text: aws.String(snippet)},
+						Location: &types.RetrievalResultLocation{
+							Type:       types.RetrievalResultLocationTypeS3,
+							S3Location: &types.RetrievalResultS3Location{Uri: aws.String(sourceURI)},
+						},
+					}},
+				}},
+			},
+		},
+	}
+}
+
+// FakeTrace wraps a trace in a response stream event. EventTime is left unset so
+// steps are timed by when events arrive, including the simulated delay.
+func FakeTrace(collaboratorName string, trace types.Trace) types.ResponseStream {
+	part := types.TracePart{Trace: trace}
+	if collaboratorName != "" {
+		part.CollaboratorName = aws.String(collaboratorName)
+	}
+	return &types.ResponseStreamMemberTrace{Value: part}
+}
+
+// FakeRationale creates an orchestration rationale trace
+func FakeRationale(text string) types.ResponseStream {
+	return FakeTrace("", &types.TraceMemberOrchestrationTrace{
+		Value: &types.OrchestrationTraceMemberRationale{
+			Value: types.Rationale{Text: aws.String(text)},
+		},
+	})
+}
+
+// FakeCollaboratorCall creates the invocation input and observation traces of a collaborator call
+func FakeCollaboratorCall(name, input, output string) []types.ResponseStream {
+	return []types.ResponseStream{
+		FakeTrace("", &types.TraceMemberOrchestrationTrace{
+			Value: &types.OrchestrationTraceMemberInvocationInput{
+				Value: types.InvocationInput{
+					TraceId:        aws.String("fake-collaborator-" + name),
+					InvocationType: types.InvocationTypeAgentCollaborator,
+					AgentCollaboratorInvocationInput: &types.AgentCollaboratorInvocationInput{
+						AgentCollaboratorName: aws.String(name),
+						Input:                 &types.AgentCollaboratorInputPayload{Text: aws.String(input)},
+					},
+				},
+			},
+		}),
+		FakeTrace(name, &types.TraceMemberOrchestrationTrace{
+			Value: &types.OrchestrationTraceMemberObservation{
+				Value: types.Observation{
+					TraceId: aws.String("fake-collaborator-" + name),
+					Type:    types.TypeAgentCollaborator,
+					AgentCollaboratorInvocationOutput: &types.AgentCollaboratorInvocationOutput{
+						AgentCollaboratorName: aws.String(name),
+						Output:                &types.AgentCollaboratorOutputPayload{Text: aws.String(output)},
+					},
+				},
+			},
+		}),
+	}
+}
+
+// FakeKnowledgeBaseLookup creates the lookup input and result traces of a knowledge base query
+func FakeKnowledgeBaseLookup(knowledgeBaseID, query string, references ...string) []types.ResponseStream {
+	retrieved := make([]types.RetrievedReference, 0, len(references))
+	for i, ref := range references {
+		retrieved = append(retrieved, types.RetrievedReference{
+			Content: &types.RetrievalResultContent{Text: aws.String(ref)},
+			Location: &types.RetrievalResultLocation{
+				Type:       types.RetrievalResultLocationTypeS3,
+				S3Location: &types.RetrievalResultS3Location{Uri: aws.String(fmt.Sprintf("s3://fake-kb/doc-%d.txt", i+1))},
+			},
+		})
+	}
+
+	return []types.ResponseStream{
+		FakeTrace("", &types.TraceMemberOrchestrationTrace{
+			Value: &types.OrchestrationTraceMemberInvocationInput{
+				Value: types.InvocationInput{
+					TraceId:        aws.String("fake-kb-" + knowledgeBaseID),
+					InvocationType: types.InvocationTypeKnowledgeBase,
+					KnowledgeBaseLookupInput: &types.KnowledgeBaseLookupInput{
+						KnowledgeBaseId: aws.String(knowledgeBaseID),
+						Text:            aws.String(query),
+					},
+				},
+			},
+		}),
+		FakeTrace("", &types.TraceMemberOrchestrationTrace{
+			Value: &types.OrchestrationTraceMemberObservation{
+				Value: types.Observation{
+					TraceId:                   aws.String("fake-kb-" + knowledgeBaseID),
+					Type:                      types.TypeKnowledgeBase,
+					KnowledgeBaseLookupOutput: &types.KnowledgeBaseLookupOutput{RetrievedReferences: retrieved},
+				},
+			},
+		}),
+	}
+}
+
+// FakeActionGroupCall creates the invocation input and observation traces of an action group function
+func FakeActionGroupCall(actionGroup, function, output string) []types.ResponseStream {
+	return []types.ResponseStream{
+		FakeTrace("", &types.TraceMemberOrchestrationTrace{
+			Value: &types.OrchestrationTraceMemberInvocationInput{
+				Value: types.InvocationInput{
+					TraceId:        aws.String("fake-action-" + actionGroup + "-" + function),
+					InvocationType: types.InvocationTypeActionGroup,
+					ActionGroupInvocationInput: &types.ActionGroupInvocationInput{
+						ActionGroupName: aws.String(actionGroup),
+						Function:        aws.String(function),
+					},
+				},
+			},
+		}),
+		FakeTrace("", &types.TraceMemberOrchestrationTrace{
+			Value: &types.OrchestrationTraceMemberObservation{
+				Value: types.Observation{
+					TraceId:                     aws.String("fake-action-" + actionGroup + "-" + function),
+					Type:                        types.TypeActionGroup,
+					ActionGroupInvocationOutput: &types.ActionGroupInvocationOutput{Text: aws.String(output)},
+				},
+			},
+		}),
+	}
+}
+
+// FakeReturnControl creates a return-of-control event for a function of an action group
+func FakeReturnControl(invocationID, actionGroup, function string, parameters map[string]string) types.ResponseStream {
+	params := make([]types.FunctionParameter, 0, len(parameters))
+	for name, value := range parameters {
+		params = append(params, types.FunctionParameter{
+			Name:  aws.String(name),
+			Type:  aws.String("string"),
+			Value: aws.String(value),
+		})
+	}
+
+	return &types.ResponseStreamMemberReturnControl{
+		Value: types.ReturnControlPayload{
+			InvocationId: aws.String(invocationID),
+			InvocationInputs: []types.InvocationInputMember{
+				&types.InvocationInputMemberMemberFunctionInvocationInput{
+					Value: types.FunctionInvocationInput{
+						ActionGroup: aws.String(actionGroup),
+						Function:    aws.String(function),
+						Parameters:  params,
+					},
+				},
+			},
+		},
+	}
+}
+
+// FakeConfirmation creates a return-of-control event for a function that the
+// user must confirm before the backend runs it
+func FakeConfirmation(invocationID, actionGroup, function string, parameters map[string]string) types.ResponseStream {
+	event := FakeReturnControl(invocationID, actionGroup, function, parameters).(*types.ResponseStreamMemberReturnControl)
+	for _, input := range event.Value.InvocationInputs {
+		if fn, ok := input.(*types.InvocationInputMemberMemberFunctionInvocationInput); ok {
+			fn.Value.ActionInvocationType = types.ActionInvocationTypeUserConfirmationAndResult
+		}
+	}
+	return event
+}
+
+// FakeFinalResponse creates a final response observation (no content chunks)
+func FakeFinalResponse(text string) types.ResponseStream {
+	return FakeTrace("", &types.TraceMemberOrchestrationTrace{
+		Value: &types.OrchestrationTraceMemberObservation{
+			Value: types.Observation{
+				Type:          types.TypeFinish,
+				FinalResponse: &types.FinalResponse{Text: aws.String(text)},
+			},
+		},
+	})
+}
+
+// FakeGuardrailBlock creates a guardrail trace that blocked the input for a denied topic
+func FakeGuardrailBlock(topic string) types.ResponseStream {
+	return FakeTrace("", &types.TraceMemberGuardrailTrace{
+		Value: types.GuardrailTrace{
+			Action: types.GuardrailActionIntervened,
+			InputAssessments: []types.GuardrailAssessment{{
+				TopicPolicy: &types.GuardrailTopicPolicyAssessment{
+					Topics: []types.GuardrailTopic{{
+						Name:   aws.String(topic),
+						Type:   types.GuardrailTopicTypeDeny,
+						Action: types.GuardrailTopicPolicyActionBlocked,
+					}},
+				},
+			}},
+		},
+	})
+}
+
+// FakeFailure creates a failure trace
+func FakeFailure(reason string) types.ResponseStream {
+	return FakeTrace("", &types.TraceMemberFailureTrace{
+		Value: types.FailureTrace{FailureReason: aws.String(reason)},
+	})
+}
+
+// FakeModel is an in-process ModelInvoker that returns a canned Claude response.
+// It lets SummarizeService run without Bedrock.
+type FakeModel struct{}
+
+func NewFakeModel() *FakeModel {
+	return &FakeModel{}
+}
+
+// InvokeModel returns a deterministic summary built from the request prompt
+func (m *FakeModel) InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error) {
+	var request claudeRequest
+	if err := json.Unmarshal(params.Body, &request); err != nil {
+		return nil, fmt.Errorf("fake model: invalid request: %w", err)
+	}
+
+	promptChars := 0
+	for _, msg := range request.Messages {
+		promptChars += len(msg.Content)
+	}
+
+	text := fmt.Sprintf("Simulated summary of %d characters of conversation (offline mode).", promptChars)
+	body, err := json.Marshal(map[string]interface{}{
+		"content": []map[string]string{{"text": text}},
+		// Roughly four characters per token
+		"usage": map[string]int{"input_tokens": promptChars / 4, "output_tokens": len(text) / 4},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &bedrockruntime.InvokeModelOutput{
+		Body:        body,
+		ContentType: aws.String("application/json"),
+	}, nil
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/ui-agentbedrock/backend/internal/models"
+)
+
+// parseGuardrailTrace fills a guardrail step with the action, the policies that
+// matched and whether the input or output was blocked
+func (s *AgentService) parseGuardrailTrace(step *models.AgentStep, trace types.GuardrailTrace) {
+	assessment := &models.GuardrailAssessment{Action: string(trace.Action)}
+	if assessment.Action == "" {
+		assessment.Action = string(types.GuardrailActionNone)
+	}
+
+	for _, input := range trace.InputAssessments {
+		assessment.Policies = append(assessment.Policies, guardrailPolicyHits("input", input)...)
+	}
+	for _, output := range trace.OutputAssessments {
+		assessment.Policies = append(assessment.Policies, guardrailPolicyHits("output", output)...)
+	}
+	for _, hit := range assessment.Policies {
+		if hit.Action != "BLOCKED" {
+			continue
+		}
+		if hit.Source == "input" {
+			assessment.InputBlocked = true
+		} else {
+			assessment.OutputBlocked = true
+		}
+	}
+
+	step.Guardrail = assessment
+	step.Action = "Content check: passed"
+	if assessment.Intervened() {
+		step.Action = "Content check: intervened"
+		if blocked := blockedParts(assessment); blocked != "" {
+			step.Action = fmt.Sprintf("Content check: %s blocked", blocked)
+		}
+		step.Observation = guardrailSummary(assessment.Policies)
+	}
+}
+
+// guardrailPolicyHits lists the policies of an assessment that matched
+func guardrailPolicyHits(source string, assessment types.GuardrailAssessment) []models.GuardrailPolicyHit {
+	var hits []models.GuardrailPolicyHit
+
+	if policy := assessment.ContentPolicy; policy != nil {
+		for _, filter := range policy.Filters {
+			hits = append(hits, models.GuardrailPolicyHit{
+				Source:     source,
+				Policy:     "content_filter",
+				Type:       string(filter.Type),
+				Confidence: string(filter.Confidence),
+				Action:     string(filter.Action),
+			})
+		}
+	}
+
+	if policy := assessment.TopicPolicy; policy != nil {
+		for _, topic := range policy.Topics {
+			hits = append(hits, models.GuardrailPolicyHit{
+				Source: source,
+				Policy: "denied_topic",
+				Type:   string(topic.Type),
+				Name:   aws.ToString(topic.Name),
+				Action: string(topic.Action),
+			})
+		}
+	}
+
+	// PII and regex matches are sensitive, only the entity type or pattern name is kept
+	if policy := assessment.SensitiveInformationPolicy; policy != nil {
+		for _, entity := range policy.PiiEntities {
+			hits = append(hits, models.GuardrailPolicyHit{
+				Source: source,
+				Policy: "pii_entity",
+				Type:   string(entity.Type),
+				Action: string(entity.Action),
+			})
+		}
+		for _, regex := range policy.Regexes {
+			hits = append(hits, models.GuardrailPolicyHit{
+				Source: source,
+				Policy: "regex",
+				Name:   aws.ToString(regex.Name),
+				Action: string(regex.Action),
+			})
+		}
+	}
+
+	if policy := assessment.WordPolicy; policy != nil {
+		for _, word := range policy.CustomWords {
+			hits = append(hits, models.GuardrailPolicyHit{
+				Source: source,
+				Policy: "custom_word",
+				Match:  aws.ToString(word.Match),
+				Action: string(word.Action),
+			})
+		}
+		for _, word := range policy.ManagedWordLists {
+			hits = append(hits, models.GuardrailPolicyHit{
+				Source: source,
+				Policy: "managed_word",
+				Type:   string(word.Type),
+				Match:  aws.ToString(word.Match),
+				Action: string(word.Action),
+			})
+		}
+	}
+
+	return hits
+}
+
+// blockedParts describes what was blocked: "input", "output" or "input and output"
+func blockedParts(assessment *models.GuardrailAssessment) string {
+	switch {
+	case assessment.InputBlocked && assessment.OutputBlocked:
+		return "input and output"
+	case assessment.InputBlocked:
+		return "input"
+	case assessment.OutputBlocked:
+		return "output"
+	}
+	return ""
+}
+
+// guardrailSummary is a one-line list of the matched policies, e.g. "content_filter HATE (BLOCKED)"
+func guardrailSummary(hits []models.GuardrailPolicyHit) string {
+	parts := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		label := hit.Type
+		if hit.Name != "" {
+			label = hit.Name
+		}
+		parts = append(parts, strings.TrimSpace(fmt.Sprintf("%s %s (%s)", hit.Policy, label, hit.Action)))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// Invocation is a running agent invocation that can be cancelled
+type Invocation struct {
+	cancel    context.CancelFunc
+	mu        sync.Mutex
+	cancelled bool
+}
+
+// Cancelled reports whether the invocation was stopped through the registry
+func (i *Invocation) Cancelled() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.cancelled
+}
+
+func (i *Invocation) stop() {
+	i.mu.Lock()
+	i.cancelled = true
+	i.mu.Unlock()
+	i.cancel()
+}
+
+// InvocationRegistry tracks the running agent invocation of each session so it
+// can be stopped from another request
+type InvocationRegistry struct {
+	mu          sync.Mutex
+	invocations map[string]*Invocation
+}
+
+func NewInvocationRegistry() *InvocationRegistry {
+	return &InvocationRegistry{
+		invocations: make(map[string]*Invocation),
+	}
+}
+
+// Start registers a new invocation for the session and returns the context to
+// pass to InvokeAgentStream. Finish must be called when the invocation ends.
+func (r *InvocationRegistry) Start(parent context.Context, sessionID string) (context.Context, *Invocation) {
+	ctx, cancel := context.WithCancel(parent)
+	invocation := &Invocation{cancel: cancel}
+
+	r.mu.Lock()
+	r.invocations[sessionID] = invocation
+	r.mu.Unlock()
+
+	return ContextWithSessionID(ctx, sessionID), invocation
+}
+
+// Finish unregisters the invocation and releases its context
+func (r *InvocationRegistry) Finish(sessionID string, invocation *Invocation) {
+	r.mu.Lock()
+	if r.invocations[sessionID] == invocation {
+		delete(r.invocations, sessionID)
+	}
+	r.mu.Unlock()
+
+	invocation.cancel()
+}
+
+// Cancel stops the running invocation of a session.
+// Returns false if the session has no running invocation.
+func (r *InvocationRegistry) Cancel(sessionID string) bool {
+	r.mu.Lock()
+	invocation, ok := r.invocations[sessionID]
+	r.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	invocation.stop()
+	return true
+}
+
+// IsRunning reports whether the session has a running invocation
+func (r *InvocationRegistry) IsRunning(sessionID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.invocations[sessionID]
+	return ok
+}
+
+type sessionIDKey struct{}
+
+// ContextWithSessionID attaches the chat session of the current invocation to ctx
+func ContextWithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey{}, sessionID)
+}
+
+// SessionIDFromContext returns the session ID set by ContextWithSessionID, if any
+func SessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionIDKey{}).(string)
+	return sessionID
+}
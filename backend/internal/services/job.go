@@ -0,0 +1,327 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ui-agentbedrock/backend/internal/models"
+	"github.com/ui-agentbedrock/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// jobPollInterval is how often idle workers check for queued jobs
+	jobPollInterval = 5 * time.Second
+	// jobFlushInterval limits how often partial content is written to Mongo
+	jobFlushInterval = time.Second
+	// jobHeartbeatInterval is how often a running job's owner renews its heartbeat
+	jobHeartbeatInterval = 20 * time.Second
+	// jobStaleAfter is how long a running job can go without a heartbeat before
+	// another instance takes it over
+	jobStaleAfter = 3 * jobHeartbeatInterval
+	// jobMaxAttempts is how often a job is started before it is failed instead of requeued
+	jobMaxAttempts = 3
+)
+
+// JobService runs chat invocations in a bounded pool of background workers.
+// Jobs live in the chat_jobs collection, so queued and interrupted jobs survive a restart.
+// Running jobs carry their instance's heartbeat; jobs of an instance that stopped
+// sending it are taken over by the others.
+type JobService struct {
+	repo           *repository.JobRepository
+	owner          string // ID of this instance in the jobs it runs
+	agents         *AgentRegistry
+	sessionService *SessionService
+	invocations    *InvocationRegistry
+	locks          *SessionLockService
+	workers        int
+	wake           chan struct{}
+}
+
+func NewJobService(repo *repository.JobRepository, agents *AgentRegistry, sessionService *SessionService, invocations *InvocationRegistry, locks *SessionLockService, workers int) *JobService {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	return &JobService{
+		repo:           repo,
+		owner:          primitive.NewObjectID().Hex(),
+		agents:         agents,
+		sessionService: sessionService,
+		invocations:    invocations,
+		locks:          locks,
+		workers:        workers,
+		wake:           make(chan struct{}, workers),
+	}
+}
+
+// Start starts the workers and the check for jobs interrupted by a crash or restart
+func (s *JobService) Start(ctx context.Context) {
+	go s.requeueStale(ctx)
+
+	for i := 0; i < s.workers; i++ {
+		go s.worker(ctx)
+	}
+}
+
+// requeueStale periodically requeues running jobs that lost their heartbeat
+func (s *JobService) requeueStale(ctx context.Context) {
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		requeued, failed, err := s.repo.RequeueStaleJobs(ctx, time.Now().Add(-jobStaleAfter), jobMaxAttempts)
+		switch {
+		case err != nil:
+			log.Printf("Warning: Failed to requeue interrupted jobs: %v", err)
+		case requeued > 0 || failed > 0:
+			log.Printf("Requeued %d interrupted chat jobs, failed %d after %d attempts", requeued, failed, jobMaxAttempts)
+		}
+		if requeued > 0 {
+			s.notify()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// notify wakes an idle worker without blocking
+func (s *JobService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Enqueue stores a new job; the user message must already be saved
+func (s *JobService) Enqueue(ctx context.Context, sessionID, branchID, agentKey, agentSessionID, prompt string, attributes models.AgentAttributes) (*models.ChatJob, error) {
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.ChatJob{
+		SessionID:      objectID,
+		BranchID:       branchID,
+		AgentSessionID: agentSessionID,
+		AgentKey:       agentKey,
+		Attributes:     attributes,
+		Prompt:         prompt,
+	}
+	if err := s.repo.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	s.notify()
+
+	return job, nil
+}
+
+func (s *JobService) GetJob(ctx context.Context, id string) (*models.ChatJob, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetJob(ctx, objectID)
+}
+
+func (s *JobService) worker(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := s.repo.ClaimNextJob(ctx, s.owner)
+		if err != nil {
+			log.Printf("Warning: Failed to claim chat job: %v", err)
+		}
+
+		if job != nil {
+			s.run(job)
+			continue
+		}
+
+		select {
+		case <-s.wake:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// run invokes the agent for a job, persisting steps and partial output as they arrive
+func (s *JobService) run(job *models.ChatJob) {
+	sessionID := job.SessionID.Hex()
+
+	stopHeartbeat := make(chan struct{})
+	defer close(stopHeartbeat)
+	go s.heartbeat(job.ID, stopHeartbeat)
+
+	// Wait for a chat that is still running on the session
+	lock, err := s.locks.Wait(context.Background(), sessionID)
+	if err != nil {
+		job.Status = "failed"
+		job.Error = &models.ErrorInfo{Type: "SessionLockError", Class: models.ErrorClassConflict, Message: err.Error(), Source: "SessionLock"}
+		if err := s.repo.FinishJob(context.Background(), job); err != nil {
+			log.Printf("Warning: Failed to finish job %s: %v", job.ID.Hex(), err)
+		}
+		return
+	}
+	defer lock.Release()
+
+	// Jobs can be stopped through the same cancel endpoint as streaming chats
+	invokeCtx, invocation := s.invocations.Start(context.Background(), sessionID)
+	defer s.invocations.Finish(sessionID, invocation)
+
+	progress := &jobProgress{repo: s.repo, jobID: job.ID, owner: job.Owner}
+	trace, content, err := s.agents.Get(job.AgentKey).InvokeAgentStreamWithAttributes(invokeCtx, job.AgentSessionID, job.Prompt, job.Attributes, progress.callback)
+
+	ctx := context.Background()
+	job.Content = content
+	job.Status = "completed"
+	if trace != nil {
+		job.TraceID = trace.TraceID
+		job.AgentSteps = trace.AgentSteps
+		job.Error = trace.Error
+	}
+
+	switch {
+	case invocation.Cancelled():
+		job.Status = "cancelled"
+		if message, saveErr := s.sessionService.SaveMessageWithStatus(ctx, sessionID, job.BranchID, "assistant", content, trace, "cancelled"); saveErr == nil {
+			job.MessageID = message.ID
+		}
+	case err != nil && content == "":
+		job.Status = "failed"
+		if job.Error == nil {
+			job.Error = &models.ErrorInfo{Type: "InvokeAgentError", Class: classifyError(err, false).Class, Message: err.Error(), Source: "AgentBedrock"}
+		}
+	case content != "":
+		// The stream broke off after part of the answer, keep what arrived
+		status := ""
+		if err != nil {
+			status = "interrupted"
+		}
+		if message, saveErr := s.sessionService.SaveMessageWithStatus(ctx, sessionID, job.BranchID, "assistant", content, trace, status); saveErr == nil {
+			job.MessageID = message.ID
+			if citations := progress.citations.Citations(); len(citations) > 0 {
+				if err := s.sessionService.UpdateMessageCitations(ctx, message.ID.Hex(), citations); err != nil {
+					log.Printf("Warning: Failed to save job %s citations: %v", job.ID.Hex(), err)
+				}
+			}
+		} else {
+			log.Printf("Warning: Failed to save job %s message: %v", job.ID.Hex(), saveErr)
+		}
+	}
+
+	if err := s.repo.FinishJob(ctx, job); err != nil {
+		log.Printf("Warning: Failed to finish job %s: %v", job.ID.Hex(), err)
+	}
+}
+
+// heartbeat tells the other instances the job is still running until stop is closed
+func (s *JobService) heartbeat(jobID primitive.ObjectID, stop <-chan struct{}) {
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		running, err := s.repo.Heartbeat(ctx, jobID, s.owner)
+		cancel()
+
+		switch {
+		case err != nil:
+			log.Printf("Warning: Failed to renew heartbeat of job %s: %v", jobID.Hex(), err)
+		case !running:
+			log.Printf("Warning: Job %s was taken over by another instance", jobID.Hex())
+			return
+		}
+	}
+}
+
+// jobProgress collects stream events for a job and writes them to Mongo
+type jobProgress struct {
+	repo      *repository.JobRepository
+	jobID     primitive.ObjectID
+	owner     string
+	mu        sync.Mutex
+	steps     []models.AgentStep
+	content   string
+	lastFlush time.Time
+	citations CitationCollector
+}
+
+func (p *jobProgress) callback(event models.SSEEvent) error {
+	p.citations.Observe(event)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch data := event.Data.(type) {
+	case models.AgentStepEvent:
+		p.upsertStep(data)
+		p.flush()
+	case models.ContentEvent:
+		p.content += data.Chunk
+		if time.Since(p.lastFlush) >= jobFlushInterval {
+			p.flush()
+		}
+	case models.ConfirmationRequiredEvent:
+		p.setConfirmation(&data)
+	case models.ConfirmationResolvedEvent:
+		p.setConfirmation(nil)
+	}
+	return nil
+}
+
+// upsertStep adds a step or updates it when the final status arrives
+func (p *jobProgress) upsertStep(event models.AgentStepEvent) {
+	for i := range p.steps {
+		if p.steps[i].StepIndex == event.StepIndex {
+			p.steps[i].Status = event.Status
+			return
+		}
+	}
+
+	p.steps = append(p.steps, models.AgentStep{
+		StepIndex:   event.StepIndex,
+		AgentName:   event.AgentName,
+		AgentID:     event.AgentID,
+		Type:        event.Type,
+		Action:      event.Action,
+		Status:      event.Status,
+		Rationale:   event.Rationale,
+		Observation: event.Observation,
+		Input:       event.Input,
+		Output:      event.Output,
+		StartTime:   time.Now(),
+		Duration:    event.Duration,
+	})
+}
+
+// setConfirmation exposes the pending confirmation to clients polling the job
+func (p *jobProgress) setConfirmation(confirmation *models.ConfirmationRequiredEvent) {
+	if err := p.repo.UpdateJobConfirmation(context.Background(), p.jobID, p.owner, confirmation); err != nil {
+		log.Printf("Warning: Failed to update job %s confirmation: %v", p.jobID.Hex(), err)
+	}
+}
+
+func (p *jobProgress) flush() {
+	p.lastFlush = time.Now()
+	if err := p.repo.UpdateJobProgress(context.Background(), p.jobID, p.owner, p.steps, p.content); err != nil {
+		log.Printf("Warning: Failed to update job %s progress: %v", p.jobID.Hex(), err)
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/ui-agentbedrock/backend/internal/models"
+)
+
+// ModelPrice is the on-demand price of a model in USD per million tokens
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// defaultModelPrices are Bedrock on-demand prices for common agent models.
+// Override or extend them with MODEL_PRICES.
+var defaultModelPrices = map[string]ModelPrice{
+	"anthropic.claude-3-haiku":    {Input: 0.25, Output: 1.25},
+	"anthropic.claude-3-5-haiku":  {Input: 0.80, Output: 4.00},
+	"anthropic.claude-3-sonnet":   {Input: 3.00, Output: 15.00},
+	"anthropic.claude-3-5-sonnet": {Input: 3.00, Output: 15.00},
+	"anthropic.claude-3-7-sonnet": {Input: 3.00, Output: 15.00},
+	"anthropic.claude-sonnet-4":   {Input: 3.00, Output: 15.00},
+	"anthropic.claude-3-opus":     {Input: 15.00, Output: 75.00},
+	"anthropic.claude-opus-4":     {Input: 15.00, Output: 75.00},
+	"amazon.nova-micro":           {Input: 0.035, Output: 0.14},
+	"amazon.nova-lite":            {Input: 0.06, Output: 0.24},
+	"amazon.nova-pro":             {Input: 0.80, Output: 3.20},
+}
+
+// PriceTable turns token counts into cost. Models are matched by the longest
+// key contained in the model ID, so ARNs and inference profiles
+// (e.g. "us.anthropic.claude-3-5-sonnet-20241022-v2:0") resolve too.
+type PriceTable struct {
+	mu     sync.RWMutex
+	prices map[string]ModelPrice
+}
+
+// NewPriceTable returns a table with the default prices
+func NewPriceTable() *PriceTable {
+	prices := make(map[string]ModelPrice, len(defaultModelPrices))
+	for model, price := range defaultModelPrices {
+		prices[model] = price
+	}
+	return &PriceTable{prices: prices}
+}
+
+// LoadJSON adds or overrides prices from a JSON object of model -> {input, output}
+func (t *PriceTable) LoadJSON(data string) error {
+	var prices map[string]ModelPrice
+	if err := json.Unmarshal([]byte(data), &prices); err != nil {
+		return fmt.Errorf("invalid model prices: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for model, price := range prices {
+		t.prices[model] = price
+	}
+	return nil
+}
+
+// Cost returns the cost in USD of a model invocation; unknown models cost 0
+func (t *PriceTable) Cost(model string, inputTokens, outputTokens int64) float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var price ModelPrice
+	matched := ""
+	for key, p := range t.prices {
+		if strings.Contains(model, key) && len(key) > len(matched) {
+			matched = key
+			price = p
+		}
+	}
+
+	return (float64(inputTokens)*price.Input + float64(outputTokens)*price.Output) / 1_000_000
+}
+
+// usageTracker sums the token usage of the model invocations in an agent's traces
+type usageTracker struct {
+	prices *PriceTable
+	model  string // Foundation model of the latest model invocation input
+	total  models.TokenUsage
+}
+
+func newUsageTracker(prices *PriceTable) *usageTracker {
+	return &usageTracker{prices: prices}
+}
+
+// observe records the model of invocation inputs and returns the priced usage of
+// invocation outputs (nil for other traces)
+func (t *usageTracker) observe(trace types.Trace) (string, *models.TokenUsage) {
+	input, metadata := modelInvocation(trace)
+	if input != nil && input.FoundationModel != nil {
+		t.model = *input.FoundationModel
+	}
+	if metadata == nil || metadata.Usage == nil {
+		return "", nil
+	}
+
+	usage := models.TokenUsage{
+		InputTokens:  int64(aws.ToInt32(metadata.Usage.InputTokens)),
+		OutputTokens: int64(aws.ToInt32(metadata.Usage.OutputTokens)),
+	}
+	if t.prices != nil {
+		usage.Cost = t.prices.Cost(t.model, usage.InputTokens, usage.OutputTokens)
+	}
+	t.total.Add(usage)
+	return t.model, &usage
+}
+
+// totalUsage returns the summed usage, or nil if no usage was reported
+func (t *usageTracker) totalUsage() *models.TokenUsage {
+	if t.total.IsZero() {
+		return nil
+	}
+	total := t.total
+	return &total
+}
+
+// modelInvocation returns the model invocation input or output metadata of a trace
+func modelInvocation(trace types.Trace) (*types.ModelInvocationInput, *types.Metadata) {
+	switch t := trace.(type) {
+	case *types.TraceMemberPreProcessingTrace:
+		switch v := t.Value.(type) {
+		case *types.PreProcessingTraceMemberModelInvocationInput:
+			return &v.Value, nil
+		case *types.PreProcessingTraceMemberModelInvocationOutput:
+			return nil, v.Value.Metadata
+		}
+	case *types.TraceMemberOrchestrationTrace:
+		switch v := t.Value.(type) {
+		case *types.OrchestrationTraceMemberModelInvocationInput:
+			return &v.Value, nil
+		case *types.OrchestrationTraceMemberModelInvocationOutput:
+			return nil, v.Value.Metadata
+		}
+	case *types.TraceMemberPostProcessingTrace:
+		switch v := t.Value.(type) {
+		case *types.PostProcessingTraceMemberModelInvocationInput:
+			return &v.Value, nil
+		case *types.PostProcessingTraceMemberModelInvocationOutput:
+			return nil, v.Value.Metadata
+		}
+	case *types.TraceMemberRoutingClassifierTrace:
+		switch v := t.Value.(type) {
+		case *types.RoutingClassifierTraceMemberModelInvocationInput:
+			return &v.Value, nil
+		case *types.RoutingClassifierTraceMemberModelInvocationOutput:
+			return nil, v.Value.Metadata
+		}
+	}
+	return nil, nil
+}
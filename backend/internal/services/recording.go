@@ -0,0 +1,409 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/ui-agentbedrock/backend/internal/models"
+	"github.com/ui-agentbedrock/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RecordingStore persists recorded agent event streams
+type RecordingStore interface {
+	SaveRecording(ctx context.Context, recording *models.AgentRecording) error
+	GetRecording(ctx context.Context, id string) (*models.AgentRecording, error)
+	ListRecordings(ctx context.Context, limit int64) ([]models.AgentRecording, error)
+	// ListTraceRecordings returns the recordings of one invocation, oldest first:
+	// the first call and each return-control follow-up
+	ListTraceRecordings(ctx context.Context, traceID string) ([]models.AgentRecording, error)
+}
+
+// MongoRecordingStore stores recordings in the agent_recordings collection
+type MongoRecordingStore struct {
+	repo *repository.RecordingRepository
+}
+
+func NewMongoRecordingStore(repo *repository.RecordingRepository) *MongoRecordingStore {
+	return &MongoRecordingStore{repo: repo}
+}
+
+func (s *MongoRecordingStore) SaveRecording(ctx context.Context, recording *models.AgentRecording) error {
+	return s.repo.SaveRecording(ctx, recording)
+}
+
+func (s *MongoRecordingStore) GetRecording(ctx context.Context, id string) (*models.AgentRecording, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetRecording(ctx, objectID)
+}
+
+func (s *MongoRecordingStore) ListRecordings(ctx context.Context, limit int64) ([]models.AgentRecording, error) {
+	return s.repo.ListRecordings(ctx, limit)
+}
+
+func (s *MongoRecordingStore) ListTraceRecordings(ctx context.Context, traceID string) ([]models.AgentRecording, error) {
+	return s.repo.ListTraceRecordings(ctx, traceID)
+}
+
+// FileRecordingStore stores each recording as <id>.json in a directory.
+// Recordings written here can be checked in as regression fixtures.
+type FileRecordingStore struct {
+	dir string
+}
+
+func NewFileRecordingStore(dir string) (*FileRecordingStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create recordings directory: %w", err)
+	}
+	return &FileRecordingStore{dir: dir}, nil
+}
+
+func (s *FileRecordingStore) SaveRecording(ctx context.Context, recording *models.AgentRecording) error {
+	if recording.ID.IsZero() {
+		recording.ID = primitive.NewObjectID()
+	}
+
+	data, err := json.MarshalIndent(recording, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, recording.ID.Hex()+".json"), data, 0o644)
+}
+
+func (s *FileRecordingStore) GetRecording(ctx context.Context, id string) (*models.AgentRecording, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	return LoadRecordingFile(filepath.Join(s.dir, id+".json"))
+}
+
+// ListRecordings returns the most recent recordings without their events
+func (s *FileRecordingStore) ListRecordings(ctx context.Context, limit int64) ([]models.AgentRecording, error) {
+	recordings, err := s.loadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].CreatedAt.After(recordings[j].CreatedAt)
+	})
+	if limit > 0 && int64(len(recordings)) > limit {
+		recordings = recordings[:limit]
+	}
+	for i := range recordings {
+		recordings[i].Events = nil
+	}
+	return recordings, nil
+}
+
+func (s *FileRecordingStore) ListTraceRecordings(ctx context.Context, traceID string) ([]models.AgentRecording, error) {
+	all, err := s.loadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var recordings []models.AgentRecording
+	for _, recording := range all {
+		if recording.TraceID == traceID {
+			recordings = append(recordings, recording)
+		}
+	}
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].CreatedAt.Before(recordings[j].CreatedAt)
+	})
+	return recordings, nil
+}
+
+// loadAll reads every recording in the directory
+func (s *FileRecordingStore) loadAll() ([]models.AgentRecording, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	recordings := []models.AgentRecording{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		recording, err := LoadRecordingFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			log.Printf("Warning: Skipping unreadable recording %s: %v", entry.Name(), err)
+			continue
+		}
+		recordings = append(recordings, *recording)
+	}
+	return recordings, nil
+}
+
+// LoadRecordingFile reads a recording written by FileRecordingStore
+func LoadRecordingFile(path string) (*models.AgentRecording, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var recording models.AgentRecording
+	if err := json.Unmarshal(data, &recording); err != nil {
+		return nil, fmt.Errorf("invalid recording %s: %w", path, err)
+	}
+	return &recording, nil
+}
+
+// RecordingRuntime wraps an AgentRuntime and saves the raw event stream of every invocation
+type RecordingRuntime struct {
+	runtime AgentRuntime
+	store   RecordingStore
+}
+
+func NewRecordingRuntime(runtime AgentRuntime, store RecordingStore) *RecordingRuntime {
+	return &RecordingRuntime{
+		runtime: runtime,
+		store:   store,
+	}
+}
+
+// InvokeAgent invokes the wrapped runtime and records its events as they are read
+func (r *RecordingRuntime) InvokeAgent(ctx context.Context, input *bedrockagentruntime.InvokeAgentInput) (AgentEventStream, error) {
+	recording := &models.AgentRecording{
+		ID:             primitive.NewObjectID(),
+		TraceID:        TraceIDFromContext(ctx),
+		AgentID:        aws.ToString(input.AgentId),
+		AgentAliasID:   aws.ToString(input.AgentAliasId),
+		AgentSessionID: aws.ToString(input.SessionId),
+		InputText:      aws.ToString(input.InputText),
+		Events:         []models.RecordedEvent{},
+		CreatedAt:      time.Now(),
+	}
+
+	// A return-control follow-up carries the action results, replays answer with them
+	if state := input.SessionState; state != nil && len(state.ReturnControlInvocationResults) > 0 {
+		recording.InvocationID = aws.ToString(state.InvocationId)
+		results, err := EncodeInvocationResults(state.ReturnControlInvocationResults)
+		if err != nil {
+			log.Printf("Warning: Not recording action results: %v", err)
+		}
+		recording.Results = results
+	}
+
+	stream, err := r.runtime.InvokeAgent(ctx, input)
+	if err != nil {
+		recording.Error = err.Error()
+		r.save(recording)
+		return nil, err
+	}
+
+	return newRecordingStream(stream, recording, r.save), nil
+}
+
+func (r *RecordingRuntime) save(recording *models.AgentRecording) {
+	// Use a fresh context - the invocation context may already be cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := r.store.SaveRecording(ctx, recording); err != nil {
+		log.Printf("Warning: Failed to save agent recording %s: %v", recording.ID.Hex(), err)
+	}
+}
+
+// recordingStream forwards events from the wrapped stream while recording them
+type recordingStream struct {
+	inner  AgentEventStream
+	events chan types.ResponseStream
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newRecordingStream(inner AgentEventStream, recording *models.AgentRecording, save func(*models.AgentRecording)) *recordingStream {
+	s := &recordingStream{
+		inner:  inner,
+		events: make(chan types.ResponseStream),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.events)
+		defer func() {
+			if err := inner.Err(); err != nil {
+				recording.Error = err.Error()
+			}
+			save(recording)
+		}()
+
+		for event := range inner.Events() {
+			recorded, err := EncodeStreamEvent(event, time.Since(recording.CreatedAt))
+			if err != nil {
+				log.Printf("Warning: Not recording stream event: %v", err)
+			} else {
+				recording.Events = append(recording.Events, recorded)
+			}
+
+			select {
+			case s.events <- event:
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+func (s *recordingStream) Events() <-chan types.ResponseStream {
+	return s.events
+}
+
+func (s *recordingStream) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return s.inner.Close()
+}
+
+func (s *recordingStream) Err() error {
+	return s.inner.Err()
+}
+
+// ReplayRuntime plays recordings back, ignoring the input. A new invocation of a
+// session starts over with the first recording and each return-control follow-up
+// plays the next one, once; follow-ups past the last recording fail. Events are fed
+// through the normal AgentService parsing so replays produce the same agent steps
+// and SSE events as the original run.
+type ReplayRuntime struct {
+	recordings []*models.AgentRecording
+	realtime   bool // Reproduce the original timing between events
+	mu         sync.Mutex
+	next       map[string]int // Next recording per agent session
+}
+
+func NewReplayRuntime(recording *models.AgentRecording, realtime bool) *ReplayRuntime {
+	return NewReplaySequenceRuntime([]*models.AgentRecording{recording}, realtime)
+}
+
+// NewReplaySequenceRuntime replays an invocation that returned control: the first
+// call and its follow-ups, as listed by RecordingStore.ListTraceRecordings
+func NewReplaySequenceRuntime(recordings []*models.AgentRecording, realtime bool) *ReplayRuntime {
+	return &ReplayRuntime{
+		recordings: recordings,
+		realtime:   realtime,
+		next:       make(map[string]int),
+	}
+}
+
+// InvokeAgent streams the events of the next recording
+func (r *ReplayRuntime) InvokeAgent(ctx context.Context, input *bedrockagentruntime.InvokeAgentInput) (AgentEventStream, error) {
+	sessionID := aws.ToString(input.SessionId)
+	r.mu.Lock()
+	if input.SessionState == nil || len(input.SessionState.ReturnControlInvocationResults) == 0 {
+		r.next[sessionID] = 0
+	}
+	next := r.next[sessionID]
+	if next >= len(r.recordings) {
+		r.mu.Unlock()
+		return nil, errors.New("replay: no recorded follow-up for this return-control round")
+	}
+	recording := r.recordings[next]
+	r.next[sessionID] = next + 1
+	r.mu.Unlock()
+
+	var recordedErr error
+	if recording.Error != "" {
+		recordedErr = errors.New(recording.Error)
+	}
+
+	// The recorded invocation failed before streaming anything
+	if recordedErr != nil && len(recording.Events) == 0 {
+		return nil, recordedErr
+	}
+
+	events := make([]scriptedEvent, 0, len(recording.Events))
+	var lastOffset int64
+	for _, recorded := range recording.Events {
+		event, err := DecodeStreamEvent(recorded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recorded event: %w", err)
+		}
+
+		var delay time.Duration
+		if r.realtime && recorded.OffsetMs > lastOffset {
+			delay = time.Duration(recorded.OffsetMs-lastOffset) * time.Millisecond
+		}
+		lastOffset = recorded.OffsetMs
+
+		events = append(events, scriptedEvent{event: event, delay: delay})
+	}
+
+	return newScriptedEventStream(ctx, events, recordedErr), nil
+}
+
+// actionResult returns the recorded result of an action of a return-control
+// round: its output, or error, and the user's confirmation decision
+func (r *ReplayRuntime) actionResult(invocationID string, call ActionCall) (string, types.ConfirmationState, error) {
+	for _, recording := range r.recordings {
+		if recording.InvocationID != invocationID || recording.Results == "" {
+			continue
+		}
+		results, err := DecodeInvocationResults(recording.Results)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid recorded action results: %w", err)
+		}
+
+		for _, result := range results {
+			var matches bool
+			var body map[string]types.ContentBody
+			var state types.ResponseState
+			var confirmation types.ConfirmationState
+			switch v := result.(type) {
+			case *types.InvocationResultMemberMemberApiResult:
+				matches = aws.ToString(v.Value.ActionGroup) == call.ActionGroup && aws.ToString(v.Value.ApiPath) == call.Function &&
+					aws.ToString(v.Value.HttpMethod) == call.HTTPMethod
+				body, state, confirmation = v.Value.ResponseBody, v.Value.ResponseState, v.Value.ConfirmationState
+			case *types.InvocationResultMemberMemberFunctionResult:
+				matches = aws.ToString(v.Value.ActionGroup) == call.ActionGroup && aws.ToString(v.Value.Function) == call.Function &&
+					call.HTTPMethod == ""
+				body, state, confirmation = v.Value.ResponseBody, v.Value.ResponseState, v.Value.ConfirmationState
+			}
+			if !matches {
+				continue
+			}
+
+			var output string
+			for _, content := range body {
+				output = aws.ToString(content.Body)
+				break
+			}
+			if state == types.ResponseStateFailure {
+				return "", confirmation, errors.New(output)
+			}
+			return output, confirmation, nil
+		}
+	}
+	return "", "", fmt.Errorf("no recorded result for %s.%s", call.ActionGroup, call.Function)
+}
+
+type traceIDKey struct{}
+
+// ContextWithTraceID attaches the trace ID of the current invocation to ctx
+func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// TraceIDFromContext returns the trace ID set by ContextWithTraceID, if any
+func TraceIDFromContext(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey{}).(string)
+	return traceID
+}
@@ -0,0 +1,444 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/ui-agentbedrock/backend/internal/models"
+)
+
+// The SDK stream types are unions (interfaces) and can't be round-tripped with
+// encoding/json directly, so each union level is flattened into a kind/member pair
+// with the member's struct value stored as JSON.
+// Nested unions inside those structs (reasoning content, document metadata,
+// caller chains) are not restored on decode.
+
+// recordedTracePart is the JSON form of types.TracePart
+type recordedTracePart struct {
+	AgentAliasID     *string         `json:"agentAliasId,omitempty"`
+	AgentID          *string         `json:"agentId,omitempty"`
+	AgentVersion     *string         `json:"agentVersion,omitempty"`
+	CollaboratorName *string         `json:"collaboratorName,omitempty"`
+	EventTime        *time.Time      `json:"eventTime,omitempty"`
+	SessionID        *string         `json:"sessionId,omitempty"`
+	Kind             string          `json:"kind"`             // Trace member, e.g. "orchestration"
+	Member           string          `json:"member,omitempty"` // Inner member for nested unions, e.g. "observation"
+	Value            json.RawMessage `json:"value"`
+}
+
+// recordedReturnControl is the JSON form of types.ReturnControlPayload
+type recordedReturnControl struct {
+	InvocationID *string                  `json:"invocationId,omitempty"`
+	Inputs       []recordedInvocationItem `json:"inputs"`
+}
+
+type recordedInvocationItem struct {
+	Kind  string          `json:"kind"` // "api" | "function"
+	Value json.RawMessage `json:"value"`
+}
+
+// EncodeStreamEvent converts a raw stream event into a RecordedEvent
+func EncodeStreamEvent(event types.ResponseStream, offset time.Duration) (models.RecordedEvent, error) {
+	recorded := models.RecordedEvent{OffsetMs: offset.Milliseconds()}
+
+	var payload interface{}
+	switch v := event.(type) {
+	case *types.ResponseStreamMemberChunk:
+		recorded.Type = "chunk"
+		payload = v.Value
+	case *types.ResponseStreamMemberTrace:
+		recorded.Type = "trace"
+		part, err := encodeTracePart(v.Value)
+		if err != nil {
+			return recorded, err
+		}
+		payload = part
+	case *types.ResponseStreamMemberReturnControl:
+		recorded.Type = "return_control"
+		rc, err := encodeReturnControl(v.Value)
+		if err != nil {
+			return recorded, err
+		}
+		payload = rc
+	case *types.ResponseStreamMemberFiles:
+		recorded.Type = "files"
+		payload = v.Value
+	default:
+		return recorded, fmt.Errorf("unsupported stream event %T", event)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return recorded, err
+	}
+	recorded.Data = string(data)
+	return recorded, nil
+}
+
+// DecodeStreamEvent converts a RecordedEvent back into a raw stream event
+func DecodeStreamEvent(recorded models.RecordedEvent) (types.ResponseStream, error) {
+	data := []byte(recorded.Data)
+
+	switch recorded.Type {
+	case "chunk":
+		var v types.PayloadPart
+		if err := unmarshalLenient(data, &v); err != nil {
+			return nil, err
+		}
+		return &types.ResponseStreamMemberChunk{Value: v}, nil
+	case "trace":
+		var part recordedTracePart
+		if err := json.Unmarshal(data, &part); err != nil {
+			return nil, err
+		}
+		v, err := decodeTracePart(part)
+		if err != nil {
+			return nil, err
+		}
+		return &types.ResponseStreamMemberTrace{Value: v}, nil
+	case "return_control":
+		var rc recordedReturnControl
+		if err := json.Unmarshal(data, &rc); err != nil {
+			return nil, err
+		}
+		v, err := decodeReturnControl(rc)
+		if err != nil {
+			return nil, err
+		}
+		return &types.ResponseStreamMemberReturnControl{Value: v}, nil
+	case "files":
+		var v types.FilePart
+		if err := unmarshalLenient(data, &v); err != nil {
+			return nil, err
+		}
+		return &types.ResponseStreamMemberFiles{Value: v}, nil
+	default:
+		return nil, fmt.Errorf("unsupported recorded event type: %s", recorded.Type)
+	}
+}
+
+// unmarshalLenient decodes JSON, skipping fields that can't be decoded into their
+// Go type (nested SDK unions) instead of failing the whole event
+func unmarshalLenient(data []byte, v interface{}) error {
+	err := json.Unmarshal(data, v)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return nil
+	}
+	return err
+}
+
+func encodeTracePart(tp types.TracePart) (recordedTracePart, error) {
+	part := recordedTracePart{
+		AgentAliasID:     tp.AgentAliasId,
+		AgentID:          tp.AgentId,
+		AgentVersion:     tp.AgentVersion,
+		CollaboratorName: tp.CollaboratorName,
+		EventTime:        tp.EventTime,
+		SessionID:        tp.SessionId,
+	}
+
+	var value interface{}
+	switch t := tp.Trace.(type) {
+	case *types.TraceMemberPreProcessingTrace:
+		part.Kind = "pre_processing"
+		switch inner := t.Value.(type) {
+		case *types.PreProcessingTraceMemberModelInvocationInput:
+			part.Member, value = "model_invocation_input", inner.Value
+		case *types.PreProcessingTraceMemberModelInvocationOutput:
+			part.Member, value = "model_invocation_output", inner.Value
+		default:
+			return part, fmt.Errorf("unsupported pre-processing trace %T", t.Value)
+		}
+	case *types.TraceMemberOrchestrationTrace:
+		part.Kind = "orchestration"
+		switch inner := t.Value.(type) {
+		case *types.OrchestrationTraceMemberInvocationInput:
+			part.Member, value = "invocation_input", inner.Value
+		case *types.OrchestrationTraceMemberModelInvocationInput:
+			part.Member, value = "model_invocation_input", inner.Value
+		case *types.OrchestrationTraceMemberModelInvocationOutput:
+			part.Member, value = "model_invocation_output", inner.Value
+		case *types.OrchestrationTraceMemberObservation:
+			part.Member, value = "observation", inner.Value
+		case *types.OrchestrationTraceMemberRationale:
+			part.Member, value = "rationale", inner.Value
+		default:
+			return part, fmt.Errorf("unsupported orchestration trace %T", t.Value)
+		}
+	case *types.TraceMemberPostProcessingTrace:
+		part.Kind = "post_processing"
+		switch inner := t.Value.(type) {
+		case *types.PostProcessingTraceMemberModelInvocationInput:
+			part.Member, value = "model_invocation_input", inner.Value
+		case *types.PostProcessingTraceMemberModelInvocationOutput:
+			part.Member, value = "model_invocation_output", inner.Value
+		default:
+			return part, fmt.Errorf("unsupported post-processing trace %T", t.Value)
+		}
+	case *types.TraceMemberRoutingClassifierTrace:
+		part.Kind = "routing_classifier"
+		switch inner := t.Value.(type) {
+		case *types.RoutingClassifierTraceMemberInvocationInput:
+			part.Member, value = "invocation_input", inner.Value
+		case *types.RoutingClassifierTraceMemberModelInvocationInput:
+			part.Member, value = "model_invocation_input", inner.Value
+		case *types.RoutingClassifierTraceMemberModelInvocationOutput:
+			part.Member, value = "model_invocation_output", inner.Value
+		case *types.RoutingClassifierTraceMemberObservation:
+			part.Member, value = "observation", inner.Value
+		default:
+			return part, fmt.Errorf("unsupported routing classifier trace %T", t.Value)
+		}
+	case *types.TraceMemberFailureTrace:
+		part.Kind, value = "failure", t.Value
+	case *types.TraceMemberGuardrailTrace:
+		part.Kind, value = "guardrail", t.Value
+	case *types.TraceMemberCustomOrchestrationTrace:
+		part.Kind, value = "custom_orchestration", t.Value
+	default:
+		return part, fmt.Errorf("unsupported trace %T", tp.Trace)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return part, err
+	}
+	part.Value = data
+	return part, nil
+}
+
+func decodeTracePart(part recordedTracePart) (types.TracePart, error) {
+	tp := types.TracePart{
+		AgentAliasId:     part.AgentAliasID,
+		AgentId:          part.AgentID,
+		AgentVersion:     part.AgentVersion,
+		CollaboratorName: part.CollaboratorName,
+		EventTime:        part.EventTime,
+		SessionId:        part.SessionID,
+	}
+
+	var err error
+	switch part.Kind {
+	case "pre_processing":
+		var inner types.PreProcessingTrace
+		switch part.Member {
+		case "model_invocation_input":
+			var v types.ModelInvocationInput
+			err = unmarshalLenient(part.Value, &v)
+			inner = &types.PreProcessingTraceMemberModelInvocationInput{Value: v}
+		case "model_invocation_output":
+			var v types.PreProcessingModelInvocationOutput
+			err = unmarshalLenient(part.Value, &v)
+			inner = &types.PreProcessingTraceMemberModelInvocationOutput{Value: v}
+		default:
+			return tp, fmt.Errorf("unsupported pre-processing member: %s", part.Member)
+		}
+		tp.Trace = &types.TraceMemberPreProcessingTrace{Value: inner}
+
+	case "orchestration":
+		var inner types.OrchestrationTrace
+		switch part.Member {
+		case "invocation_input":
+			var v types.InvocationInput
+			err = unmarshalLenient(part.Value, &v)
+			inner = &types.OrchestrationTraceMemberInvocationInput{Value: v}
+		case "model_invocation_input":
+			var v types.ModelInvocationInput
+			err = unmarshalLenient(part.Value, &v)
+			inner = &types.OrchestrationTraceMemberModelInvocationInput{Value: v}
+		case "model_invocation_output":
+			var v types.OrchestrationModelInvocationOutput
+			err = unmarshalLenient(part.Value, &v)
+			inner = &types.OrchestrationTraceMemberModelInvocationOutput{Value: v}
+		case "observation":
+			var v types.Observation
+			err = unmarshalLenient(part.Value, &v)
+			inner = &types.OrchestrationTraceMemberObservation{Value: v}
+		case "rationale":
+			var v types.Rationale
+			err = unmarshalLenient(part.Value, &v)
+			inner = &types.OrchestrationTraceMemberRationale{Value: v}
+		default:
+			return tp, fmt.Errorf("unsupported orchestration member: %s", part.Member)
+		}
+		tp.Trace = &types.TraceMemberOrchestrationTrace{Value: inner}
+
+	case "post_processing":
+		var inner types.PostProcessingTrace
+		switch part.Member {
+		case "model_invocation_input":
+			var v types.ModelInvocationInput
+			err = unmarshalLenient(part.Value, &v)
+			inner = &types.PostProcessingTraceMemberModelInvocationInput{Value: v}
+		case "model_invocation_output":
+			var v types.PostProcessingModelInvocationOutput
+			err = unmarshalLenient(part.Value, &v)
+			inner = &types.PostProcessingTraceMemberModelInvocationOutput{Value: v}
+		default:
+			return tp, fmt.Errorf("unsupported post-processing member: %s", part.Member)
+		}
+		tp.Trace = &types.TraceMemberPostProcessingTrace{Value: inner}
+
+	case "routing_classifier":
+		var inner types.RoutingClassifierTrace
+		switch part.Member {
+		case "invocation_input":
+			var v types.InvocationInput
+			err = unmarshalLenient(part.Value, &v)
+			inner = &types.RoutingClassifierTraceMemberInvocationInput{Value: v}
+		case "model_invocation_input":
+			var v types.ModelInvocationInput
+			err = unmarshalLenient(part.Value, &v)
+			inner = &types.RoutingClassifierTraceMemberModelInvocationInput{Value: v}
+		case "model_invocation_output":
+			var v types.RoutingClassifierModelInvocationOutput
+			err = unmarshalLenient(part.Value, &v)
+			inner = &types.RoutingClassifierTraceMemberModelInvocationOutput{Value: v}
+		case "observation":
+			var v types.Observation
+			err = unmarshalLenient(part.Value, &v)
+			inner = &types.RoutingClassifierTraceMemberObservation{Value: v}
+		default:
+			return tp, fmt.Errorf("unsupported routing classifier member: %s", part.Member)
+		}
+		tp.Trace = &types.TraceMemberRoutingClassifierTrace{Value: inner}
+
+	case "failure":
+		var v types.FailureTrace
+		err = unmarshalLenient(part.Value, &v)
+		tp.Trace = &types.TraceMemberFailureTrace{Value: v}
+
+	case "guardrail":
+		var v types.GuardrailTrace
+		err = unmarshalLenient(part.Value, &v)
+		tp.Trace = &types.TraceMemberGuardrailTrace{Value: v}
+
+	case "custom_orchestration":
+		var v types.CustomOrchestrationTrace
+		err = unmarshalLenient(part.Value, &v)
+		tp.Trace = &types.TraceMemberCustomOrchestrationTrace{Value: v}
+
+	default:
+		return tp, fmt.Errorf("unsupported trace kind: %s", part.Kind)
+	}
+
+	return tp, err
+}
+
+func encodeReturnControl(payload types.ReturnControlPayload) (recordedReturnControl, error) {
+	rc := recordedReturnControl{
+		InvocationID: payload.InvocationId,
+		Inputs:       make([]recordedInvocationItem, 0, len(payload.InvocationInputs)),
+	}
+
+	for _, input := range payload.InvocationInputs {
+		var item recordedInvocationItem
+		var value interface{}
+		switch v := input.(type) {
+		case *types.InvocationInputMemberMemberApiInvocationInput:
+			item.Kind, value = "api", v.Value
+		case *types.InvocationInputMemberMemberFunctionInvocationInput:
+			item.Kind, value = "function", v.Value
+		default:
+			return rc, fmt.Errorf("unsupported invocation input %T", input)
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return rc, err
+		}
+		item.Value = data
+		rc.Inputs = append(rc.Inputs, item)
+	}
+
+	return rc, nil
+}
+
+func decodeReturnControl(rc recordedReturnControl) (types.ReturnControlPayload, error) {
+	payload := types.ReturnControlPayload{InvocationId: rc.InvocationID}
+
+	for _, item := range rc.Inputs {
+		switch item.Kind {
+		case "api":
+			var v types.ApiInvocationInput
+			if err := unmarshalLenient(item.Value, &v); err != nil {
+				return payload, err
+			}
+			payload.InvocationInputs = append(payload.InvocationInputs, &types.InvocationInputMemberMemberApiInvocationInput{Value: v})
+		case "function":
+			var v types.FunctionInvocationInput
+			if err := unmarshalLenient(item.Value, &v); err != nil {
+				return payload, err
+			}
+			payload.InvocationInputs = append(payload.InvocationInputs, &types.InvocationInputMemberMemberFunctionInvocationInput{Value: v})
+		default:
+			return payload, fmt.Errorf("unsupported invocation input kind: %s", item.Kind)
+		}
+	}
+
+	return payload, nil
+}
+
+// EncodeInvocationResults converts the action results handed back to the agent
+// in a return-control follow-up into the JSON kept in AgentRecording.Results
+func EncodeInvocationResults(results []types.InvocationResultMember) (string, error) {
+	items := make([]recordedInvocationItem, 0, len(results))
+	for _, result := range results {
+		var item recordedInvocationItem
+		var value interface{}
+		switch v := result.(type) {
+		case *types.InvocationResultMemberMemberApiResult:
+			item.Kind, value = "api", v.Value
+		case *types.InvocationResultMemberMemberFunctionResult:
+			item.Kind, value = "function", v.Value
+		default:
+			return "", fmt.Errorf("unsupported invocation result %T", result)
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		item.Value = data
+		items = append(items, item)
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// DecodeInvocationResults converts AgentRecording.Results back into action results
+func DecodeInvocationResults(data string) ([]types.InvocationResultMember, error) {
+	var items []recordedInvocationItem
+	if err := json.Unmarshal([]byte(data), &items); err != nil {
+		return nil, err
+	}
+
+	results := make([]types.InvocationResultMember, 0, len(items))
+	for _, item := range items {
+		switch item.Kind {
+		case "api":
+			var v types.ApiResult
+			if err := unmarshalLenient(item.Value, &v); err != nil {
+				return nil, err
+			}
+			results = append(results, &types.InvocationResultMemberMemberApiResult{Value: v})
+		case "function":
+			var v types.FunctionResult
+			if err := unmarshalLenient(item.Value, &v); err != nil {
+				return nil, err
+			}
+			results = append(results, &types.InvocationResultMemberMemberFunctionResult{Value: v})
+		default:
+			return nil, fmt.Errorf("unsupported invocation result kind: %s", item.Kind)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/ui-agentbedrock/backend/internal/models"
+)
+
+// AgentError is a classified agent invocation failure
+type AgentError struct {
+	Class models.ErrorClass
+	Err   error
+}
+
+func (e *AgentError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Class, e.Err)
+}
+
+func (e *AgentError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the same invocation may succeed if tried again
+func (e *AgentError) Retryable() bool {
+	switch e.Class {
+	case models.ErrorClassThrottling, models.ErrorClassServiceError, models.ErrorClassStreamInterrupted:
+		return true
+	}
+	return false
+}
+
+// degradesService reports whether the error counts against the circuit breaker.
+// Client errors such as validation or missing permissions say nothing about Bedrock's health.
+func (e *AgentError) degradesService() bool {
+	return e.Retryable() || e.Class == models.ErrorClassDependencyFailed
+}
+
+// ErrCircuitOpen is returned while the circuit breaker fails invocations fast
+var ErrCircuitOpen = errors.New("agent service is temporarily unavailable")
+
+// classifyError maps an InvokeAgent or stream error to an AgentError.
+// fromStream marks errors of a stream that broke off after it started.
+func classifyError(err error, fromStream bool) *AgentError {
+	var agentErr *AgentError
+	if errors.As(err, &agentErr) {
+		return agentErr
+	}
+
+	class := models.ErrorClassUnknown
+	var (
+		throttling    *types.ThrottlingException
+		quota         *types.ServiceQuotaExceededException
+		accessDenied  *types.AccessDeniedException
+		validation    *types.ValidationException
+		notFound      *types.ResourceNotFoundException
+		conflict      *types.ConflictException
+		dependency    *types.DependencyFailedException
+		internal      *types.InternalServerException
+		badGateway    *types.BadGatewayException
+		modelNotReady *types.ModelNotReadyException
+		netErr        net.Error
+	)
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		class = models.ErrorClassServiceUnavailable
+	case errors.As(err, &throttling):
+		class = models.ErrorClassThrottling
+	case errors.As(err, &quota):
+		class = models.ErrorClassQuotaExceeded
+	case errors.As(err, &accessDenied):
+		class = models.ErrorClassAccessDenied
+	case errors.As(err, &validation):
+		class = models.ErrorClassValidation
+	case errors.As(err, &notFound):
+		class = models.ErrorClassNotFound
+	case errors.As(err, &conflict):
+		class = models.ErrorClassConflict
+	case errors.As(err, &dependency):
+		class = models.ErrorClassDependencyFailed
+	case errors.As(err, &internal), errors.As(err, &badGateway), errors.As(err, &modelNotReady):
+		class = models.ErrorClassServiceError
+	case fromStream:
+		class = models.ErrorClassStreamInterrupted
+	case errors.As(err, &netErr):
+		class = models.ErrorClassServiceError
+	}
+
+	return &AgentError{Class: class, Err: err}
+}
+
+// RetryPolicy is the exponential backoff for retrying failed invocations
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// DefaultRetryPolicy retries three times after 0.5s, 1s and 2s (with jitter)
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  500 * time.Millisecond,
+	MaxDelay:   8 * time.Second,
+}
+
+// delay returns the wait before retry number attempt (0-based), with up to 20% jitter
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := p.BaseDelay << attempt
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// wait sleeps before a retry, returning false if ctx ends first
+func (p RetryPolicy) wait(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(p.delay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// CircuitBreaker fails invocations fast after repeated service failures.
+// After the cooldown one invocation is let through; its result closes the
+// circuit again or restarts the cooldown.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int           // Consecutive failures that open the circuit
+	cooldown  time.Duration // How long the circuit stays open
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow returns ErrCircuitOpen and the time left while the circuit is open
+func (b *CircuitBreaker) Allow() (time.Duration, error) {
+	if b == nil {
+		return 0, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return 0, nil
+	}
+	if remaining := time.Until(b.openUntil); remaining > 0 || b.probing {
+		if remaining < 0 {
+			remaining = 0
+		}
+		return remaining, ErrCircuitOpen
+	}
+
+	// Cooldown over: let one invocation probe the service
+	b.probing = true
+	return 0, nil
+}
+
+// RecordSuccess closes the circuit
+func (b *CircuitBreaker) RecordSuccess() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.probing = false
+}
+
+// RecordFailure counts a service failure, opening the circuit at the threshold
+// or when the probe after a cooldown fails
+func (b *CircuitBreaker) RecordFailure() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.probing || b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+		b.probing = false
+	}
+}
+
+// Release ends a probe without a result (e.g. the invocation was cancelled),
+// so the next invocation probes instead
+func (b *CircuitBreaker) Release() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// failInvocation reports a failed invocation to the client and records it on the trace.
+// An open circuit is reported as service_unavailable with the time until the next try.
+func (s *AgentService) failInvocation(trace *models.Trace, agentErr *AgentError, retryAfter time.Duration, callback StreamCallback) error {
+	if agentErr.Class == models.ErrorClassServiceUnavailable {
+		callback(models.SSEEvent{
+			Event: "service_unavailable",
+			Data: models.ServiceUnavailableEvent{
+				Message:    agentErr.Err.Error(),
+				RetryAfter: int((retryAfter + time.Second - 1) / time.Second),
+			},
+		})
+	} else {
+		callback(models.SSEEvent{
+			Event: "error",
+			Data: models.ErrorEvent{
+				Type:    "InvokeAgentError",
+				Class:   agentErr.Class,
+				Message: agentErr.Err.Error(),
+				Source:  "AgentBedrock",
+			},
+		})
+	}
+
+	trace.Error = &models.ErrorInfo{
+		Type:    "InvokeAgentError",
+		Class:   agentErr.Class,
+		Message: agentErr.Err.Error(),
+		Source:  "AgentBedrock",
+	}
+	return agentErr
+}
+
+// failRunningSteps ends the steps a failed attempt left running
+func failRunningSteps(trace *models.Trace, callback StreamCallback) {
+	for i := range trace.AgentSteps {
+		if trace.AgentSteps[i].Status == "running" {
+			finishStep(&trace.AgentSteps[i], time.Now(), "error")
+			callback(models.SSEEvent{Event: "agent_step", Data: stepEvent(trace.AgentSteps[i])})
+		}
+	}
+}
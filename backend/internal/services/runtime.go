@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+)
+
+// AgentEventStream is the event stream returned by a single agent invocation.
+// It matches the shape of *bedrockagentruntime.InvokeAgentEventStream so the real
+// SDK stream can be used as-is.
+type AgentEventStream interface {
+	Events() <-chan types.ResponseStream
+	Close() error
+	Err() error
+}
+
+// AgentRuntime invokes an agent and returns its raw event stream.
+// AgentService parses the stream, so any runtime (Bedrock, fake, replay) gets the
+// same trace handling and SSE events.
+type AgentRuntime interface {
+	InvokeAgent(ctx context.Context, input *bedrockagentruntime.InvokeAgentInput) (AgentEventStream, error)
+}
+
+// BedrockRuntime is the AgentRuntime backed by the AWS Bedrock Agent Runtime API
+type BedrockRuntime struct {
+	client *bedrockagentruntime.Client
+}
+
+func NewBedrockRuntime(client *bedrockagentruntime.Client) *BedrockRuntime {
+	return &BedrockRuntime{client: client}
+}
+
+// InvokeAgent calls Bedrock InvokeAgent and returns the response stream
+func (r *BedrockRuntime) InvokeAgent(ctx context.Context, input *bedrockagentruntime.InvokeAgentInput) (AgentEventStream, error) {
+	output, err := r.client.InvokeAgent(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return output.GetStream(), nil
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+)
+
+// scriptedEvent is an event to deliver after a delay
+type scriptedEvent struct {
+	event types.ResponseStream
+	delay time.Duration
+}
+
+// scriptedEventStream delivers a fixed list of events over a channel.
+// It backs the fake and replay runtimes.
+type scriptedEventStream struct {
+	events chan types.ResponseStream
+	done   chan struct{}
+	once   sync.Once
+	mu     sync.Mutex
+	err    error
+}
+
+// newScriptedEventStream starts delivering events; finalErr is reported by Err
+// once all events were delivered (e.g. a recorded stream interruption)
+func newScriptedEventStream(ctx context.Context, events []scriptedEvent, finalErr error) *scriptedEventStream {
+	s := &scriptedEventStream{
+		events: make(chan types.ResponseStream),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.events)
+		for _, e := range events {
+			if e.delay > 0 {
+				select {
+				case <-time.After(e.delay):
+				case <-ctx.Done():
+					s.setErr(ctx.Err())
+					return
+				case <-s.done:
+					return
+				}
+			}
+			select {
+			case s.events <- e.event:
+			case <-ctx.Done():
+				s.setErr(ctx.Err())
+				return
+			case <-s.done:
+				return
+			}
+		}
+		if finalErr != nil {
+			s.setErr(finalErr)
+		}
+	}()
+
+	return s
+}
+
+func (s *scriptedEventStream) Events() <-chan types.ResponseStream {
+	return s.events
+}
+
+func (s *scriptedEventStream) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *scriptedEventStream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *scriptedEventStream) setErr(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
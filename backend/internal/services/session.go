@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/ui-agentbedrock/backend/internal/models"
 	"github.com/ui-agentbedrock/backend/internal/repository"
@@ -16,13 +17,15 @@ func NewSessionService(repo *repository.SessionRepository) *SessionService {
 	return &SessionService{repo: repo}
 }
 
-func (s *SessionService) CreateSession(ctx context.Context, title string) (*models.Session, error) {
+func (s *SessionService) CreateSession(ctx context.Context, title, agentKey string, attributes models.AgentAttributes) (*models.Session, error) {
 	if title == "" {
 		title = "New Chat"
 	}
 
 	session := &models.Session{
-		Title: title,
+		Title:           title,
+		AgentKey:        agentKey,
+		AgentAttributes: attributes,
 	}
 
 	if err := s.repo.CreateSession(ctx, session); err != nil {
@@ -64,6 +67,16 @@ func (s *SessionService) UpdateSession(ctx context.Context, id string, title str
 	return s.repo.UpdateSession(ctx, objectID, title)
 }
 
+// UpdateAttributes replaces the agent attributes sent on every invocation of a session
+func (s *SessionService) UpdateAttributes(ctx context.Context, id string, attributes models.AgentAttributes) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.UpdateAttributes(ctx, objectID, attributes)
+}
+
 func (s *SessionService) DeleteSession(ctx context.Context, id string) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -73,11 +86,13 @@ func (s *SessionService) DeleteSession(ctx context.Context, id string) error {
 	return s.repo.DeleteSession(ctx, objectID)
 }
 
-func (s *SessionService) SaveMessage(ctx context.Context, sessionID string, role, content string, trace *models.Trace) (*models.Message, error) {
-	return s.SaveMessageWithDocuments(ctx, sessionID, role, content, nil, trace)
+// SaveMessage saves a message in a branch. The branch is the one that was active
+// when the request started, so switching branches meanwhile doesn't move the reply.
+func (s *SessionService) SaveMessage(ctx context.Context, sessionID, branchID string, role, content string, trace *models.Trace) (*models.Message, error) {
+	return s.SaveMessageWithDocuments(ctx, sessionID, branchID, role, content, nil, trace)
 }
 
-func (s *SessionService) SaveMessageWithDocuments(ctx context.Context, sessionID string, role, content string, documents []primitive.ObjectID, trace *models.Trace) (*models.Message, error) {
+func (s *SessionService) SaveMessageWithDocuments(ctx context.Context, sessionID, branchID string, role, content string, documents []primitive.ObjectID, trace *models.Trace) (*models.Message, error) {
 	objectID, err := primitive.ObjectIDFromHex(sessionID)
 	if err != nil {
 		return nil, err
@@ -89,6 +104,30 @@ func (s *SessionService) SaveMessageWithDocuments(ctx context.Context, sessionID
 		Content:   content,
 		Documents: documents,
 		Trace:     trace,
+		BranchID:  branchID,
+	}
+
+	if err := s.repo.SaveMessage(ctx, message); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// SaveMessageWithStatus saves a message with a non-default status (e.g. "cancelled")
+func (s *SessionService) SaveMessageWithStatus(ctx context.Context, sessionID, branchID string, role, content string, trace *models.Trace, status string) (*models.Message, error) {
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	message := &models.Message{
+		SessionID: objectID,
+		Role:      role,
+		Content:   content,
+		Trace:     trace,
+		Status:    status,
+		BranchID:  branchID,
 	}
 
 	if err := s.repo.SaveMessage(ctx, message); err != nil {
@@ -98,6 +137,212 @@ func (s *SessionService) SaveMessageWithDocuments(ctx context.Context, sessionID
 	return message, nil
 }
 
+// GetRegenerateSource returns the assistant message to regenerate, the user
+// message that produced it and the visible messages before that one. Only the
+// latest assistant reply can be regenerated.
+func (s *SessionService) GetRegenerateSource(ctx context.Context, sessionID, messageID string) (*models.Message, *models.Message, []models.Message, error) {
+	sessionObjectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	messageObjectID, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	message, err := s.repo.GetMessage(ctx, messageObjectID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("message not found")
+	}
+	if message.SessionID != sessionObjectID || message.Role != "assistant" {
+		return nil, nil, nil, fmt.Errorf("message is not an assistant reply in this session")
+	}
+
+	session, err := s.repo.GetSession(ctx, sessionObjectID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("session not found")
+	}
+	messages, err := s.repo.GetActiveMessages(ctx, session)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(messages) == 0 || messages[len(messages)-1].ID != message.ID {
+		return nil, nil, nil, fmt.Errorf("only the latest assistant reply can be regenerated")
+	}
+
+	userMessage, err := s.repo.GetPreviousUserMessage(ctx, message)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("no user message found before this reply")
+	}
+
+	// The user message itself may already be summarized away
+	var prior []models.Message
+	for _, visible := range messages {
+		if visible.CreatedAt.Before(userMessage.CreatedAt) {
+			prior = append(prior, visible)
+		}
+	}
+
+	return message, userMessage, prior, nil
+}
+
+// AddMessageVersion replaces a message's content, keeping the old version in its alternates
+func (s *SessionService) AddMessageVersion(ctx context.Context, messageID string, content string, trace *models.Trace, status string) (*models.Message, error) {
+	objectID, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := s.repo.GetMessage(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.AddMessageVersion(ctx, message, content, trace, status); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// GetEditSource returns the session, the user message to edit and the messages
+// before it. The message must be part of the session's active branch.
+func (s *SessionService) GetEditSource(ctx context.Context, sessionID, messageID string) (*models.Session, *models.Message, []models.Message, error) {
+	sessionObjectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	messageObjectID, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	session, err := s.repo.GetSession(ctx, sessionObjectID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("session not found")
+	}
+
+	messages, err := s.repo.GetActiveMessages(ctx, session)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for i := range messages {
+		if messages[i].ID != messageObjectID {
+			continue
+		}
+		if messages[i].Role != "user" {
+			return nil, nil, nil, fmt.Errorf("only user messages can be edited")
+		}
+		return session, &messages[i], messages[:i], nil
+	}
+
+	return nil, nil, nil, fmt.Errorf("message is not part of the active branch")
+}
+
+// CreateBranch forks the active branch just before the edited message and makes
+// the new branch active. The branch gets its own AgentBedrock session seeded
+// with the summary of the messages before the edit.
+func (s *SessionService) CreateBranch(ctx context.Context, session *models.Session, edited *models.Message, prior []models.Message, summary string) (*models.Branch, error) {
+	parentID := session.ActiveBranchID
+	if models.IsMainBranch(parentID) {
+		parentID = models.MainBranchID
+	}
+
+	// Keep the parent's AgentBedrock session so switching back resumes it
+	if session.FindBranch(parentID) == nil {
+		session.Branches = append(session.Branches, models.Branch{
+			ID:        models.MainBranchID,
+			CreatedAt: session.CreatedAt,
+		})
+	}
+	parent := session.FindBranch(parentID)
+	parent.AgentSessionID = session.AgentSessionID
+	parent.SummaryContext = session.SummaryContext
+
+	branch := &models.Branch{
+		ID:              primitive.NewObjectID().Hex(),
+		ParentBranchID:  parentID,
+		EditedMessageID: edited.ID,
+		ForkedAt:        edited.CreatedAt,
+		SummaryContext:  summary,
+	}
+	if len(prior) > 0 {
+		branch.ParentMessageID = prior[len(prior)-1].ID
+	}
+
+	if err := s.repo.CreateBranch(ctx, session, branch); err != nil {
+		return nil, err
+	}
+
+	return branch, nil
+}
+
+// GetBranches returns the active branch ID and every branch of a session,
+// including the main branch
+func (s *SessionService) GetBranches(ctx context.Context, sessionID string) (string, []models.Branch, error) {
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	session, err := s.repo.GetSession(ctx, objectID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	branches := session.Branches
+	if session.FindBranch(models.MainBranchID) == nil {
+		branches = append([]models.Branch{{ID: models.MainBranchID, CreatedAt: session.CreatedAt}}, branches...)
+	}
+
+	activeBranchID := session.ActiveBranchID
+	if models.IsMainBranch(activeBranchID) {
+		activeBranchID = models.MainBranchID
+	}
+
+	return activeBranchID, branches, nil
+}
+
+// SwitchBranch makes branchID the active branch and restores its AgentBedrock session
+func (s *SessionService) SwitchBranch(ctx context.Context, sessionID, branchID string) error {
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return err
+	}
+
+	session, err := s.repo.GetSession(ctx, objectID)
+	if err != nil {
+		return err
+	}
+
+	target := session.FindBranch(branchID)
+	if target == nil {
+		return fmt.Errorf("branch not found")
+	}
+
+	currentID := session.ActiveBranchID
+	if models.IsMainBranch(currentID) {
+		currentID = models.MainBranchID
+	}
+	if currentID == branchID {
+		return nil
+	}
+
+	// Store the current branch's AgentBedrock session before leaving it
+	if current := session.FindBranch(currentID); current != nil {
+		current.AgentSessionID = session.AgentSessionID
+		current.SummaryContext = session.SummaryContext
+	}
+
+	activeBranchID := target.ID
+	if models.IsMainBranch(activeBranchID) {
+		activeBranchID = ""
+	}
+
+	return s.repo.UpdateBranches(ctx, objectID, session.Branches, activeBranchID, target.AgentSessionID, target.SummaryContext)
+}
+
 func (s *SessionService) UpdateMessageTrace(ctx context.Context, messageID string, trace *models.Trace) error {
 	objectID, err := primitive.ObjectIDFromHex(messageID)
 	if err != nil {
@@ -107,6 +352,16 @@ func (s *SessionService) UpdateMessageTrace(ctx context.Context, messageID strin
 	return s.repo.UpdateMessageTrace(ctx, objectID, trace)
 }
 
+// UpdateMessageCitations stores the knowledge base citations of a message
+func (s *SessionService) UpdateMessageCitations(ctx context.Context, messageID string, citations []models.Citation) error {
+	objectID, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.UpdateMessageCitations(ctx, objectID, citations)
+}
+
 // ClearMessages clears all messages from a session
 func (s *SessionService) ClearMessages(ctx context.Context, sessionID string) error {
 	objectID, err := primitive.ObjectIDFromHex(sessionID)
@@ -127,6 +382,16 @@ func (s *SessionService) GetMessageCount(ctx context.Context, sessionID string)
 	return s.repo.GetMessageCount(ctx, objectID)
 }
 
+// GetMessage returns a single message by ID
+func (s *SessionService) GetMessage(ctx context.Context, messageID string) (*models.Message, error) {
+	objectID, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetMessage(ctx, objectID)
+}
+
 // GetRecentMessages gets the N most recent messages
 func (s *SessionService) GetRecentMessages(ctx context.Context, sessionID string, limit int64) ([]models.Message, error) {
 	objectID, err := primitive.ObjectIDFromHex(sessionID)
@@ -137,16 +402,26 @@ func (s *SessionService) GetRecentMessages(ctx context.Context, sessionID string
 	return s.repo.GetRecentMessages(ctx, objectID, limit)
 }
 
-// SummarizeAndClearOld summarizes old messages and keeps only recent ones
-func (s *SessionService) SummarizeAndClearOld(ctx context.Context, sessionID string, summary string, keepRecent int64) (*models.Message, error) {
+// SummarizeAndRotate replaces the old messages with the summary and moves the
+// conversation to a new AgentBedrock session, returning its ID.
+// The rotation is claimed first with a compare-and-swap on the current agent
+// session ID: if another request already summarized, it fails with
+// repository.ErrSessionRotated and leaves the messages alone.
+func (s *SessionService) SummarizeAndRotate(ctx context.Context, sessionID, branchID, currentAgentSessionID, summary string, keepRecent int64) (string, error) {
 	objectID, err := primitive.ObjectIDFromHex(sessionID)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	// Delete old messages
-	if err := s.repo.DeleteOldMessages(ctx, objectID, keepRecent); err != nil {
-		return nil, err
+	// CRITICAL: Rotate AgentBedrock session to reset its internal history
+	newAgentSessionID, err := s.repo.RotateAgentSession(ctx, objectID, currentAgentSessionID, summary)
+	if err != nil {
+		return "", err
+	}
+
+	// Hide the summarized messages from the branch and delete those no other branch inherits
+	if err := s.repo.DeleteOldMessages(ctx, objectID, branchID, keepRecent); err != nil {
+		return newAgentSessionID, err
 	}
 
 	// Save summary as a system message
@@ -154,24 +429,39 @@ func (s *SessionService) SummarizeAndClearOld(ctx context.Context, sessionID str
 		SessionID: objectID,
 		Role:      "system",
 		Content:   "[Conversation Summary]\n" + summary,
+		BranchID:  branchID,
 	}
-
 	if err := s.repo.SaveMessage(ctx, summaryMessage); err != nil {
-		return nil, err
+		return newAgentSessionID, err
 	}
 
-	return summaryMessage, nil
+	return newAgentSessionID, nil
 }
 
-// RotateAgentSession creates a new AgentBedrock session and stores the summary context
-// This is needed because AgentBedrock maintains its own conversation history
-func (s *SessionService) RotateAgentSession(ctx context.Context, sessionID string, summaryContext string) (string, error) {
+// ForkAgentSession moves the session to a new AgentBedrock session that starts
+// from summary instead of the current session's history. Like SummarizeAndRotate
+// it fails with repository.ErrSessionRotated if currentAgentSessionID is outdated.
+func (s *SessionService) ForkAgentSession(ctx context.Context, sessionID, currentAgentSessionID, summary string) (string, error) {
 	objectID, err := primitive.ObjectIDFromHex(sessionID)
 	if err != nil {
 		return "", err
 	}
 
-	return s.repo.RotateAgentSession(ctx, objectID, summaryContext)
+	return s.repo.RotateAgentSession(ctx, objectID, currentAgentSessionID, summary)
+}
+
+// SaveSummaryUsage records the token usage of a summarization of the session
+func (s *SessionService) SaveSummaryUsage(ctx context.Context, sessionID, model string, usage models.TokenUsage) error {
+	if usage.IsZero() {
+		return nil
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.SaveSummaryUsage(ctx, objectID, model, usage)
 }
 
 // ClearSummaryContext clears the summary context after it's been applied
@@ -184,6 +474,22 @@ func (s *SessionService) ClearSummaryContext(ctx context.Context, sessionID stri
 	return s.repo.ClearSummaryContext(ctx, objectID)
 }
 
+// GetAgentSettings returns the registry key of the agent a session talks to and
+// the session's persistent agent attributes
+func (s *SessionService) GetAgentSettings(ctx context.Context, sessionID string) (string, models.AgentAttributes, error) {
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return "", models.AgentAttributes{}, err
+	}
+
+	session, err := s.repo.GetSession(ctx, objectID)
+	if err != nil {
+		return "", models.AgentAttributes{}, err
+	}
+
+	return session.AgentKey, session.AgentAttributes, nil
+}
+
 // GetAgentSessionID returns the AgentBedrock session ID for a session
 func (s *SessionService) GetAgentSessionID(ctx context.Context, sessionID string) (string, string, error) {
 	objectID, err := primitive.ObjectIDFromHex(sessionID)
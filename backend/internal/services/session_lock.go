@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ui-agentbedrock/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sessionLeasePollInterval is how often a queued request checks whether the lease is free
+const sessionLeasePollInterval = 500 * time.Millisecond
+
+// ErrSessionBusy is returned while another request invokes the agent on the session
+var ErrSessionBusy = errors.New("an agent invocation is already running for this session")
+
+// SessionLockService serializes agent invocations per session across all backend
+// instances with a lease in Mongo. Two invocations on the same AgentBedrock session
+// would interleave its history, and both could summarize and rotate it.
+type SessionLockService struct {
+	repo    *repository.SessionLeaseRepository
+	ttl     time.Duration // Lease lifetime without renewal, i.e. how long a crashed holder blocks the session
+	maxWait time.Duration // How long queued requests wait for the lease
+}
+
+func NewSessionLockService(repo *repository.SessionLeaseRepository, ttl, maxWait time.Duration) *SessionLockService {
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	return &SessionLockService{
+		repo:    repo,
+		ttl:     ttl,
+		maxWait: maxWait,
+	}
+}
+
+// Acquire takes the session's lease, or returns ErrSessionBusy if it is held.
+// The lease is renewed in the background until Release is called.
+func (s *SessionLockService) Acquire(ctx context.Context, sessionID string) (*SessionLock, error) {
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	holder := primitive.NewObjectID().Hex()
+	acquired, err := s.repo.AcquireLease(ctx, objectID, holder, s.ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrSessionBusy
+	}
+
+	lock := &SessionLock{
+		service:   s,
+		sessionID: objectID,
+		holder:    holder,
+		done:      make(chan struct{}),
+	}
+	go lock.keepAlive()
+	return lock, nil
+}
+
+// Wait queues for the session's lease. It returns ErrSessionBusy if the lease is
+// still held after the maximum wait, or ctx's error if ctx ends first. Waiting
+// requests are not served in arrival order.
+func (s *SessionLockService) Wait(ctx context.Context, sessionID string) (*SessionLock, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.maxWait)
+	defer cancel()
+
+	ticker := time.NewTicker(sessionLeasePollInterval)
+	defer ticker.Stop()
+
+	for {
+		lock, err := s.Acquire(ctx, sessionID)
+		if !errors.Is(err, ErrSessionBusy) {
+			return lock, err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ErrSessionBusy
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// SessionLock is a held session lease. A nil lock is valid and releases nothing.
+type SessionLock struct {
+	service   *SessionLockService
+	sessionID primitive.ObjectID
+	holder    string
+	done      chan struct{}
+	once      sync.Once
+}
+
+// keepAlive renews the lease at a third of its TTL until the lock is released
+func (l *SessionLock) keepAlive() {
+	ticker := time.NewTicker(l.service.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-l.done:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		renewed, err := l.service.repo.RenewLease(ctx, l.sessionID, l.holder, l.service.ttl)
+		cancel()
+
+		switch {
+		case err != nil:
+			log.Printf("Warning: Failed to renew lease of session %s: %v", l.sessionID.Hex(), err)
+		case !renewed:
+			log.Printf("Warning: Lost lease of session %s", l.sessionID.Hex())
+			return
+		}
+	}
+}
+
+// Release gives up the lease. It is safe to call more than once.
+func (l *SessionLock) Release() {
+	if l == nil {
+		return
+	}
+
+	l.once.Do(func() {
+		close(l.done)
+
+		// Runs after the request, so it doesn't use the (possibly cancelled) request context
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := l.service.repo.ReleaseLease(ctx, l.sessionID, l.holder); err != nil {
+			log.Printf("Warning: Failed to release lease of session %s: %v", l.sessionID.Hex(), err)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/ui-agentbedrock/backend/internal/models"
+)
+
+// stepHierarchy assigns each step the collaborator call it ran under.
+// Trace events from a collaborator carry its CollaboratorName, so while a call
+// to that collaborator is open its events become children of the call step.
+type stepHierarchy struct {
+	calls   map[string][]int // collaborator name -> open call step indexes, innermost last
+	parents map[int]int      // step index -> parent step index
+}
+
+func newStepHierarchy() *stepHierarchy {
+	return &stepHierarchy{
+		calls:   make(map[string][]int),
+		parents: make(map[int]int),
+	}
+}
+
+// place sets the step's ParentStepIndex. A collaborator call opens a new level,
+// and its output closes it again, landing next to the call.
+func (h *stepHierarchy) place(part types.TracePart, step *models.AgentStep) {
+	name, opens, ok := collaboratorCall(part.Trace)
+	switch {
+	case ok && opens:
+		step.ParentStepIndex = h.parentFor(aws.ToString(part.CollaboratorName))
+		h.calls[name] = append(h.calls[name], step.StepIndex)
+
+	case ok:
+		open := h.calls[name]
+		if len(open) == 0 {
+			step.ParentStepIndex = h.parentFor(aws.ToString(part.CollaboratorName))
+			break
+		}
+		call := open[len(open)-1]
+		h.calls[name] = open[:len(open)-1]
+		step.ParentStepIndex = h.parents[call]
+
+	default:
+		step.ParentStepIndex = h.parentFor(aws.ToString(part.CollaboratorName))
+	}
+
+	h.parents[step.StepIndex] = step.ParentStepIndex
+}
+
+// parentFor returns the innermost open call to a collaborator, or 0 for the supervisor
+func (h *stepHierarchy) parentFor(collaboratorName string) int {
+	if open := h.calls[collaboratorName]; collaboratorName != "" && len(open) > 0 {
+		return open[len(open)-1]
+	}
+	return 0
+}
+
+// collaboratorCall reports whether a trace is the input (opens) or output of a
+// call to a collaborator agent, and the collaborator's name
+func collaboratorCall(trace types.Trace) (name string, opens, ok bool) {
+	orchestration, isOrchestration := trace.(*types.TraceMemberOrchestrationTrace)
+	if !isOrchestration {
+		return "", false, false
+	}
+
+	switch v := orchestration.Value.(type) {
+	case *types.OrchestrationTraceMemberInvocationInput:
+		if input := v.Value.AgentCollaboratorInvocationInput; input != nil {
+			return aws.ToString(input.AgentCollaboratorName), true, true
+		}
+	case *types.OrchestrationTraceMemberObservation:
+		if output := v.Value.AgentCollaboratorInvocationOutput; output != nil {
+			return aws.ToString(output.AgentCollaboratorName), false, true
+		}
+	}
+	return "", false, false
+}
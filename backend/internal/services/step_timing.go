@@ -0,0 +1,134 @@
+package services
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/ui-agentbedrock/backend/internal/models"
+)
+
+// stepTimeline pairs trace events that open a step (model invocation inputs,
+// action/knowledge base/collaborator invocation inputs) with the events that
+// close it (model outputs, observations). Bedrock sends both halves with the
+// same trace ID, so the opening step stays running until its pair arrives.
+type stepTimeline struct {
+	open map[string]int // correlation key -> index in trace.AgentSteps
+}
+
+func newStepTimeline() *stepTimeline {
+	return &stepTimeline{open: make(map[string]int)}
+}
+
+// start marks a step as running until the event closing it arrives.
+// Events that don't open a pair are left untouched.
+func (t *stepTimeline) start(part types.TracePart, step *models.AgentStep, index int) {
+	key, opens := correlationKey(part)
+	if key == "" || !opens || step.Status == "error" {
+		return
+	}
+
+	step.Status = "running"
+	step.EndTime = time.Time{}
+	step.Duration = 0
+	t.open[key] = index
+}
+
+// finish closes the step opened by the matching input event and returns its index.
+// The closing step itself is timed from the input to this event.
+func (t *stepTimeline) finish(part types.TracePart, steps []models.AgentStep, step *models.AgentStep) (int, bool) {
+	key, opens := correlationKey(part)
+	if key == "" || opens {
+		return 0, false
+	}
+
+	index, ok := t.open[key]
+	if !ok {
+		return 0, false
+	}
+	delete(t.open, key)
+
+	finishStep(&steps[index], step.StartTime, "success")
+	step.StartTime = steps[index].StartTime
+	step.Duration = stepDuration(step.StartTime, step.EndTime)
+	return index, true
+}
+
+// finishStep ends a running step at the given time
+func finishStep(step *models.AgentStep, end time.Time, status string) {
+	step.Status = status
+	step.EndTime = end
+	step.Duration = stepDuration(step.StartTime, end)
+}
+
+// stepDuration is the step's length in milliseconds. Bedrock timestamps and
+// local arrival times can disagree slightly, so it never goes negative.
+func stepDuration(start, end time.Time) int64 {
+	if end.Before(start) {
+		return 0
+	}
+	return end.Sub(start).Milliseconds()
+}
+
+// traceEventTime returns when Bedrock emitted a trace event, or when it arrived
+// if the event has no timestamp
+func traceEventTime(part types.TracePart, arrived time.Time) time.Time {
+	if part.EventTime != nil && !part.EventTime.IsZero() {
+		return *part.EventTime
+	}
+	return arrived
+}
+
+// correlationKey identifies the pair a trace event belongs to by the kind of call
+// and its trace ID. Trace IDs are unique per orchestration step, also across
+// collaborators, and the observation of a collaborator call can arrive under the
+// collaborator's name. opens is true for the input half.
+func correlationKey(part types.TracePart) (key string, opens bool) {
+	kind, traceID, opens := traceCorrelation(part.Trace)
+	if traceID == "" {
+		return "", false
+	}
+	return kind + "/" + traceID, opens
+}
+
+func traceCorrelation(trace types.Trace) (kind, traceID string, opens bool) {
+	switch t := trace.(type) {
+	case *types.TraceMemberPreProcessingTrace:
+		switch v := t.Value.(type) {
+		case *types.PreProcessingTraceMemberModelInvocationInput:
+			return "model", aws.ToString(v.Value.TraceId), true
+		case *types.PreProcessingTraceMemberModelInvocationOutput:
+			return "model", aws.ToString(v.Value.TraceId), false
+		}
+	case *types.TraceMemberOrchestrationTrace:
+		switch v := t.Value.(type) {
+		case *types.OrchestrationTraceMemberModelInvocationInput:
+			return "model", aws.ToString(v.Value.TraceId), true
+		case *types.OrchestrationTraceMemberModelInvocationOutput:
+			return "model", aws.ToString(v.Value.TraceId), false
+		case *types.OrchestrationTraceMemberInvocationInput:
+			return "invocation", aws.ToString(v.Value.TraceId), true
+		case *types.OrchestrationTraceMemberObservation:
+			return "invocation", aws.ToString(v.Value.TraceId), false
+		}
+	case *types.TraceMemberPostProcessingTrace:
+		switch v := t.Value.(type) {
+		case *types.PostProcessingTraceMemberModelInvocationInput:
+			return "model", aws.ToString(v.Value.TraceId), true
+		case *types.PostProcessingTraceMemberModelInvocationOutput:
+			return "model", aws.ToString(v.Value.TraceId), false
+		}
+	case *types.TraceMemberRoutingClassifierTrace:
+		switch v := t.Value.(type) {
+		case *types.RoutingClassifierTraceMemberModelInvocationInput:
+			return "model", aws.ToString(v.Value.TraceId), true
+		case *types.RoutingClassifierTraceMemberModelInvocationOutput:
+			return "model", aws.ToString(v.Value.TraceId), false
+		case *types.RoutingClassifierTraceMemberInvocationInput:
+			return "invocation", aws.ToString(v.Value.TraceId), true
+		case *types.RoutingClassifierTraceMemberObservation:
+			return "invocation", aws.ToString(v.Value.TraceId), false
+		}
+	}
+	return "", "", false
+}
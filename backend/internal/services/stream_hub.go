@@ -0,0 +1,152 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ui-agentbedrock/backend/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BufferedEvent is an SSE event with its position in an EventStream
+type BufferedEvent struct {
+	ID    string // "<streamID>-<seq>", sent as the SSE id
+	Seq   int64
+	Event string
+	Data  interface{}
+}
+
+// EventStream buffers every SSE event of one invocation so clients can
+// reconnect and replay what they missed
+type EventStream struct {
+	ID string
+
+	mu     sync.Mutex
+	events []BufferedEvent
+	closed bool
+	notify chan struct{} // Closed (and replaced) whenever the stream changes
+}
+
+func newEventStream() *EventStream {
+	return &EventStream{
+		ID:     primitive.NewObjectID().Hex(),
+		notify: make(chan struct{}),
+	}
+}
+
+// Publish appends an event and wakes up all followers
+func (s *EventStream) Publish(event models.SSEEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	seq := int64(len(s.events) + 1)
+	s.events = append(s.events, BufferedEvent{
+		ID:    fmt.Sprintf("%s-%d", s.ID, seq),
+		Seq:   seq,
+		Event: event.Event,
+		Data:  event.Data,
+	})
+	s.broadcast()
+}
+
+// Close marks the stream as complete; followers stop after the last event
+func (s *EventStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.broadcast()
+}
+
+// Since returns the events after seq, whether the stream is complete, and a
+// channel that is closed when more events arrive
+func (s *EventStream) Since(seq int64) ([]BufferedEvent, bool, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seq < 0 {
+		seq = 0
+	}
+	var events []BufferedEvent
+	if seq < int64(len(s.events)) {
+		events = append(events, s.events[seq:]...)
+	}
+	return events, s.closed, s.notify
+}
+
+// SeqFromEventID extracts the sequence number from a Last-Event-ID value.
+// IDs from another stream (an earlier invocation) replay from the start.
+func (s *EventStream) SeqFromEventID(lastEventID string) int64 {
+	prefix := s.ID + "-"
+	if !strings.HasPrefix(lastEventID, prefix) {
+		return 0
+	}
+	seq, err := strconv.ParseInt(strings.TrimPrefix(lastEventID, prefix), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return seq
+}
+
+func (s *EventStream) broadcast() {
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// StreamHub keeps the latest EventStream of each session, including finished
+// streams for a retention period so late reconnects can still replay them
+type StreamHub struct {
+	mu        sync.Mutex
+	streams   map[string]*EventStream
+	retention time.Duration
+}
+
+func NewStreamHub(retention time.Duration) *StreamHub {
+	return &StreamHub{
+		streams:   make(map[string]*EventStream),
+		retention: retention,
+	}
+}
+
+// Open creates a new stream for the session, replacing any previous one
+func (h *StreamHub) Open(sessionID string) *EventStream {
+	stream := newEventStream()
+
+	h.mu.Lock()
+	h.streams[sessionID] = stream
+	h.mu.Unlock()
+
+	return stream
+}
+
+// Get returns the latest stream of the session
+func (h *StreamHub) Get(sessionID string) (*EventStream, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stream, ok := h.streams[sessionID]
+	return stream, ok
+}
+
+// Finish closes the stream and removes it after the retention period
+func (h *StreamHub) Finish(sessionID string, stream *EventStream) {
+	stream.Close()
+
+	time.AfterFunc(h.retention, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.streams[sessionID] == stream {
+			delete(h.streams, sessionID)
+		}
+	})
+}
@@ -11,18 +11,37 @@ import (
 	"github.com/ui-agentbedrock/backend/internal/models"
 )
 
+// ModelInvoker is the part of the Bedrock Runtime client used for summarization
+type ModelInvoker interface {
+	InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error)
+}
+
 type SummarizeService struct {
-	bedrockClient *bedrockruntime.Client
+	bedrockClient ModelInvoker
 	modelID       string
+	prices        *PriceTable // Model prices for the cost of summarizations
 }
 
 func NewSummarizeService(cfg aws.Config) *SummarizeService {
+	return NewSummarizeServiceWithModel(bedrockruntime.NewFromConfig(cfg))
+}
+
+// NewSummarizeServiceWithModel creates a SummarizeService on top of any ModelInvoker
+// (e.g. FakeModel for offline development)
+func NewSummarizeServiceWithModel(model ModelInvoker) *SummarizeService {
 	return &SummarizeService{
-		bedrockClient: bedrockruntime.NewFromConfig(cfg),
+		bedrockClient: model,
 		modelID:       "anthropic.claude-3-haiku-20240307-v1:0", // Fast and cheap for summarization
 	}
 }
 
+// WithPrices returns a copy of the service that prices summarizations with prices
+func (s *SummarizeService) WithPrices(prices *PriceTable) *SummarizeService {
+	clone := *s
+	clone.prices = prices
+	return &clone
+}
+
 type claudeMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
@@ -39,12 +58,23 @@ type claudeResponse struct {
 	Content []struct {
 		Text string `json:"text"`
 	} `json:"content"`
+	Usage struct {
+		InputTokens  int64 `json:"input_tokens"`
+		OutputTokens int64 `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// Summary is a conversation summary with the token usage of producing it
+type Summary struct {
+	Text  string
+	Model string
+	Usage models.TokenUsage
 }
 
 // SummarizeConversation summarizes a list of messages into a concise summary
-func (s *SummarizeService) SummarizeConversation(ctx context.Context, messages []models.Message) (string, error) {
+func (s *SummarizeService) SummarizeConversation(ctx context.Context, messages []models.Message) (*Summary, error) {
 	if len(messages) == 0 {
-		return "", nil
+		return &Summary{Model: s.modelID}, nil
 	}
 
 	// Build conversation text
@@ -93,7 +123,7 @@ Provide a concise summary that captures the essential context needed to continue
 
 	bodyBytes, err := json.Marshal(requestBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Invoke model
@@ -103,20 +133,31 @@ Provide a concise summary that captures the essential context needed to continue
 		Body:        bodyBytes,
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to invoke model: %w", err)
+		return nil, fmt.Errorf("failed to invoke model: %w", err)
 	}
 
 	// Parse response
 	var response claudeResponse
 	if err := json.Unmarshal(output.Body, &response); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
 	if len(response.Content) == 0 {
-		return "", fmt.Errorf("no content in response")
+		return nil, fmt.Errorf("no content in response")
 	}
 
-	return response.Content[0].Text, nil
+	summary := &Summary{
+		Text:  response.Content[0].Text,
+		Model: s.modelID,
+		Usage: models.TokenUsage{
+			InputTokens:  response.Usage.InputTokens,
+			OutputTokens: response.Usage.OutputTokens,
+		},
+	}
+	if s.prices != nil {
+		summary.Usage.Cost = s.prices.Cost(s.modelID, summary.Usage.InputTokens, summary.Usage.OutputTokens)
+	}
+	return summary, nil
 }
 
 // EstimateTokens provides a rough estimate of token count
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/ui-agentbedrock/backend/internal/models"
+	"github.com/ui-agentbedrock/backend/internal/repository"
+)
+
+// traceArchivePruneInterval is how often archives outside the retention policy are deleted
+const traceArchivePruneInterval = time.Hour
+
+// TraceArchiveService keeps the complete raw trace of each invocation, which the
+// AgentSteps of a message only summarize, for debugging prompts.
+// Archives older than the retention period are deleted, as are the oldest ones
+// once the archive grows past maxBytes.
+type TraceArchiveService struct {
+	repo      *repository.TraceArchiveRepository
+	retention time.Duration
+	maxBytes  int64 // 0 means no size limit
+}
+
+func NewTraceArchiveService(repo *repository.TraceArchiveRepository, retention time.Duration, maxBytes int64) *TraceArchiveService {
+	return &TraceArchiveService{
+		repo:      repo,
+		retention: retention,
+		maxBytes:  maxBytes,
+	}
+}
+
+// Save stores the raw trace of an invocation
+func (s *TraceArchiveService) Save(ctx context.Context, raw *rawTrace) error {
+	data, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return s.repo.SaveTraceArchive(ctx, &models.TraceArchive{
+		TraceID:        raw.TraceID,
+		AgentID:        raw.AgentID,
+		AgentAliasID:   raw.AgentAliasID,
+		AgentSessionID: raw.SessionID,
+		Events:         len(raw.Events),
+	}, data)
+}
+
+// Open returns the archive of a trace and a reader over its JSON
+func (s *TraceArchiveService) Open(ctx context.Context, traceID string) (*models.TraceArchive, io.ReadCloser, error) {
+	archive, err := s.repo.GetTraceArchive(ctx, traceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := s.repo.OpenTraceArchive(ctx, archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	return archive, reader, nil
+}
+
+// Prune applies the retention policy
+func (s *TraceArchiveService) Prune(ctx context.Context) error {
+	expired, err := s.repo.DeleteTraceArchivesBefore(ctx, time.Now().Add(-s.retention))
+	if err != nil {
+		return err
+	}
+
+	var oversize int64
+	if s.maxBytes > 0 {
+		if oversize, err = s.repo.DeleteTraceArchivesOverSize(ctx, s.maxBytes); err != nil {
+			return err
+		}
+	}
+
+	if expired+oversize > 0 {
+		log.Printf("Pruned %d expired and %d oversize trace archives", expired, oversize)
+	}
+	return nil
+}
+
+// Start prunes the archive now and then periodically until ctx is done
+func (s *TraceArchiveService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(traceArchivePruneInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.Prune(ctx); err != nil {
+				log.Printf("Warning: Failed to prune trace archives: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// rawTrace collects the untruncated trace events of an invocation, including
+// the ones from re-invocations after returning control
+type rawTrace struct {
+	TraceID      string          `json:"traceId"`
+	AgentID      string          `json:"agentId"`
+	AgentAliasID string          `json:"agentAliasId"`
+	SessionID    string          `json:"sessionId"`
+	InputText    string          `json:"inputText"`
+	StartedAt    time.Time       `json:"startedAt"`
+	Events       []rawTraceEvent `json:"events"`
+}
+
+type rawTraceEvent struct {
+	Type          string                 `json:"type"`     // "trace" | "return_control"
+	OffsetMs      int64                  `json:"offsetMs"` // Time since the invocation started
+	Trace         *recordedTracePart     `json:"trace,omitempty"`
+	ReturnControl *recordedReturnControl `json:"returnControl,omitempty"`
+	Error         string                 `json:"error,omitempty"` // Set if the event couldn't be encoded
+}
+
+func newRawTrace(traceID string, input *bedrockagentruntime.InvokeAgentInput) *rawTrace {
+	return &rawTrace{
+		TraceID:      traceID,
+		AgentID:      aws.ToString(input.AgentId),
+		AgentAliasID: aws.ToString(input.AgentAliasId),
+		SessionID:    aws.ToString(input.SessionId),
+		InputText:    aws.ToString(input.InputText),
+		StartedAt:    time.Now(),
+		Events:       []rawTraceEvent{},
+	}
+}
+
+// observe records trace and return-control events, other events are ignored
+func (r *rawTrace) observe(event types.ResponseStream) {
+	recorded := rawTraceEvent{OffsetMs: time.Since(r.StartedAt).Milliseconds()}
+	var err error
+
+	switch v := event.(type) {
+	case *types.ResponseStreamMemberTrace:
+		recorded.Type = "trace"
+		var part recordedTracePart
+		part, err = encodeTracePart(v.Value)
+		recorded.Trace = &part
+	case *types.ResponseStreamMemberReturnControl:
+		recorded.Type = "return_control"
+		var payload recordedReturnControl
+		payload, err = encodeReturnControl(v.Value)
+		recorded.ReturnControl = &payload
+	default:
+		return
+	}
+
+	if err != nil {
+		recorded.Error = err.Error()
+	}
+	r.Events = append(r.Events, recorded)
+}
+
+// archiveTrace saves the raw trace and marks the trace as archived.
+// It runs after the invocation, so it doesn't use the (possibly cancelled) request context.
+func (s *AgentService) archiveTrace(trace *models.Trace, raw *rawTrace) {
+	if s.archive == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s.archive.Save(ctx, raw); err != nil {
+		log.Printf("Warning: Failed to archive raw trace %s: %v", trace.TraceID, err)
+		return
+	}
+	trace.Archived = true
+}
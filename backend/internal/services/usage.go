@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ui-agentbedrock/backend/internal/models"
+	"github.com/ui-agentbedrock/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// usageReportSessions is the number of sessions listed in the global usage report
+const usageReportSessions = 20
+
+// UsageService reports token usage and cost per session, agent and model
+type UsageService struct {
+	repo *repository.SessionRepository
+}
+
+func NewUsageService(repo *repository.SessionRepository) *UsageService {
+	return &UsageService{repo: repo}
+}
+
+// GetSessionUsage returns a session's total usage with a breakdown per model
+// and per message of the active branch
+func (s *UsageService) GetSessionUsage(ctx context.Context, sessionID string) (*models.SessionUsageReport, error) {
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.repo.GetSession(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Totals come from the usage records like the global report, so replaced and
+	// summarized-away messages and summarizations are included
+	totals, err := s.repo.GetUsageBySession(ctx, bson.M{"session_id": objectID}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	byModel, err := s.repo.GetUsageByModel(ctx, bson.M{"session_id": objectID}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := s.repo.GetActiveMessages(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.SessionUsageReport{
+		SessionID: sessionID,
+		ByModel:   byModel,
+		Messages:  []models.MessageUsage{},
+	}
+	if len(totals) > 0 {
+		report.Total = totals[0].TokenUsage
+	}
+	for _, message := range messages {
+		if message.Usage != nil {
+			report.Messages = append(report.Messages, models.MessageUsage{
+				MessageID: message.ID,
+				CreatedAt: message.CreatedAt,
+				Usage:     *message.Usage,
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// GetUsageReport returns usage across all sessions, grouped by agent and model,
+// with the most expensive sessions. from and to are optional.
+func (s *UsageService) GetUsageReport(ctx context.Context, from, to *time.Time) (*models.UsageReport, error) {
+	sessions, err := s.repo.GetUsageBySession(ctx, nil, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	byModel, err := s.repo.GetUsageByModel(ctx, nil, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.UsageReport{
+		From:    from,
+		To:      to,
+		ByModel: byModel,
+	}
+
+	agents := make(map[string]*models.UsageBreakdown)
+	for _, session := range sessions {
+		report.Total.Add(session.TokenUsage)
+
+		agent, ok := agents[session.AgentKey]
+		if !ok {
+			agent = &models.UsageBreakdown{Key: session.AgentKey}
+			agents[session.AgentKey] = agent
+		}
+		agent.Messages += session.Messages
+		agent.Add(session.TokenUsage)
+	}
+
+	report.ByAgent = make([]models.UsageBreakdown, 0, len(agents))
+	for _, agent := range agents {
+		report.ByAgent = append(report.ByAgent, *agent)
+	}
+	sort.Slice(report.ByAgent, func(i, j int) bool {
+		return report.ByAgent[i].Cost > report.ByAgent[j].Cost
+	})
+
+	if len(sessions) > usageReportSessions {
+		sessions = sessions[:usageReportSessions]
+	}
+	report.Sessions = sessions
+
+	return report, nil
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ui-agentbedrock/backend/internal/models"
+)
+
+// defaultWorkflowTemplates are used for templates a workflow leaves empty
+var defaultWorkflowTemplates = models.WorkflowTemplates{
+	Complete:     "✅ {workflow} complete",
+	Stopped:      "⏳ Workflow stopped at {stage} (waiting for {next})",
+	NotStarted:   "⚠️ No agents were called",
+	LastResponse: "{status}\n\nLast response from {agent}:\n{output}",
+}
+
+// LegacyWorkflow returns the DataReader → Analyzer → Auditor → Reporter pipeline
+// that was built in before workflows were configurable. The default agent keeps
+// it unless WORKFLOWS is set.
+func LegacyWorkflow() *models.WorkflowDefinition {
+	workflow := &models.WorkflowDefinition{
+		Name: "Audit",
+		Stages: []models.WorkflowStage{
+			{Collaborator: "DataReader"},
+			{Collaborator: "Analyzer"},
+			{Collaborator: "Auditor"},
+			{Collaborator: "Reporter"},
+		},
+	}
+	normalizeWorkflow(workflow)
+	return workflow
+}
+
+// ParseWorkflows parses a JSON object of agent key -> workflow, as set in the WORKFLOWS variable
+func ParseWorkflows(data string) (map[string]*models.WorkflowDefinition, error) {
+	var workflows map[string]*models.WorkflowDefinition
+	if err := json.Unmarshal([]byte(data), &workflows); err != nil {
+		return nil, fmt.Errorf("invalid workflows: %w", err)
+	}
+
+	for key, workflow := range workflows {
+		if err := normalizeWorkflow(workflow); err != nil {
+			return nil, fmt.Errorf("workflow for agent %q: %w", key, err)
+		}
+	}
+	return workflows, nil
+}
+
+// normalizeWorkflow validates a workflow and fills in its defaults
+func normalizeWorkflow(workflow *models.WorkflowDefinition) error {
+	if workflow == nil || len(workflow.Stages) == 0 {
+		return fmt.Errorf("at least one stage is required")
+	}
+
+	for i := range workflow.Stages {
+		stage := &workflow.Stages[i]
+		if stage.Collaborator == "" {
+			return fmt.Errorf("stage %d has no collaborator", i+1)
+		}
+		if stage.Name == "" {
+			stage.Name = stage.Collaborator
+		}
+	}
+
+	if workflow.Name == "" {
+		workflow.Name = "Workflow"
+	}
+	if workflow.CompletedBy == "" {
+		workflow.CompletedBy = workflow.Stages[len(workflow.Stages)-1].Collaborator
+	}
+
+	templates := &workflow.Templates
+	if templates.Complete == "" {
+		templates.Complete = defaultWorkflowTemplates.Complete
+	}
+	if templates.Stopped == "" {
+		templates.Stopped = defaultWorkflowTemplates.Stopped
+	}
+	if templates.NotStarted == "" {
+		templates.NotStarted = defaultWorkflowTemplates.NotStarted
+	}
+	if templates.LastResponse == "" {
+		templates.LastResponse = defaultWorkflowTemplates.LastResponse
+	}
+	return nil
+}
+
+// stageIndex returns the position of a collaborator's stage, or -1
+func stageIndex(workflow *models.WorkflowDefinition, collaborator string) int {
+	for i, stage := range workflow.Stages {
+		if stage.Collaborator == collaborator {
+			return i
+		}
+	}
+	return -1
+}
+
+// workflowTracker follows collaborator calls through the stages of a workflow.
+// A nil tracker (agent without a workflow) reports nothing.
+type workflowTracker struct {
+	workflow *models.WorkflowDefinition
+	last     *models.WorkflowProgressEvent
+}
+
+func newWorkflowTracker(workflow *models.WorkflowDefinition) *workflowTracker {
+	if workflow == nil {
+		return nil
+	}
+	return &workflowTracker{workflow: workflow}
+}
+
+// observe returns the workflow_progress event for a new step, if the step
+// moves the workflow forward
+func (t *workflowTracker) observe(step models.AgentStep) (models.WorkflowProgressEvent, bool) {
+	if t == nil || step.Type != "collaborator" {
+		return models.WorkflowProgressEvent{}, false
+	}
+
+	index := stageIndex(t.workflow, step.AgentName)
+	responded := step.Action == "Response"
+	completed := responded && step.AgentName == t.workflow.CompletedBy
+	if index < 0 && !completed {
+		return models.WorkflowProgressEvent{}, false
+	}
+
+	// A completing collaborator outside the stages finishes the last stage
+	if index < 0 {
+		index = len(t.workflow.Stages) - 1
+	}
+
+	// Stages can be called again (e.g. a retry), but progress never goes back
+	if t.last != nil && (t.last.Completed || index < t.last.StageIndex) {
+		return models.WorkflowProgressEvent{}, false
+	}
+
+	event := models.WorkflowProgressEvent{
+		Workflow:   t.workflow.Name,
+		Stage:      t.workflow.Stages[index].Name,
+		StageIndex: index,
+		Stages:     len(t.workflow.Stages),
+		Status:     "running",
+		Completed:  completed,
+	}
+
+	finished := index
+	if responded {
+		event.Status = "success"
+		finished++
+	}
+	event.Percent = finished * 100 / event.Stages
+	if completed {
+		event.Percent = 100
+	}
+
+	if t.last != nil && *t.last == event {
+		return models.WorkflowProgressEvent{}, false
+	}
+	t.last = &event
+	return event, true
+}
+
+// workflowStatus is the status line of the fallback answer: complete, stopped
+// at the furthest stage called, or not started. It is empty without a workflow.
+func workflowStatus(workflow *models.WorkflowDefinition, agentsCalled map[string]bool) string {
+	if workflow == nil {
+		return ""
+	}
+
+	if agentsCalled[workflow.CompletedBy] {
+		return fillWorkflowTemplate(workflow.Templates.Complete, map[string]string{"workflow": workflow.Name})
+	}
+
+	for i := len(workflow.Stages) - 1; i >= 0; i-- {
+		if !agentsCalled[workflow.Stages[i].Collaborator] {
+			continue
+		}
+
+		next := workflow.CompletedBy
+		if i+1 < len(workflow.Stages) {
+			next = workflow.Stages[i+1].Name
+		}
+		return fillWorkflowTemplate(workflow.Templates.Stopped, map[string]string{
+			"workflow": workflow.Name,
+			"stage":    workflow.Stages[i].Name,
+			"next":     next,
+		})
+	}
+
+	return fillWorkflowTemplate(workflow.Templates.NotStarted, map[string]string{"workflow": workflow.Name})
+}
+
+// fillWorkflowTemplate replaces the {placeholders} of a template
+func fillWorkflowTemplate(template string, values map[string]string) string {
+	pairs := make([]string, 0, 2*len(values))
+	for key, value := range values {
+		pairs = append(pairs, "{"+key+"}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
@@ -12,6 +12,23 @@ interface AgentStep {
   duration?: number
 }
 
+interface WorkflowProgress {
+  workflow?: string
+  stage: string
+  stageIndex: number
+  stages: number
+  status: 'running' | 'success'
+  percent: number
+  completed: boolean
+}
+
+interface GuardrailBlocked {
+  stepIndex: number
+  inputBlocked: boolean
+  outputBlocked: boolean
+  policies: { source: string; policy: string; type?: string; name?: string; action: string }[]
+}
+
 interface Message {
   id: string
   sessionId: string
@@ -34,6 +51,8 @@ export function useChat() {
   const currentError = useState<any>('currentError', () => null)
   const abortController = useState<AbortController | null>('abortController', () => null)
   const wasSummarized = useState<boolean>('wasSummarized', () => false)
+  const workflowProgress = useState<WorkflowProgress | null>('workflowProgress', () => null)
+  const guardrailBlocked = useState<GuardrailBlocked | null>('guardrailBlocked', () => null)
 
   const { getDocumentIds } = useDocumentUpload()
 
@@ -46,6 +65,8 @@ export function useChat() {
     agentSteps.value = []
     currentError.value = null
     wasSummarized.value = false
+    workflowProgress.value = null
+    guardrailBlocked.value = null
 
     // Get document IDs
     const documentIds = getDocumentIds()
@@ -87,6 +108,11 @@ export function useChat() {
         signal: abortController.value.signal,
       })
 
+      if (response.status === 409) {
+        // Another tab is still waiting for the agent on this session
+        const body = await response.json().catch(() => ({}))
+        throw new Error(body.error || 'An agent invocation is already running for this session')
+      }
       if (!response.ok) {
         throw new Error('Failed to send message')
       }
@@ -118,7 +144,13 @@ export function useChat() {
               const data = JSON.parse(dataStr)
               
               // Determine event type from previous line or data structure
-              if (data.status !== undefined && typeof data.status === 'string' && !data.stepIndex) {
+              if (data.policies !== undefined && data.inputBlocked !== undefined) {
+                // guardrail_blocked event
+                guardrailBlocked.value = data as GuardrailBlocked
+              } else if (data.stageIndex !== undefined && data.percent !== undefined) {
+                // workflow_progress event
+                workflowProgress.value = data as WorkflowProgress
+              } else if (data.status !== undefined && typeof data.status === 'string' && !data.stepIndex) {
                 // thinking event
                 thinkingStatus.value = data.status
               } else if (data.stepIndex !== undefined) {
@@ -137,6 +169,13 @@ export function useChat() {
               } else if (data.traceId !== undefined) {
                 // trace event
                 updateLastMessage(fullContent, data)
+              } else if (data.retryAfter !== undefined && data.message !== undefined) {
+                // service_unavailable event - the backend fails fast while Bedrock is degraded
+                currentError.value = {
+                  type: 'ServiceUnavailable',
+                  message: `${data.message}. Please try again in ${data.retryAfter}s.`,
+                }
+                thinkingStatus.value = null
               } else if (data.type !== undefined && data.message !== undefined && data.type !== 'StreamError') {
                 // error event
                 currentError.value = data
@@ -168,12 +207,28 @@ export function useChat() {
     }
   }
 
-  const stopStream = () => {
-    if (abortController.value) {
-      abortController.value.abort()
-      isStreaming.value = false
-      thinkingStatus.value = null
+  const stopStream = async () => {
+    if (!abortController.value) return
+
+    // Ask the backend to cancel the agent run so the partial answer is saved;
+    // fall back to dropping the connection if that fails
+    if (currentSession.value) {
+      try {
+        const response = await fetch(`${apiBase}/api/chat/${currentSession.value.id}/cancel`, {
+          method: 'POST',
+        })
+        if (response.ok) {
+          thinkingStatus.value = null
+          return
+        }
+      } catch (error) {
+        console.error('Failed to cancel generation:', error)
+      }
     }
+
+    abortController.value?.abort()
+    isStreaming.value = false
+    thinkingStatus.value = null
   }
 
   const clearError = () => {
@@ -211,6 +266,8 @@ export function useChat() {
     agentSteps,
     currentError,
     wasSummarized,
+    workflowProgress,
+    guardrailBlocked,
     sendMessage,
     stopStream,
     clearError,
@@ -16,6 +16,8 @@ interface UploadedDocument {
   fileSize: number
   content?: string
   s3Key?: string
+  pages?: { page: number; chars: number }[] // Characters extracted per page (PDF)
+  extractionError?: string // The file was stored but no text could be extracted
 }
 
 interface PresignedURLResponse {
@@ -26,8 +28,15 @@ interface PresignedURLResponse {
   documentId: string
 }
 
-// Excel file extensions that should use presigned S3 upload
-const EXCEL_EXTENSIONS = ['.xlsx', '.xls']
+// An uploadable format, as listed by the backend's extractor registry
+interface FileFormat {
+  fileType: string
+  label: string
+  extensions: string[]
+  mimeTypes: string[]
+  maxSize: number
+  storage: 'gridfs' | 's3'
+}
 
 export function useDocumentUpload() {
   const config = useRuntimeConfig()
@@ -37,6 +46,34 @@ export function useDocumentUpload() {
   const isUploading = useState<boolean>('isUploading', () => false)
   const uploadError = useState<string | null>('uploadError', () => null)
   const uploadProgress = useState<number>('uploadProgress', () => 0)
+  // Empty until fetchFormats succeeds; the backend still validates every upload
+  const fileFormats = useState<FileFormat[]>('fileFormats', () => [])
+
+  const fetchFormats = async () => {
+    try {
+      const response = await fetch(`${apiBase}/api/upload/formats`)
+      if (response.ok) {
+        fileFormats.value = await response.json()
+      }
+    } catch (error) {
+      console.error('Failed to fetch upload formats:', error)
+    }
+  }
+
+  const acceptedExtensions = computed(() =>
+    fileFormats.value.flatMap(format => format.extensions).join(',')
+  )
+
+  // Largest size limit, for display
+  const maxFileSize = computed(() =>
+    Math.max(0, ...fileFormats.value.map(format => format.maxSize))
+  )
+
+  const findFormat = (file: File): FileFormat | undefined => {
+    const fileExtension = '.' + file.name.split('.').pop()?.toLowerCase()
+    return fileFormats.value.find(format => format.extensions.includes(fileExtension))
+      ?? fileFormats.value.find(format => file.type && format.mimeTypes.includes(file.type))
+  }
 
   const uploadFile = async (file: File, sessionId: string): Promise<UploadedDocument | null> => {
     if (!sessionId) {
@@ -44,34 +81,26 @@ export function useDocumentUpload() {
       return null
     }
 
-    // Validate file size (10MB)
-    const maxSize = 10 * 1024 * 1024
-    if (file.size > maxSize) {
-      uploadError.value = `File size exceeds maximum allowed size of ${(maxSize / 1024 / 1024).toFixed(0)}MB`
-      return null
+    // Validate file type and size against the backend's formats, if they can be loaded
+    if (fileFormats.value.length === 0) {
+      await fetchFormats()
     }
-
-    // Validate file type
-    const allowedTypes = [
-      'application/pdf', 
-      'application/vnd.openxmlformats-officedocument.wordprocessingml.document', 
-      'application/msword', 
-      'text/plain', 
-      'text/markdown',
-      'application/vnd.openxmlformats-officedocument.spreadsheetml.sheet',
-      'application/vnd.ms-excel'
-    ]
-    const allowedExtensions = ['.pdf', '.docx', '.doc', '.txt', '.md', '.xlsx', '.xls']
-    const fileExtension = '.' + file.name.split('.').pop()?.toLowerCase()
-    
-    if (!allowedTypes.includes(file.type) && !allowedExtensions.includes(fileExtension)) {
-      uploadError.value = 'Unsupported file type. Allowed types: PDF, DOCX, DOC, TXT, MD, XLSX, XLS'
-      return null
+    const format = findFormat(file)
+    if (fileFormats.value.length > 0) {
+      if (!format) {
+        const labels = [...new Set(fileFormats.value.map(f => f.label))].join(', ')
+        uploadError.value = `Unsupported file type. Allowed types: ${labels}`
+        return null
+      }
+      if (file.size > format.maxSize) {
+        uploadError.value = `${format.label} files are limited to ${(format.maxSize / 1024 / 1024).toFixed(0)}MB`
+        return null
+      }
     }
 
-    // Check if this is an Excel file - use presigned S3 upload
-    if (EXCEL_EXTENSIONS.includes(fileExtension)) {
-      return await uploadExcelFile(file, sessionId)
+    // Formats routed to S3 (Excel, when the backend has the Lambda) use a presigned upload
+    if (format?.storage === 's3') {
+      return uploadExcelFile(file, sessionId)
     }
 
     isUploading.value = true
@@ -118,6 +147,11 @@ export function useDocumentUpload() {
       const result = await uploadPromise
       uploadedDocuments.value = [...uploadedDocuments.value, result]
       uploadProgress.value = 100
+
+      // Attached, but the agent won't be able to read it
+      if (result.extractionError) {
+        uploadError.value = `${result.filename}: ${result.extractionError}`
+      }
       
       return result
     } catch (error: any) {
@@ -144,7 +178,8 @@ export function useDocumentUpload() {
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({
           sessionId,
-          filename: file.name
+          filename: file.name,
+          fileSize: file.size
         })
       })
 
@@ -187,6 +222,11 @@ export function useDocumentUpload() {
       const result: UploadedDocument = await confirmResponse.json()
       uploadedDocuments.value = [...uploadedDocuments.value, result]
       uploadProgress.value = 100
+
+      // Attached, but the agent won't be able to read it
+      if (result.extractionError) {
+        uploadError.value = `${result.filename}: ${result.extractionError}`
+      }
       
       return result
     } catch (error: any) {
@@ -219,6 +259,10 @@ export function useDocumentUpload() {
     uploadError,
     uploadProgress,
     uploadFile,
+    fileFormats,
+    fetchFormats,
+    acceptedExtensions,
+    maxFileSize,
     removeDocument,
     clearDocuments,
     getDocumentIds,